@@ -2,21 +2,23 @@ package cmd
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
-	"os/signal"
 	"path"
+	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
+	"github.com/marsom/serverbin/internal/config"
 	"github.com/marsom/serverbin/internal/core"
 	"github.com/marsom/serverbin/internal/httphandler"
+	"github.com/marsom/serverbin/internal/metrics"
 	"github.com/marsom/serverbin/internal/server"
 	"github.com/marsom/serverbin/internal/swagger"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -24,7 +26,23 @@ type HttpCmd struct {
 	Address           string   `kong:"help='Listen address.',default=':8080'"`
 	ManagementAddress string   `kong:"help='Readiness, liveness and metric listen address.',default=':8081'"`
 	Context           []string `kong:"help='Run api on multiple paths.',default='/,/a,/b'"`
+	Config            string   `kong:"help='Configuration file (yaml or json) with the contexts, flags are used as defaults.',type='existingfile'"`
 
+	ContextFlags
+	HttpServerFlags
+	LimitFlags
+	IdentityFlags
+	AccessLogFlags
+	TracingFlags
+
+	// server
+	ServerSocketMode              string        `kong:"group='Server',help='File permissions of unix domain sockets.',default='0666'"`
+	ServerShutdownDelay           time.Duration `kong:"group='Server',help='Delay shutdown and let a load balancer remove traffic from this backend.',default='2s'"`
+	ServerGracefulShutdownTimeout time.Duration `kong:"group='Server',help='Graceful shutdown time, active connections are closed immediately with 0.',default='2m'"`
+}
+
+// ContextFlags are the defaults of all contexts
+type ContextFlags struct {
 	// cookies
 	Cookie         bool     `kong:"group='Cookies',help='Enable/Disable cookies.',default='true'"`
 	CookieNames    []string `kong:"group='Cookies',help='Cookie names.',default='a,b,c'"`
@@ -42,125 +60,392 @@ type HttpCmd struct {
 	Redirect    bool `kong:"group='Redirects',help='Enable/Disable redirect requests .',default='true'"`
 	RedirectMax uint `kong:"group='Redirects',help='Maximum allowed redirects.',default='20'"`
 
+	// proxy
+	Proxy             bool          `kong:"group='Proxy',help='Enable/Disable the proxy and chain requests to upstream servers.',default='false'"`
+	ProxyAllowedHosts []string      `kong:"group='Proxy',help='Allowed upstream hosts, supports wildcards i.e. *.svc.cluster.local and ports i.e. backend:8080.'"`
+	ProxyMaxHops      int           `kong:"group='Proxy',help='Maximum number of hops of a proxied request.',default='5'"`
+	ProxyTimeout      time.Duration `kong:"group='Proxy',help='Timeout of upstream requests.',default='10s'"`
+	ProxyInsecure     bool          `kong:"group='Proxy',help='Skip the verification of upstream tls certificates.',default='false'"`
+
+	// rate limit
+	RateLimit           bool          `kong:"group='Rate limit',help='Enable/Disable the ratelimit requests.',default='true'"`
+	RateLimitLimit      int           `kong:"group='Rate limit',help='Limit all requests of a context within the window (0 is unlimited).',default='0'"`
+	RateLimitWindow     time.Duration `kong:"group='Rate limit',help='Window in which the limit is refilled.',default='1m'"`
+	RateLimitKey        string        `kong:"group='Rate limit',help='Bucket of the limit: ${enum}',enum='context,client-ip,header',default='client-ip'"`
+	RateLimitHeader     string        `kong:"group='Rate limit',help='Api key header of the header key, the client ip is used without header.',default='X-Api-Key'"`
+	RateLimitMaxWindow  time.Duration `kong:"group='Rate limit',help='Maximum allowed window of the ratelimit requests.',default='1h'"`
+	RateLimitMaxBuckets int           `kong:"group='Rate limit',help='Maximum number of token buckets of a context, unused buckets are purged every minute.',default='10000'"`
+
+	// flaky
+	Flaky        bool `kong:"group='Flaky',help='Enable/Disable the flaky, sequence and percent requests.',default='true'"`
+	FlakyMaxKeys int  `kong:"group='Flaky',help='Maximum number of keys with attempts, reset them with the management api.',default='10000'"`
+
+	// store
+	Store        bool `kong:"group='Store',help='Enable/Disable the in memory resource store.',default='true'"`
+	StoreMaxKeys int  `kong:"group='Store',help='Maximum number of resources and idempotency keys of the store.',default='1000'"`
+
+	// cors
+	Cors                 bool          `kong:"group='Cors',help='Enable/Disable the cors policy.',default='true'"`
+	CorsAllowedOrigins   []string      `kong:"group='Cors',help='Allowed origins, supports wildcards i.e. https://*.example.com.',default='*'"`
+	CorsAllowedMethods   []string      `kong:"group='Cors',help='Allowed methods.',default='GET,HEAD,PUT,POST,DELETE,PATCH,OPTIONS'"`
+	CorsAllowedHeaders   []string      `kong:"group='Cors',help='Allowed request headers.',default='*'"`
+	CorsExposeHeaders    []string      `kong:"group='Cors',help='Response headers exposed to the client.'"`
+	CorsAllowCredentials bool          `kong:"group='Cors',help='Allow credentials.',default='false'"`
+	CorsMaxAge           time.Duration `kong:"group='Cors',help='How long the results of a preflight request can be cached.',default='0s'"`
+
 	// server
-	MaxRequestBody                int64         `kong:"group='Server',help='Max request body size in bytes.',default='1048576'"`
-	ServerTrustedAddresses        []*net.IPNet  `kong:"group='Server',help='Trusted addresses that are known to send correct headers.',default='0.0.0.0/0,::0/0'"`
-	ServerShutdownDelay           time.Duration `kong:"group='Server',help='Delay shutdown and let a load balancer remove traffic from this backend.',default='2s'"`
-	ServerGracefulShutdownTimeout time.Duration `kong:"group='Server',help='Graceful shutdown time.',default='2m'"`
+	MaxRequestBody         int64        `kong:"group='Server',help='Max request body size in bytes.',default='1048576'"`
+	ServerTrustedAddresses []*net.IPNet `kong:"group='Server',help='Trusted addresses that are known to send correct headers.',default='0.0.0.0/0,::0/0'"`
+	ServerForwardedHeaders []string     `kong:"group='Server',help='Headers of trusted proxies which resolve the client ip in the order of priority (forwarded, x-forwarded-for, x-real-ip).',default='forwarded,x-forwarded-for,x-real-ip'"`
+}
+
+// HttpServerFlags are the connection settings of all http servers
+type HttpServerFlags struct {
+	ServerReadTimeout                time.Duration `kong:"group='Connection',help='Maximum duration for reading the entire request, including the body (0 is no timeout).',default='0s'"`
+	ServerReadHeaderTimeout          time.Duration `kong:"group='Connection',help='Maximum duration for reading the request headers (0 uses the read timeout).',default='0s'"`
+	ServerWriteTimeout               time.Duration `kong:"group='Connection',help='Maximum duration before timing out writes of the response (0 is no timeout).',default='0s'"`
+	ServerIdleTimeout                time.Duration `kong:"group='Connection',help='Maximum time to wait for the next request when keep-alives are enabled (0 uses the read timeout).',default='0s'"`
+	ServerMaxHeaderBytes             int           `kong:"group='Connection',help='Maximum size of the request headers in bytes.',default='1048576'"`
+	ServerKeepAlive                  bool          `kong:"group='Connection',help='Enable/Disable keep-alive connections.',default='true'"`
+	ServerConnectionClose            string        `kong:"group='Connection',help='Add a Connection: close header to the responses (never, always, random).',enum='never,always,random',default='never'"`
+	ServerConnectionCloseProbability float64       `kong:"group='Connection',help='Probability of the random connection close mode.',default='0.5'"`
+	ServerMaxRequestsPerConnection   int64         `kong:"group='Connection',help='Close a connection after the given number of requests (0 is unlimited).',default='0'"`
 }
 
-func corsHandler(next http.Handler) http.Handler {
+func (r *HttpServerFlags) connection() server.HttpConnection {
+	return server.HttpConnection{
+		ReadTimeout:       r.ServerReadTimeout,
+		ReadHeaderTimeout: r.ServerReadHeaderTimeout,
+		WriteTimeout:      r.ServerWriteTimeout,
+		IdleTimeout:       r.ServerIdleTimeout,
+		MaxHeaderBytes:    r.ServerMaxHeaderBytes,
+		DisableKeepAlives: !r.ServerKeepAlive,
+		Close:             r.ServerConnectionClose,
+		CloseProbability:  r.ServerConnectionCloseProbability,
+		MaxRequests:       r.ServerMaxRequestsPerConnection,
+	}
+}
+
+func corsHandler(cors *httphandler.Cors, next http.Handler) http.Handler {
+	if cors == nil {
+		return next
+	}
+
+	return httphandler.CorsHandler(*cors, next)
+}
+
+// contextCorsHandler applies the cors policy of the context of the request path, requests outside of the contexts use
+// the fallback policy
+func contextCorsHandler(configs []httphandler.Config, fallback *httphandler.Cors, next http.Handler) http.Handler {
+	handlers := make(map[string]http.Handler, len(configs))
+	for _, c := range configs {
+		handlers[c.Path] = corsHandler(c.Cors, next)
+	}
+
+	other := corsHandler(fallback, next)
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if c, ok := contextConfig(configs, r.URL.Path); ok {
+			handlers[c.Path].ServeHTTP(w, r)
+			return
+		}
 
-		next.ServeHTTP(w, r)
+		other.ServeHTTP(w, r)
 	})
 }
 
-func findBaseUrl(s string) (*url.URL, error) {
-	fields := strings.SplitN(s, ":", 2)
-	if fields[0] == "" {
-		return url.Parse("http://localhost:" + fields[1])
+// contextConfig returns the config of the context which serves the path, the longest context path wins
+func contextConfig(configs []httphandler.Config, p string) (httphandler.Config, bool) {
+	var result httphandler.Config
+
+	found := false
+
+	for _, c := range configs {
+		root := strings.TrimSuffix(c.Path, "/")
+		if p != root && !strings.HasPrefix(p, root+"/") {
+			continue
+		}
+
+		if !found || len(c.Path) > len(result.Path) {
+			result, found = c, true
+		}
+	}
+
+	return result, found
+}
+
+// parseSocketMode parses octal file permissions, i.e. 0660
+func parseSocketMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid socket mode %q: %w", s, err)
 	}
 
-	//goland:noinspection HttpUrlsUsage
-	return url.Parse("http://" + fields[0] + ":" + fields[1])
+	return os.FileMode(mode), nil
 }
 
-func (r *HttpCmd) Run() error {
-	// @TODO: validate context field
+func findBaseUrl(scheme, s string) (*url.URL, error) {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil || server.IsUnixAddress(s) {
+		return url.Parse(scheme + "://localhost")
+	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
+	// inherited listeners, i.e. systemd:http
+	if _, err := strconv.Atoi(port); err != nil {
+		return url.Parse(scheme + "://localhost")
+	}
+
+	if host == "" {
+		host = "localhost"
+	}
 
-	return serve(ctx, r)
+	return url.Parse(scheme + "://" + net.JoinHostPort(host, port))
 }
 
-func serve(ctx context.Context, cmd *HttpCmd) (err error) {
-	baseUrl, err := findBaseUrl(cmd.Address)
+func (r *HttpCmd) Run(info BuildInfo) error {
+	file, err := r.configFile()
 	if err != nil {
 		return err
 	}
 
-	managementBaseUrl, err := findBaseUrl(cmd.ManagementAddress)
-	if err != nil {
-		return err
+	ctx, stop := signalContext()
+	defer stop()
+
+	return serve(ctx, r, file, info)
+}
+
+// defaultContext returns the context configured by flags
+func (r *ContextFlags) defaultContext() config.Context {
+	c := config.Context{
+		MaxRequestBody:   r.MaxRequestBody,
+		ForwardedHeaders: r.ServerForwardedHeaders,
 	}
 
-	readinessHandler, readinessOn, readinessOff := core.StateHandler()
-	livenessHandler, livenessOn, _ := core.StateHandler()
-	livenessOn()
+	for _, n := range r.ServerTrustedAddresses {
+		c.TrustedAddresses = append(c.TrustedAddresses, config.IPNet{IPNet: n})
+	}
 
-	var configs []httphandler.Config
-	for _, c := range cmd.Context {
-		config := httphandler.Config{
-			Path: c,
-			Server: httphandler.Server{
-				MaxRequestBody:    cmd.MaxRequestBody,
-				BaseUrl:           baseUrl,
-				ManagementBaseUrl: managementBaseUrl,
-				TrustedAddresses:  cmd.ServerTrustedAddresses,
-			},
+	if r.Cookie {
+		c.Cookie = &config.Cookie{
+			Names:    r.CookieNames,
+			HttpOnly: r.CookieHttpOnly,
+			Secure:   false,
 		}
+	}
 
-		if cmd.Cookie {
-			config.Cookie = &httphandler.Cookie{
-				Names:      cmd.CookieNames,
-				HttpOnly:   cmd.CookieHttpOnly,
-				Secure:     false,
-				Customizer: nil,
-			}
+	if r.Delay {
+		c.Delay = &config.Delay{
+			Max: r.DelayMax,
 		}
+	}
 
-		if cmd.Delay {
-			config.Delay = &httphandler.Delay{
-				MaxDuration: cmd.DelayMax,
-			}
+	if r.Slow {
+		c.Slow = &config.Slow{
+			Max: r.SlowMax,
 		}
+	}
 
-		if cmd.Slow {
-			config.Slow = &httphandler.Slow{
-				MaxDuration: cmd.SlowMax,
-			}
+	if r.Redirect {
+		c.Redirect = &config.Redirect{
+			Max: r.RedirectMax,
 		}
+	}
 
-		if cmd.Redirect {
-			config.Redirect = &httphandler.Redirect{
-				Max: cmd.RedirectMax,
-			}
+	if r.Proxy {
+		c.Proxy = &config.Proxy{
+			AllowedHosts: r.ProxyAllowedHosts,
+			MaxHops:      r.ProxyMaxHops,
+			Timeout:      r.ProxyTimeout,
+			Insecure:     r.ProxyInsecure,
 		}
+	}
 
-		configs = append(configs, config)
+	if r.RateLimit {
+		c.RateLimit = &config.RateLimit{
+			Limit:      &r.RateLimitLimit,
+			Window:     r.RateLimitWindow,
+			Key:        r.RateLimitKey,
+			Header:     r.RateLimitHeader,
+			MaxWindow:  r.RateLimitMaxWindow,
+			MaxBuckets: r.RateLimitMaxBuckets,
+		}
 	}
 
-	mux := http.NewServeMux()
-	if cmd.Address == cmd.ManagementAddress {
-		mux.Handle("/-/metrics", promhttp.Handler())
-		mux.HandleFunc("/-/readiness", readinessHandler)
-		mux.HandleFunc("/-/liveness", livenessHandler)
+	if r.Flaky {
+		c.Flaky = &config.Flaky{
+			MaxKeys: r.FlakyMaxKeys,
+		}
+	}
+
+	if r.Store {
+		c.Store = &config.Store{
+			MaxKeys: r.StoreMaxKeys,
+		}
+	}
+
+	if r.Cors {
+		c.Cors = &config.Cors{
+			AllowedOrigins:   r.CorsAllowedOrigins,
+			AllowedMethods:   r.CorsAllowedMethods,
+			AllowedHeaders:   r.CorsAllowedHeaders,
+			ExposeHeaders:    r.CorsExposeHeaders,
+			AllowCredentials: r.CorsAllowCredentials,
+			MaxAge:           &r.CorsMaxAge,
+		}
+	}
+
+	return c
+}
+
+// corsPolicy returns the cors policy of the swagger ui and the management api
+func (r *ContextFlags) corsPolicy() *httphandler.Cors {
+	if !r.Cors {
+		return nil
+	}
+
+	return &httphandler.Cors{
+		AllowedOrigins:   r.CorsAllowedOrigins,
+		AllowedMethods:   r.CorsAllowedMethods,
+		AllowedHeaders:   r.CorsAllowedHeaders,
+		ExposeHeaders:    r.CorsExposeHeaders,
+		AllowCredentials: r.CorsAllowCredentials,
+		MaxAge:           r.CorsMaxAge,
+	}
+}
+
+// defaultServer resolves the client ip of requests outside of the contexts
+func (r *ContextFlags) defaultServer(trusted []*net.IPNet) httphandler.Server {
+	return httphandler.Server{
+		TrustedAddresses: trusted,
+		ForwardedHeaders: r.ServerForwardedHeaders,
+	}
+}
+
+// configFile loads the configuration file or creates one from the flags
+func (r *HttpCmd) configFile() (*config.File, error) {
+	defaults := r.defaultContext()
+
+	file := &config.File{}
+
+	if r.Config != "" {
+		f, err := config.Load(r.Config)
+		if err != nil {
+			return nil, err
+		}
+
+		f.ApplyDefaults(defaults)
+		file = f
 	} else {
-		go func() {
-			managementMux := http.NewServeMux()
+		for _, p := range r.Context {
+			c := defaults
+			c.Path = p
+
+			file.Contexts = append(file.Contexts, c)
+		}
+	}
+
+	if err := file.Validate(); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func serve(ctx context.Context, cmd *HttpCmd, file *config.File, info BuildInfo) (err error) {
+	baseUrl, err := findBaseUrl("http", cmd.Address)
+	if err != nil {
+		return err
+	}
+
+	managementBaseUrl, err := findBaseUrl("http", cmd.ManagementAddress)
+	if err != nil {
+		return err
+	}
 
-			managementMux.Handle("/-/metrics", corsHandler(promhttp.Handler()))
-			managementMux.Handle("/-/readiness", corsHandler(http.HandlerFunc(readinessHandler)))
-			managementMux.Handle("/-/liveness", corsHandler(http.HandlerFunc(livenessHandler)))
+	socketMode, err := parseSocketMode(cmd.ServerSocketMode)
+	if err != nil {
+		return err
+	}
+
+	identity, err := cmd.identity(info)
+	if err != nil {
+		return err
+	}
 
-			srv := server.HttpServer{
-				Name:                    "management",
-				Address:                 cmd.ManagementAddress,
-				ShutdownDelay:           0 * time.Second,
-				GracefulShutdownTimeout: 3 * time.Second,
-				Handler:                 managementMux,
-			}
+	m, synthetic, err := newMetrics()
+	if err != nil {
+		return err
+	}
 
-			if err := srv.ListenAndServe(ctx); err != nil {
-				log.Fatalf("managemnt server failed: %s", err)
-			}
-		}()
+	access, err := cmd.accessLog()
+	if err != nil {
+		return err
 	}
 
-	mux.Handle("/", swagger.MustUiHandler())
+	tracer := cmd.tracer(info, identity)
+
+	readinessHandler, readinessOn, readinessOff := core.StateHandler()
+	livenessHandler, livenessOn, _ := core.StateHandler()
+	livenessOn()
+
+	cors := cmd.corsPolicy()
+	attempts := httphandler.NewAttempts()
+
+	var configs []httphandler.Config
+	for _, c := range file.Contexts {
+		configs = append(configs, c.Handler(httphandler.Server{
+			BaseUrl:           baseUrl,
+			ManagementBaseUrl: managementBaseUrl,
+			Identity:          identity,
+			Metrics:           m,
+			Tracer:            tracer,
+			Attempts:          attempts,
+		}))
+	}
+
+	services := tracingServices(tracer)
+
+	mux := newApiMux(cors, configs)
+	if cmd.Address == cmd.ManagementAddress {
+		registerManagementHandlers(mux, configs, cors, synthetic, attempts, readinessHandler, livenessHandler)
+	} else {
+		managementMux := http.NewServeMux()
+		registerManagementHandlers(managementMux, configs, cors, synthetic, attempts, readinessHandler, livenessHandler)
+
+		services = append(services, &server.HttpServer{
+			Name:                    "management",
+			Address:                 cmd.ManagementAddress,
+			SocketMode:              socketMode,
+			GracefulShutdownTimeout: 3 * time.Second,
+			Handler:                 managementMux,
+		})
+	}
+
+	services = append(services, &server.HttpServer{
+		Name:                    "http",
+		Address:                 cmd.Address,
+		SocketMode:              socketMode,
+		GracefulShutdownTimeout: cmd.ServerGracefulShutdownTimeout,
+		Handler:                 accessHandler(access, "http", configs, cmd.defaultServer(cmd.ServerTrustedAddresses), tracer.Handler("http", cmd.identityHandler(identity, mux))),
+		Connection:              cmd.connection(),
+		Limits:                  cmd.limits(),
+	})
+
+	lifecycle := server.Lifecycle{
+		ShutdownDelay: cmd.ServerShutdownDelay,
+		ReadinessOn:   readinessOn,
+		ReadinessOff:  readinessOff,
+	}
+
+	return lifecycle.Run(ctx, services...)
+}
+
+// newApiMux creates a mux with the swagger ui and the api of all contexts, the swagger ui uses the cors policy of the
+// context of the request path
+func newApiMux(cors *httphandler.Cors, configs []httphandler.Config) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.Handle("/", contextCorsHandler(configs, cors, swagger.MustUiHandler()))
 	mux.Handle("/swagger-config.yaml", swagger.ConfigHandler("api.yaml", configs...))
 	mux.Handle("/apis.yaml", swagger.DefinitionHandler(configs...))
 	mux.Handle("/management-api.yaml", swagger.ManagementDefinitionHandler(configs...))
@@ -171,15 +456,33 @@ func serve(ctx context.Context, cmd *HttpCmd) (err error) {
 
 	httphandler.RegisterHandlers(mux, configs...)
 
-	srv := server.HttpServer{
-		Name:                    "http",
-		Address:                 cmd.Address,
-		ShutdownDelay:           cmd.ServerShutdownDelay,
-		GracefulShutdownTimeout: cmd.ServerGracefulShutdownTimeout,
-		Handler:                 mux,
-		ReadinessOn:             readinessOn,
-		ReadinessOff:            readinessOff,
+	return mux
+}
+
+// registerManagementHandlers registers the management api, the cors policy is resolved like the one of the api
+func registerManagementHandlers(mux *http.ServeMux, configs []httphandler.Config, cors *httphandler.Cors, synthetic *metrics.Synthetic, attempts *httphandler.Attempts, readinessHandler, livenessHandler http.HandlerFunc) {
+	mux.Handle("/-/metrics", contextCorsHandler(configs, cors, promhttp.Handler()))
+	mux.Handle("/-/synthetic-metrics/", contextCorsHandler(configs, cors, synthetic.Handler("/-/synthetic-metrics/")))
+
+	if attempts != nil {
+		mux.Handle("/-/attempts/", contextCorsHandler(configs, cors, attempts.Handler("/-/attempts/")))
+	}
+
+	mux.Handle("/-/readiness", contextCorsHandler(configs, cors, readinessHandler))
+	mux.Handle("/-/liveness", contextCorsHandler(configs, cors, livenessHandler))
+}
+
+// newMetrics registers the metrics of the test traffic and the synthetic metrics
+func newMetrics() (*metrics.Metrics, *metrics.Synthetic, error) {
+	m, err := metrics.New(prometheus.DefaultRegisterer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	synthetic := metrics.NewSynthetic(prometheus.DefaultGatherer)
+	if err := prometheus.Register(synthetic); err != nil {
+		return nil, nil, err
 	}
 
-	return srv.ListenAndServe(ctx)
+	return m, synthetic, nil
 }
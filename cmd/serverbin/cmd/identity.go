@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"net/http"
+
+	"github.com/marsom/serverbin/internal/core"
+)
+
+// IdentityFlags identify the instance which answered a request
+type IdentityFlags struct {
+	Identity           bool              `kong:"group='Identity',help='Enable/Disable the server identity in responses.',default='true'"`
+	IdentityInstanceID string            `kong:"group='Identity',help='Instance id, a random id by default.'"`
+	IdentityLabels     map[string]string `kong:"group='Identity',help='Labels of this instance, i.e. zone=a;team=b.'"`
+	IdentityHeader     string            `kong:"group='Identity',help='Response header with the instance id, empty to disable.',default='X-Serverbin-Instance'"`
+}
+
+func (r *IdentityFlags) identity(info BuildInfo) (*core.Identity, error) {
+	if !r.Identity {
+		return nil, nil
+	}
+
+	return core.NewIdentity(r.IdentityInstanceID, info.Version, r.IdentityLabels)
+}
+
+// identityHandler adds the instance id to all responses
+func (r *IdentityFlags) identityHandler(identity *core.Identity, next http.Handler) http.Handler {
+	if identity == nil || r.IdentityHeader == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(r.IdentityHeader, identity.InstanceID)
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/marsom/serverbin/internal/server"
+)
+
+// LimitFlags limit the client connections of the http and tcp servers
+type LimitFlags struct {
+	LimitMaxConnections int     `kong:"group='Limits',help='Max concurrently served connections per server (0 is unlimited).',default='0'"`
+	LimitOverload       string  `kong:"group='Limits',help='Behaviour if the max connections are reached: ${enum}',enum='stop,queue,reset,reject',default='stop'"`
+	LimitQueueSize      int     `kong:"group='Limits',help='Accepted connections waiting for a free slot in the queue overload mode.',default='100'"`
+	LimitAcceptRate     float64 `kong:"group='Limits',help='Accepted connections per second (0 is unlimited).',default='0'"`
+	LimitListenBacklog  int     `kong:"group='Limits',help='Backlog of the listen sockets (0 uses the default of the os).',default='0'"`
+}
+
+func (r *LimitFlags) limits() server.Limits {
+	return server.Limits{
+		MaxConnections: r.LimitMaxConnections,
+		Overload:       r.LimitOverload,
+		QueueSize:      r.LimitQueueSize,
+		AcceptRate:     r.LimitAcceptRate,
+		Backlog:        r.LimitListenBacklog,
+	}
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/marsom/serverbin/internal/loadtest"
+)
+
+type LoadtestCmd struct {
+	Target         string        `kong:"arg,help='Target url, i.e. http://localhost:8080/, https://..., tcp://localhost:8080, tls://... or udp://...'"`
+	Requests       int           `kong:"short='n',help='Number of requests.',default='100'"`
+	Concurrency    int           `kong:"short='c',help='Number of concurrent sessions, each session is a client with its own connections and cookies.',default='10'"`
+	KeepAlive      bool          `kong:"help='Enable/Disable keep-alive connections.',default='true'"`
+	Cookies        bool          `kong:"help='Keep cookies per session to test session affinity.',default='true'"`
+	Timeout        time.Duration `kong:"help='Timeout of a request.',default='10s'"`
+	InstanceHeader string        `kong:"help='Response header with the instance id, the response body is used if missing.',default='X-Serverbin-Instance'"`
+	Insecure       bool          `kong:"help='Skip the verification of tls certificates.',default='false'"`
+	Payload        string        `kong:"help='Payload of tcp, tls and udp requests.',default='serverbin'"`
+	TraceContext   string        `kong:"help='Send a new trace context with each http request (w3c, b3, b3-multi).',enum=',w3c,b3,b3-multi',default=''"`
+	Output         string        `kong:"help='Output format (text, json).',enum='text,json',default='text'"`
+}
+
+func (cmd *LoadtestCmd) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := loadtest.Run(ctx, loadtest.Config{
+		Target:         cmd.Target,
+		Requests:       cmd.Requests,
+		Concurrency:    cmd.Concurrency,
+		KeepAlive:      cmd.KeepAlive,
+		Cookies:        cmd.Cookies,
+		Timeout:        cmd.Timeout,
+		InstanceHeader: cmd.InstanceHeader,
+		Insecure:       cmd.Insecure,
+		Payload:        []byte(cmd.Payload),
+		TraceContext:   cmd.TraceContext,
+	})
+	if report == nil {
+		return err
+	}
+
+	// report the finished requests if interrupted
+	if cmd.Output == "json" {
+		if err := report.WriteJSON(os.Stdout); err != nil {
+			return err
+		}
+	} else if err := report.WriteText(os.Stdout); err != nil {
+		return err
+	}
+
+	return err
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/marsom/serverbin/internal/httphandler"
+	"github.com/marsom/serverbin/internal/logging"
+)
+
+// AccessLogFlags configure the access log of the test servers
+type AccessLogFlags struct {
+	AccessLog string `kong:"group='Logging',help='Access log format of the test servers: ${enum}',enum='none,json,common,combined',default='none'"`
+}
+
+func (r *AccessLogFlags) accessLog() (*logging.AccessLog, error) {
+	return logging.NewAccessLog(os.Stdout, r.AccessLog)
+}
+
+// accessHandler logs all requests with the client ip resolved with the trusted addresses of the context and returns the
+// request id, requests outside of the contexts use the fallback
+func accessHandler(access *logging.AccessLog, name string, configs []httphandler.Config, fallback httphandler.Server, next http.Handler) http.Handler {
+	return access.Handler(name, func(r *http.Request) string {
+		server := fallback
+		if c, ok := contextConfig(configs, r.URL.Path); ok {
+			server = c.Server
+		}
+
+		return httphandler.ClientIP(server, r)
+	}, next)
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/marsom/serverbin/internal/config"
+)
+
+// ReadFlags configure how the tcp and tls servers read the payload of a connection and write the response
+type ReadFlags struct {
+	ReadStrategy     string        `kong:"group='Read',help='Read strategy of the payload: ${enum}',enum='single,idle,delimiter,length,half-close',default='single'"`
+	ReadTimeout      time.Duration `kong:"group='Read',help='Timeout to read the payload of a connection, 0 disables the timeout.',default='30s'"`
+	ReadWriteTimeout time.Duration `kong:"group='Read',help='Timeout to write the response of a connection, slow writes included, 0 disables the timeout.',default='30s'"`
+	ReadIdleTimeout  time.Duration `kong:"group='Read',help='Timeout between two reads, ends the payload of the idle strategy.',default='500ms'"`
+	ReadDelimiter    string        `kong:"group='Read',help='Delimiter of the delimiter strategy, escape sequences like \\r\\n are supported.',default='\\n'"`
+	ReadLengthBytes  int           `kong:"group='Read',help='Size of the big endian length prefix of the length strategy: ${enum}',enum='1,2,4',default='2'"`
+}
+
+func (r *ReadFlags) read() (config.Read, error) {
+	delimiter, err := strconv.Unquote(`"` + r.ReadDelimiter + `"`)
+	if err != nil {
+		return config.Read{}, fmt.Errorf("invalid read delimiter %q: %w", r.ReadDelimiter, err)
+	}
+
+	return config.Read{
+		Strategy:     r.ReadStrategy,
+		Timeout:      &r.ReadTimeout,
+		WriteTimeout: &r.ReadWriteTimeout,
+		IdleTimeout:  &r.ReadIdleTimeout,
+		Delimiter:    delimiter,
+		LengthBytes:  r.ReadLengthBytes,
+	}, nil
+}
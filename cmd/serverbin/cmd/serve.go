@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/marsom/serverbin/internal/config"
+	"github.com/marsom/serverbin/internal/core"
+	"github.com/marsom/serverbin/internal/httphandler"
+	"github.com/marsom/serverbin/internal/logging"
+	"github.com/marsom/serverbin/internal/metrics"
+	"github.com/marsom/serverbin/internal/server"
+	"github.com/marsom/serverbin/internal/tcp"
+	"github.com/marsom/serverbin/internal/tracing"
+)
+
+type ServeCmd struct {
+	Config            string `kong:"help='Configuration file (yaml or json) with the listeners and contexts.',type='existingfile',required"`
+	ManagementAddress string `kong:"help='Readiness, liveness and metric listen address, the configuration file takes precedence.',default=':8081'"`
+
+	ContextFlags
+	HttpServerFlags
+	IdentityFlags
+	AccessLogFlags
+	TracingFlags
+	ReadFlags
+	LimitFlags
+
+	// server
+	ServerSocketMode              string        `kong:"group='Server',help='File permissions of unix domain sockets.',default='0666'"`
+	MaxBufferSize                 int64         `kong:"group='Server',help='Max buffer size in bytes of tcp, tls and udp listeners.',default='1024'"`
+	ServerShutdownDelay           time.Duration `kong:"group='Server',help='Delay shutdown and let a load balancer remove traffic from this backend.',default='2s'"`
+	ServerGracefulShutdownTimeout time.Duration `kong:"group='Server',help='Graceful shutdown time, active connections are closed immediately with 0.',default='2m'"`
+
+	// fault
+	FaultMaxDelay time.Duration `kong:"group='Fault',help='Max delay of an in-band fault command of tcp and tls listeners, 0 allows no delay.',default='1m'"`
+}
+
+func (r *ServeCmd) Run(info BuildInfo) error {
+	file, err := config.Load(r.Config)
+	if err != nil {
+		return err
+	}
+
+	read, err := r.read()
+	if err != nil {
+		return err
+	}
+
+	file.ApplyDefaults(r.defaultContext())
+	file.ApplyListenerDefaults(config.Listener{
+		MaxBufferSize:    r.MaxBufferSize,
+		TrustedAddresses: r.defaultContext().TrustedAddresses,
+		Read:             read,
+		Fault:            &config.Fault{MaxDelay: &r.FaultMaxDelay},
+	})
+
+	if file.Management == nil {
+		file.Management = &config.Management{
+			Address: r.ManagementAddress,
+		}
+	}
+
+	if err := file.ValidateServe(); err != nil {
+		return err
+	}
+
+	socketMode, err := parseSocketMode(r.ServerSocketMode)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	identity, err := r.identity(info)
+	if err != nil {
+		return err
+	}
+
+	m, synthetic, err := newMetrics()
+	if err != nil {
+		return err
+	}
+
+	access, err := r.accessLog()
+	if err != nil {
+		return err
+	}
+
+	tracer := r.tracer(info, identity)
+
+	readinessHandler, readinessOn, readinessOff := core.StateHandler()
+	livenessHandler, livenessOn, _ := core.StateHandler()
+	livenessOn()
+
+	cors := r.corsPolicy()
+	attempts := httphandler.NewAttempts()
+
+	// the management api uses the cors policies of the contexts of the file
+	var managementConfigs []httphandler.Config
+	for _, c := range file.Contexts {
+		managementConfigs = append(managementConfigs, c.Handler(httphandler.Server{}))
+	}
+
+	managementMux := http.NewServeMux()
+	registerManagementHandlers(managementMux, managementConfigs, cors, synthetic, attempts, readinessHandler, livenessHandler)
+
+	services := tracingServices(tracer)
+	services = append(services, &server.HttpServer{
+		Name:                    "management",
+		Address:                 file.Management.Address,
+		SocketMode:              socketMode,
+		GracefulShutdownTimeout: 3 * time.Second,
+		Handler:                 managementMux,
+	})
+
+	for _, l := range file.Listeners {
+		srv, err := r.newServer(l, file.Management.Address, socketMode, cors, attempts, identity, m, access, tracer)
+		if err != nil {
+			return fmt.Errorf("listener %s: %w", l.Name, err)
+		}
+
+		services = append(services, srv)
+	}
+
+	lifecycle := server.Lifecycle{
+		ShutdownDelay: r.ServerShutdownDelay,
+		ReadinessOn:   readinessOn,
+		ReadinessOff:  readinessOff,
+	}
+
+	return lifecycle.Run(ctx, services...)
+}
+
+func (r *ServeCmd) newServer(l config.Listener, managementAddress string, socketMode os.FileMode, cors *httphandler.Cors, attempts *httphandler.Attempts, identity *core.Identity, m *metrics.Metrics, access *logging.AccessLog, tracer *tracing.Tracer) (server.Service, error) {
+	name := l.Protocol + "/" + l.Name
+
+	switch l.Protocol {
+	case config.ProtocolHTTP, config.ProtocolHTTPS:
+		baseUrl, err := findBaseUrl(l.Protocol, l.Address)
+		if err != nil {
+			return nil, err
+		}
+
+		managementBaseUrl, err := findBaseUrl("http", managementAddress)
+		if err != nil {
+			return nil, err
+		}
+
+		var configs []httphandler.Config
+		for _, c := range l.Contexts {
+			configs = append(configs, c.Handler(httphandler.Server{
+				BaseUrl:           baseUrl,
+				ManagementBaseUrl: managementBaseUrl,
+				Identity:          identity,
+				Metrics:           m,
+				Tracer:            tracer,
+				Attempts:          attempts,
+			}))
+		}
+
+		srv := &server.HttpServer{
+			Name:                    name,
+			Address:                 l.Address,
+			SocketMode:              socketMode,
+			GracefulShutdownTimeout: r.ServerGracefulShutdownTimeout,
+			Handler:                 accessHandler(access, name, configs, r.defaultServer(config.IPNets(l.TrustedAddresses)), tracer.Handler(name, r.identityHandler(identity, newApiMux(cors, configs)))),
+			Connection:              r.connection(),
+			Limits:                  r.limits(),
+		}
+
+		if l.Protocol == config.ProtocolHTTPS {
+			tlsConfig, err := listenerTLSConfig(l)
+			if err != nil {
+				return nil, err
+			}
+
+			srv.TLSConfig = tlsConfig
+		}
+
+		return srv, nil
+	case config.ProtocolTCP, config.ProtocolTLS:
+		srv := &server.TcpServer{
+			Name:                    name,
+			Address:                 l.Address,
+			SocketMode:              socketMode,
+			GracefulShutdownTimeout: r.ServerGracefulShutdownTimeout,
+			Limits:                  r.limits(),
+			RequestHandler:          tcp.NewRequestHandler(listenerTcpConfig(l, identity, m, access)),
+		}
+
+		if l.Protocol == config.ProtocolTLS {
+			tlsConfig, err := listenerTLSConfig(l)
+			if err != nil {
+				return nil, err
+			}
+
+			srv.TLSConfig = tlsConfig
+		}
+
+		return srv, nil
+	case config.ProtocolUDP:
+		return &server.UdpServer{
+			Name:                    name,
+			Address:                 l.Address,
+			GracefulShutdownTimeout: r.ServerGracefulShutdownTimeout,
+			PacketHandler:           tcp.NewPacketHandler(listenerTcpConfig(l, identity, m, access)),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported protocol %q", l.Protocol)
+	}
+}
+
+func listenerTcpConfig(l config.Listener, identity *core.Identity, m *metrics.Metrics, access *logging.AccessLog) tcp.Config {
+	return tcp.Config{
+		Server: tcp.Server{
+			Name:             l.Name,
+			MaxBufferSize:    l.MaxBufferSize,
+			TrustedAddresses: config.IPNets(l.TrustedAddresses),
+			Identity:         identity,
+			Metrics:          m,
+			AccessLog:        access,
+			Read:             l.Read.Tcp(),
+		},
+		Fault: l.Fault.Tcp(),
+	}
+}
+
+func listenerTLSConfig(l config.Listener) (*tls.Config, error) {
+	if l.TLS == nil {
+		return server.TLSConfig("", "")
+	}
+
+	return server.TLSConfig(l.TLS.Cert, l.TLS.Key)
+}
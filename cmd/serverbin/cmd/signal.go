@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// signalContext is canceled on SIGINT and SIGTERM. On SIGHUP and SIGUSR2 the listeners are passed to a new process
+// before the context is canceled (not supported on windows).
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(ctx)
+
+	handleRestart(ctx, cancel)
+
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
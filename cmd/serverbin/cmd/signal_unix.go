@@ -0,0 +1,43 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/marsom/serverbin/internal/logging"
+	"github.com/marsom/serverbin/internal/server"
+)
+
+func handleRestart(ctx context.Context, cancel context.CancelFunc) {
+	restart := make(chan os.Signal, 1)
+	signal.Notify(restart, syscall.SIGHUP, syscall.SIGUSR2)
+
+	go func() {
+		defer signal.Stop(restart)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-restart:
+				logging.Info("restart requested", logging.F("signal", sig))
+
+				process, err := server.Reexec()
+				if err != nil {
+					logging.Error("restart failed", logging.F("error", err))
+					continue
+				}
+
+				logging.Info("restarted process, stopping current process", logging.F("pid", process.Pid))
+				cancel()
+
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package cmd
+
+import (
+	"context"
+)
+
+func handleRestart(ctx context.Context, cancel context.CancelFunc) {
+}
@@ -1,77 +1,145 @@
 package cmd
 
 import (
-	"context"
 	"errors"
-	"log"
 	"net"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 	"time"
 
 	"github.com/marsom/serverbin/internal/core"
 	"github.com/marsom/serverbin/internal/server"
 	"github.com/marsom/serverbin/internal/tcp"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type TcpCmd struct {
 	Address           string `kong:"help='Listen address.',default=':8080'"`
 	ManagementAddress string `kong:"help='Readiness, liveness and metric listen address.',default=':8081'"`
 
+	IdentityFlags
+	AccessLogFlags
+	ReadFlags
+	LimitFlags
+
 	// server
+	ServerSocketMode              string        `kong:"group='Server',help='File permissions of unix domain sockets.',default='0666'"`
 	MaxBufferSize                 int64         `kong:"group='Server',help='Max buffer size in bytes.',default='1024'"`
 	ServerTrustedAddresses        []*net.IPNet  `kong:"group='Server',help='Trusted addresses that are known to send correct headers.',default='0.0.0.0/0,::0/0'"`
 	ServerShutdownDelay           time.Duration `kong:"group='Server',help='Delay shutdown and let a load balancer remove traffic from this backend.',default='2s'"`
-	ServerGracefulShutdownTimeout time.Duration `kong:"group='Server',help='Graceful shutdown time.',default='2m'"`
+	ServerGracefulShutdownTimeout time.Duration `kong:"group='Server',help='Graceful shutdown time, active connections are closed immediately with 0.',default='2m'"`
+
+	// fault
+	FaultAction   string        `kong:"group='Fault',help='Fault of each connection: ${enum}',enum='none,reset,close,half-close,no-read',default='none'"`
+	FaultDelay    time.Duration `kong:"group='Fault',help='Delay before the response or the fault action.',default='0s'"`
+	FaultRate     int           `kong:"group='Fault',help='Write the response slowly with the number of bytes per second, 0 writes at once.',default='0'"`
+	FaultDropRate float64       `kong:"group='Fault',help='Fraction of connections which are closed right after accept.',default='0'"`
+	FaultInBand   bool          `kong:"group='Fault',help='Enable/Disable the in-band fault command line of a connection.',default='true'"`
+	FaultMaxDelay time.Duration `kong:"group='Fault',help='Max delay of an in-band fault command, 0 allows no delay.',default='1m'"`
 }
 
-func (cmd *TcpCmd) Run() error {
+func (cmd *TcpCmd) Run(info BuildInfo) error {
 	if cmd.Address == cmd.ManagementAddress {
 		return errors.New("address and management address must be different for a tcp server")
 	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	socketMode, err := parseSocketMode(cmd.ServerSocketMode)
+	if err != nil {
+		return err
+	}
+
+	identity, err := cmd.identity(info)
+	if err != nil {
+		return err
+	}
+
+	m, synthetic, err := newMetrics()
+	if err != nil {
+		return err
+	}
+
+	access, err := cmd.accessLog()
+	if err != nil {
+		return err
+	}
+
+	read, err := cmd.read()
+	if err != nil {
+		return err
+	}
+
+	if errs := read.Validate("read-"); len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+
+	fault, err := cmd.fault(read.Tcp())
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signalContext()
 	defer stop()
 
-	readinessHandler, readinessOn, _ := core.StateHandler()
+	readinessHandler, readinessOn, readinessOff := core.StateHandler()
 	livenessHandler, livenessOn, _ := core.StateHandler()
 	livenessOn()
-	readinessOn()
-
-	srv := &server.TcpServer{
-		Name:                    "tcp",
-		Address:                 cmd.Address,
-		ShutdownDelay:           cmd.ServerShutdownDelay,
-		GracefulShutdownTimeout: cmd.ServerGracefulShutdownTimeout,
-		RequestHandler: tcp.NewRequestHandler(tcp.Config{
-			Server: tcp.Server{
-				MaxBufferSize:    cmd.MaxBufferSize,
-				TrustedAddresses: cmd.ServerTrustedAddresses,
-			},
-		}),
-	}
 
-	go func() {
-		managementMux := http.NewServeMux()
-		managementMux.Handle("/-/metrics", promhttp.Handler())
-		managementMux.HandleFunc("/-/readiness", readinessHandler)
-		managementMux.HandleFunc("/-/liveness", livenessHandler)
+	managementMux := http.NewServeMux()
+	registerManagementHandlers(managementMux, nil, nil, synthetic, nil, readinessHandler, livenessHandler)
+
+	lifecycle := server.Lifecycle{
+		ShutdownDelay: cmd.ServerShutdownDelay,
+		ReadinessOn:   readinessOn,
+		ReadinessOff:  readinessOff,
+	}
 
-		srv := server.HttpServer{
+	return lifecycle.Run(ctx,
+		&server.HttpServer{
 			Name:                    "management",
 			Address:                 cmd.ManagementAddress,
-			ShutdownDelay:           0 * time.Second,
+			SocketMode:              socketMode,
 			GracefulShutdownTimeout: 10 * time.Second,
 			Handler:                 managementMux,
-		}
+		},
+		&server.TcpServer{
+			Name:                    "tcp",
+			Address:                 cmd.Address,
+			SocketMode:              socketMode,
+			GracefulShutdownTimeout: cmd.ServerGracefulShutdownTimeout,
+			Limits:                  cmd.limits(),
+			RequestHandler: tcp.NewRequestHandler(tcp.Config{
+				Server: tcp.Server{
+					Name:             "tcp",
+					MaxBufferSize:    cmd.MaxBufferSize,
+					TrustedAddresses: cmd.ServerTrustedAddresses,
+					Identity:         identity,
+					Metrics:          m,
+					AccessLog:        access,
+					Read:             read.Tcp(),
+				},
+				Fault: fault,
+			}),
+		},
+	)
+}
 
-		if err := srv.ListenAndServe(ctx); err != nil {
-			log.Fatalf("managemnt server failed: %s", err)
-		}
-	}()
+func (cmd *TcpCmd) fault(read tcp.Read) (*tcp.Fault, error) {
+	switch {
+	case cmd.FaultDelay < 0:
+		return nil, errors.New("fault-delay must not be negative")
+	case cmd.FaultRate < 0:
+		return nil, errors.New("fault-rate must not be negative")
+	case cmd.FaultDropRate < 0 || cmd.FaultDropRate > 1:
+		return nil, errors.New("fault-drop-rate must be between 0 and 1")
+	case cmd.FaultAction == tcp.FaultNoRead && read.Timeout <= 0:
+		return nil, errors.New("fault-action no-read requires a read-timeout")
+	}
 
-	return srv.ListenAndServe(ctx)
+	return &tcp.Fault{
+		Action:   cmd.FaultAction,
+		Delay:    cmd.FaultDelay,
+		Rate:     cmd.FaultRate,
+		DropRate: cmd.FaultDropRate,
+		InBand:   cmd.FaultInBand,
+		MaxDelay: cmd.FaultMaxDelay,
+	}, nil
 }
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"github.com/marsom/serverbin/internal/core"
+	"github.com/marsom/serverbin/internal/server"
+	"github.com/marsom/serverbin/internal/tracing"
+)
+
+// TracingFlags configure the span per request and the otlp export
+type TracingFlags struct {
+	Tracing            bool              `kong:"group='Tracing',help='Create a span for each http request, the trace context of the request is continued.',default='false'"`
+	TracingEndpoint    string            `kong:"group='Tracing',help='OTLP/HTTP traces endpoint, i.e. http://localhost:4318/v1/traces. Spans are not exported if empty.'"`
+	TracingHeaders     map[string]string `kong:"group='Tracing',help='Headers of the export requests, i.e. authorization=Bearer xyz.'"`
+	TracingServiceName string            `kong:"group='Tracing',help='Service name of the spans.',default='serverbin'"`
+	TracingSampleRatio float64           `kong:"group='Tracing',help='Sample ratio of requests without a sampled parent.',default='1'"`
+	TracingPropagation string            `kong:"group='Tracing',help='Propagation format of outgoing requests: ${enum}',enum='w3c,b3,b3-multi',default='w3c'"`
+}
+
+func (r *TracingFlags) tracer(info BuildInfo, identity *core.Identity) *tracing.Tracer {
+	if !r.Tracing {
+		return nil
+	}
+
+	config := tracing.Config{
+		Endpoint:       r.TracingEndpoint,
+		Headers:        r.TracingHeaders,
+		ServiceName:    r.TracingServiceName,
+		ServiceVersion: info.Version,
+		SampleRatio:    r.TracingSampleRatio,
+		Propagation:    r.TracingPropagation,
+	}
+
+	if identity != nil {
+		config.InstanceID = identity.InstanceID
+	}
+
+	return tracing.New(config)
+}
+
+// tracingServices returns the exporter of the tracer as first service, it is stopped last to export all spans
+func tracingServices(tracer *tracing.Tracer) []server.Service {
+	if tracer == nil {
+		return nil
+	}
+
+	return []server.Service{tracer}
+}
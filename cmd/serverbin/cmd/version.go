@@ -1,5 +1,12 @@
 package cmd
 
+// BuildInfo is set on build and bound to the commands
+type BuildInfo struct {
+	Version string
+	Commit  string
+	Date    string
+}
+
 type VersionCmd struct {
 }
 
@@ -4,12 +4,13 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"os"
 	"reflect"
 	"runtime"
-	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/marsom/serverbin/cmd/serverbin/cmd"
+	"github.com/marsom/serverbin/internal/logging"
 )
 
 //nolint:gochecknoglobals //this vars are set on build by goreleaser
@@ -19,23 +20,21 @@ var (
 	date    = "2020-09-23T07:03:55+02:00"
 )
 
-type logWriter struct {
-}
-
-func (l logWriter) Write(p []byte) (n int, err error) {
-	return fmt.Print(time.Now().Format("2006-01-02T15:04:05.000Z07:00") + " " + string(p))
-}
-
-// make log statements with meaningful timestamps
+// route log statements of the standard log package to the structured logger
 func init() {
 	log.SetFlags(0)
-	log.SetOutput(new(logWriter))
+	log.SetOutput(logging.Default().Writer(logging.LevelError))
 }
 
 var cli struct {
-	HttpCmd    cmd.HttpCmd `kong:"cmd,name='http',help='Start a HTTP test server'"`
-	TcpCmd     cmd.TcpCmd  `kong:"cmd,name='tcp',help='Start a TCP test server'"`
-	VersionCmd versionCmd  `kong:"cmd,name='version',help='Print version information'"`
+	LogLevel  string `kong:"group='Logging',name='log-level',default='info',enum='debug,info,warn,error',help='Minimal level of log messages: ${enum}'"`
+	LogFormat string `kong:"group='Logging',name='log-format',default='text',enum='text,json',help='Format of log messages: ${enum}'"`
+
+	HttpCmd     cmd.HttpCmd     `kong:"cmd,name='http',help='Start a HTTP test server'"`
+	TcpCmd      cmd.TcpCmd      `kong:"cmd,name='tcp',help='Start a TCP test server'"`
+	ServeCmd    cmd.ServeCmd    `kong:"cmd,name='serve',help='Start multiple HTTP, HTTPS, TCP, TLS and UDP test servers from a configuration file'"`
+	LoadtestCmd cmd.LoadtestCmd `kong:"cmd,name='loadtest',aliases='probe',help='Send requests to serverbin instances and report the distribution across instances'"`
+	VersionCmd  versionCmd      `kong:"cmd,name='version',help='Print version information'"`
 }
 
 func main() {
@@ -43,7 +42,18 @@ func main() {
 		&cli,
 		kong.TypeMapper(reflect.TypeOf(&net.IPNet{}), ipnetMapper()),
 	)
-	ctx.FatalIfErrorf(ctx.Run())
+
+	level, err := logging.ParseLevel(cli.LogLevel)
+	ctx.FatalIfErrorf(err)
+
+	logging.SetDefault(logging.New(os.Stdout, level, cli.LogFormat))
+	log.SetOutput(logging.Default().Writer(logging.LevelError))
+
+	ctx.FatalIfErrorf(ctx.Run(cmd.BuildInfo{
+		Version: version,
+		Commit:  commit,
+		Date:    date,
+	}))
 }
 
 func ipnetMapper() kong.MapperFunc {
@@ -0,0 +1,873 @@
+// Package config provides the file based configuration of serverbin.
+// YAML and JSON files are supported.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/marsom/serverbin/internal/forwarded"
+	"github.com/marsom/serverbin/internal/httphandler"
+	"github.com/marsom/serverbin/internal/tcp"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported listener protocols
+const (
+	ProtocolHTTP  = "http"
+	ProtocolHTTPS = "https"
+	ProtocolTCP   = "tcp"
+	ProtocolTLS   = "tls"
+	ProtocolUDP   = "udp"
+)
+
+// File is the root of a configuration file
+type File struct {
+	Management *Management `yaml:"management"`
+	Contexts   []Context   `yaml:"contexts"`
+	Listeners  []Listener  `yaml:"listeners"`
+}
+
+// Management configures the management server shared by all listeners
+type Management struct {
+	Address string `yaml:"address"`
+}
+
+// Listener configures a server of the serve command
+type Listener struct {
+	Name     string `yaml:"name"`
+	Protocol string `yaml:"protocol"`
+	Address  string `yaml:"address"`
+	TLS      *TLS   `yaml:"tls"`
+
+	// http and https, defaults to the contexts of the file
+	Contexts []Context `yaml:"contexts"`
+
+	// tcp, tls and udp
+	MaxBufferSize    int64   `yaml:"max-buffer-size"`
+	TrustedAddresses []IPNet `yaml:"trusted-addresses"`
+
+	// tcp and tls
+	Read  Read   `yaml:"read"`
+	Fault *Fault `yaml:"fault"`
+}
+
+// Read configures how tcp and tls listeners read the payload of a connection and write the response, a timeout of 0
+// disables it
+type Read struct {
+	Strategy     string         `yaml:"strategy"`
+	Timeout      *time.Duration `yaml:"timeout"`
+	WriteTimeout *time.Duration `yaml:"write-timeout"`
+	IdleTimeout  *time.Duration `yaml:"idle-timeout"`
+	Delimiter    string         `yaml:"delimiter"`
+	LengthBytes  int            `yaml:"length-bytes"`
+}
+
+// Fault injects errors into the connections of tcp and tls listeners
+type Fault struct {
+	Action   string         `yaml:"action"`
+	Delay    time.Duration  `yaml:"delay"`
+	Rate     int            `yaml:"rate"`
+	DropRate float64        `yaml:"drop-rate"`
+	InBand   bool           `yaml:"in-band"`
+	MaxDelay *time.Duration `yaml:"max-delay"`
+}
+
+// TLS certificate and key files, a self-signed certificate is used if not set
+type TLS struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+}
+
+func (l Listener) isHTTP() bool {
+	return l.Protocol == ProtocolHTTP || l.Protocol == ProtocolHTTPS
+}
+
+// Context configures the api on a path
+type Context struct {
+	Path             string     `yaml:"path"`
+	MaxRequestBody   int64      `yaml:"max-request-body"`
+	TrustedAddresses []IPNet    `yaml:"trusted-addresses"`
+	ForwardedHeaders []string   `yaml:"forwarded-headers"`
+	Cookie           *Cookie    `yaml:"cookie"`
+	Delay            *Delay     `yaml:"delay"`
+	Slow             *Slow      `yaml:"slow"`
+	Redirect         *Redirect  `yaml:"redirect"`
+	Cors             *Cors      `yaml:"cors"`
+	Proxy            *Proxy     `yaml:"proxy"`
+	RateLimit        *RateLimit `yaml:"ratelimit"`
+	Flaky            *Flaky     `yaml:"flaky"`
+	Store            *Store     `yaml:"store"`
+	Responses        []Response `yaml:"responses"`
+}
+
+// Cookie enables the cookie handler
+type Cookie struct {
+	Names    []string `yaml:"names"`
+	HttpOnly bool     `yaml:"http-only"`
+	Secure   bool     `yaml:"secure"`
+}
+
+// Delay enables the delay handler
+type Delay struct {
+	Max time.Duration `yaml:"max"`
+}
+
+// Slow enables the slow handler
+type Slow struct {
+	Max time.Duration `yaml:"max"`
+}
+
+// Redirect enables the redirect handlers
+type Redirect struct {
+	Max uint `yaml:"max"`
+}
+
+// Proxy enables the proxy and chain handlers
+type Proxy struct {
+	AllowedHosts []string      `yaml:"allowed-hosts"`
+	MaxHops      int           `yaml:"max-hops"`
+	Timeout      time.Duration `yaml:"timeout"`
+	Insecure     bool          `yaml:"insecure"`
+}
+
+// RateLimit enables the ratelimit handler and limits all requests of the context if the limit is greater than 0
+type RateLimit struct {
+	Limit      *int          `yaml:"limit"`
+	Window     time.Duration `yaml:"window"`
+	Key        string        `yaml:"key"`
+	Header     string        `yaml:"header"`
+	MaxWindow  time.Duration `yaml:"max-window"`
+	MaxBuckets int           `yaml:"max-buckets"`
+}
+
+// Flaky enables the flaky, sequence and percent handlers
+type Flaky struct {
+	MaxKeys int `yaml:"max-keys"`
+}
+
+// Store enables the store handler
+type Store struct {
+	MaxKeys int `yaml:"max-keys"`
+}
+
+// Cors enables a cors policy
+type Cors struct {
+	AllowedOrigins   []string       `yaml:"allowed-origins"`
+	AllowedMethods   []string       `yaml:"allowed-methods"`
+	AllowedHeaders   []string       `yaml:"allowed-headers"`
+	ExposeHeaders    []string       `yaml:"expose-headers"`
+	AllowCredentials bool           `yaml:"allow-credentials"`
+	MaxAge           *time.Duration `yaml:"max-age"`
+}
+
+// Response rule overrides the response of matching requests
+type Response struct {
+	Path    string            `yaml:"path"`
+	Methods []string          `yaml:"methods"`
+	Status  int               `yaml:"status"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// IPNet is a network in CIDR notation, i.e. 10.0.0.0/8
+type IPNet struct {
+	*net.IPNet
+}
+
+func (n *IPNet) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		return fmt.Errorf("line %d: expected ipnet but got %q", value.Line, s)
+	}
+
+	n.IPNet = ipnet
+
+	return nil
+}
+
+// IPNets converts the networks for the handler configurations
+func IPNets(networks []IPNet) []*net.IPNet {
+	var result []*net.IPNet
+
+	for _, n := range networks {
+		result = append(result, n.IPNet)
+	}
+
+	return result
+}
+
+// Load reads and validates a configuration file
+func Load(filename string) (*File, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	return f, nil
+}
+
+// Parse decodes a configuration, unknown fields are rejected
+func Parse(r io.Reader) (*File, error) {
+	f := &File{}
+
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(f); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// ApplyDefaults sets all limits which are not configured in a context, optional values of 0 are kept
+func (f *File) ApplyDefaults(defaults Context) {
+	applyContextDefaults(f.Contexts, defaults)
+
+	for i := range f.Listeners {
+		l := &f.Listeners[i]
+
+		if l.isHTTP() && len(l.Contexts) == 0 {
+			l.Contexts = append([]Context(nil), f.Contexts...)
+		}
+
+		applyContextDefaults(l.Contexts, defaults)
+	}
+}
+
+// ApplyListenerDefaults sets all tcp, tls and udp limits which are not configured in a listener
+func (f *File) ApplyListenerDefaults(defaults Listener) {
+	for i := range f.Listeners {
+		l := &f.Listeners[i]
+
+		if l.MaxBufferSize == 0 {
+			l.MaxBufferSize = defaults.MaxBufferSize
+		}
+
+		if l.TrustedAddresses == nil {
+			l.TrustedAddresses = defaults.TrustedAddresses
+		}
+
+		if l.Read.Strategy == "" {
+			l.Read.Strategy = defaults.Read.Strategy
+		}
+
+		if l.Read.Timeout == nil {
+			l.Read.Timeout = defaults.Read.Timeout
+		}
+
+		if l.Read.WriteTimeout == nil {
+			l.Read.WriteTimeout = defaults.Read.WriteTimeout
+		}
+
+		if l.Read.IdleTimeout == nil {
+			l.Read.IdleTimeout = defaults.Read.IdleTimeout
+		}
+
+		if l.Read.Delimiter == "" {
+			l.Read.Delimiter = defaults.Read.Delimiter
+		}
+
+		if l.Read.LengthBytes == 0 {
+			l.Read.LengthBytes = defaults.Read.LengthBytes
+		}
+
+		if l.Fault != nil && l.Fault.MaxDelay == nil && defaults.Fault != nil {
+			l.Fault.MaxDelay = defaults.Fault.MaxDelay
+		}
+	}
+}
+
+func applyContextDefaults(contexts []Context, defaults Context) {
+	for i := range contexts {
+		c := &contexts[i]
+
+		if c.MaxRequestBody == 0 {
+			c.MaxRequestBody = defaults.MaxRequestBody
+		}
+
+		if c.TrustedAddresses == nil {
+			c.TrustedAddresses = defaults.TrustedAddresses
+		}
+
+		if c.ForwardedHeaders == nil {
+			c.ForwardedHeaders = defaults.ForwardedHeaders
+		}
+
+		if c.Cookie != nil && len(c.Cookie.Names) == 0 && defaults.Cookie != nil {
+			c.Cookie.Names = defaults.Cookie.Names
+		}
+
+		if c.Delay != nil && c.Delay.Max == 0 && defaults.Delay != nil {
+			c.Delay.Max = defaults.Delay.Max
+		}
+
+		if c.Slow != nil && c.Slow.Max == 0 && defaults.Slow != nil {
+			c.Slow.Max = defaults.Slow.Max
+		}
+
+		if c.Redirect != nil && c.Redirect.Max == 0 && defaults.Redirect != nil {
+			c.Redirect.Max = defaults.Redirect.Max
+		}
+
+		if c.Proxy != nil && defaults.Proxy != nil {
+			if len(c.Proxy.AllowedHosts) == 0 {
+				c.Proxy.AllowedHosts = defaults.Proxy.AllowedHosts
+			}
+
+			if c.Proxy.MaxHops == 0 {
+				c.Proxy.MaxHops = defaults.Proxy.MaxHops
+			}
+
+			if c.Proxy.Timeout == 0 {
+				c.Proxy.Timeout = defaults.Proxy.Timeout
+			}
+		}
+
+		if c.RateLimit != nil && defaults.RateLimit != nil {
+			if c.RateLimit.Limit == nil {
+				c.RateLimit.Limit = defaults.RateLimit.Limit
+			}
+
+			if c.RateLimit.Window == 0 {
+				c.RateLimit.Window = defaults.RateLimit.Window
+			}
+
+			if c.RateLimit.Key == "" {
+				c.RateLimit.Key = defaults.RateLimit.Key
+			}
+
+			if c.RateLimit.Header == "" {
+				c.RateLimit.Header = defaults.RateLimit.Header
+			}
+
+			if c.RateLimit.MaxWindow == 0 {
+				c.RateLimit.MaxWindow = defaults.RateLimit.MaxWindow
+			}
+
+			if c.RateLimit.MaxBuckets == 0 {
+				c.RateLimit.MaxBuckets = defaults.RateLimit.MaxBuckets
+			}
+		}
+
+		if c.Flaky != nil && c.Flaky.MaxKeys == 0 && defaults.Flaky != nil {
+			c.Flaky.MaxKeys = defaults.Flaky.MaxKeys
+		}
+
+		if c.Store != nil && c.Store.MaxKeys == 0 && defaults.Store != nil {
+			c.Store.MaxKeys = defaults.Store.MaxKeys
+		}
+
+		if c.Cors != nil && defaults.Cors != nil {
+			if len(c.Cors.AllowedOrigins) == 0 {
+				c.Cors.AllowedOrigins = defaults.Cors.AllowedOrigins
+			}
+
+			if len(c.Cors.AllowedMethods) == 0 {
+				c.Cors.AllowedMethods = defaults.Cors.AllowedMethods
+			}
+
+			if len(c.Cors.AllowedHeaders) == 0 {
+				c.Cors.AllowedHeaders = defaults.Cors.AllowedHeaders
+			}
+
+			if len(c.Cors.ExposeHeaders) == 0 {
+				c.Cors.ExposeHeaders = defaults.Cors.ExposeHeaders
+			}
+
+			if c.Cors.MaxAge == nil {
+				c.Cors.MaxAge = defaults.Cors.MaxAge
+			}
+		}
+	}
+}
+
+// Validate checks the configuration of the http command and reports all found errors
+func (f *File) Validate() error {
+	errs := validateContexts("", f.Contexts)
+
+	if len(f.Listeners) > 0 {
+		errs = append(errs, "listeners: only supported by the serve command")
+	}
+
+	return newValidationError(errs)
+}
+
+// ValidateServe checks the configuration of the serve command and reports all found errors
+func (f *File) ValidateServe() error {
+	var errs []string
+
+	if len(f.Listeners) == 0 {
+		errs = append(errs, "listeners: at least one listener is required")
+	}
+
+	names := make(map[string]int)
+	addresses := make(map[string]int)
+
+	if f.Management != nil {
+		if f.Management.Address == "" {
+			errs = append(errs, "management.address: is required")
+		}
+
+		addresses[f.Management.Address] = -1
+	}
+
+	for i, l := range f.Listeners {
+		field := fmt.Sprintf("listeners[%d]", i)
+
+		if l.Name == "" {
+			errs = append(errs, field+".name: is required")
+		} else if j, ok := names[l.Name]; ok {
+			errs = append(errs, fmt.Sprintf("%s.name: %q is already used by listeners[%d]", field, l.Name, j))
+		} else {
+			names[l.Name] = i
+		}
+
+		// udp and tcp based listeners may share the same address
+		address := l.Address
+		if l.Protocol == ProtocolUDP {
+			address = "udp:" + address
+		}
+
+		if l.Address == "" {
+			errs = append(errs, field+".address: is required")
+		} else if j, ok := addresses[address]; ok {
+			if j < 0 {
+				errs = append(errs, fmt.Sprintf("%s.address: %q is already used by the management server", field, l.Address))
+			} else {
+				errs = append(errs, fmt.Sprintf("%s.address: %q is already used by listeners[%d]", field, l.Address, j))
+			}
+		} else {
+			addresses[address] = i
+		}
+
+		switch l.Protocol {
+		case ProtocolHTTP, ProtocolHTTPS:
+			errs = append(errs, validateContexts(field+".", l.Contexts)...)
+		case ProtocolTCP, ProtocolTLS, ProtocolUDP:
+			if l.Protocol == ProtocolUDP && strings.HasPrefix(l.Address, "unix:") {
+				errs = append(errs, field+".address: unix domain sockets are not supported by protocol udp")
+			}
+
+			if len(l.Contexts) > 0 {
+				errs = append(errs, fmt.Sprintf("%s.contexts: not supported by protocol %s", field, l.Protocol))
+			}
+
+			if l.MaxBufferSize <= 0 {
+				errs = append(errs, field+".max-buffer-size: must be greater than 0")
+			}
+
+			if l.Protocol != ProtocolUDP {
+				errs = append(errs, l.Read.Validate(field+".read.")...)
+			}
+
+			if l.Fault != nil {
+				if l.Protocol == ProtocolUDP {
+					errs = append(errs, fmt.Sprintf("%s.fault: not supported by protocol %s", field, l.Protocol))
+				} else {
+					errs = append(errs, l.Fault.Validate(field+".fault.", l.Read)...)
+				}
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("%s.protocol: %q must be one of http, https, tcp, tls, udp", field, l.Protocol))
+		}
+
+		if l.TLS != nil {
+			if l.Protocol != ProtocolHTTPS && l.Protocol != ProtocolTLS {
+				errs = append(errs, fmt.Sprintf("%s.tls: not supported by protocol %s", field, l.Protocol))
+			}
+
+			if (l.TLS.Cert == "") != (l.TLS.Key == "") {
+				errs = append(errs, field+".tls: cert and key are required together")
+			}
+		}
+	}
+
+	return newValidationError(errs)
+}
+
+func validateContexts(prefix string, contexts []Context) []string {
+	var errs []string
+
+	if len(contexts) == 0 {
+		errs = append(errs, prefix+"contexts: at least one context is required")
+	}
+
+	paths := make(map[string]int)
+
+	for i, c := range contexts {
+		field := fmt.Sprintf("%scontexts[%d]", prefix, i)
+
+		for _, err := range c.validate() {
+			errs = append(errs, field+"."+err)
+		}
+
+		if j, ok := paths[path.Clean(c.Path)]; ok {
+			errs = append(errs, fmt.Sprintf("%s.path: %q is already used by %scontexts[%d]", field, c.Path, prefix, j))
+		} else {
+			paths[path.Clean(c.Path)] = i
+		}
+	}
+
+	return errs
+}
+
+func newValidationError(errs []string) error {
+	if len(errs) > 0 {
+		return errors.New("invalid configuration:\n  " + strings.Join(errs, "\n  "))
+	}
+
+	return nil
+}
+
+func (c Context) validate() []string {
+	var errs []string
+
+	if err := ValidatePath(c.Path); err != nil {
+		errs = append(errs, "path: "+err.Error())
+	}
+
+	if c.MaxRequestBody <= 0 {
+		errs = append(errs, "max-request-body: must be greater than 0")
+	}
+
+	for i, h := range c.ForwardedHeaders {
+		switch strings.ToLower(h) {
+		case forwarded.SourceForwarded, forwarded.SourceXForwardedFor, forwarded.SourceXRealIP:
+		default:
+			errs = append(errs, fmt.Sprintf("forwarded-headers[%d]: %q must be one of forwarded, x-forwarded-for, x-real-ip", i, h))
+		}
+	}
+
+	if c.Delay != nil && c.Delay.Max <= 0 {
+		errs = append(errs, "delay.max: must be greater than 0")
+	}
+
+	if c.Slow != nil && c.Slow.Max <= 0 {
+		errs = append(errs, "slow.max: must be greater than 0")
+	}
+
+	if c.Redirect != nil && c.Redirect.Max == 0 {
+		errs = append(errs, "redirect.max: must be greater than 0")
+	}
+
+	if c.Cookie != nil && len(c.Cookie.Names) == 0 {
+		errs = append(errs, "cookie.names: at least one name is required")
+	}
+
+	if c.Proxy != nil {
+		if len(c.Proxy.AllowedHosts) == 0 {
+			errs = append(errs, "proxy.allowed-hosts: at least one host is required")
+		}
+
+		if c.Proxy.MaxHops <= 0 {
+			errs = append(errs, "proxy.max-hops: must be greater than 0")
+		}
+
+		if c.Proxy.Timeout <= 0 {
+			errs = append(errs, "proxy.timeout: must be greater than 0")
+		}
+	}
+
+	if c.RateLimit != nil {
+		errs = append(errs, c.RateLimit.validate()...)
+	}
+
+	if c.Flaky != nil && c.Flaky.MaxKeys <= 0 {
+		errs = append(errs, "flaky.max-keys: must be greater than 0")
+	}
+
+	if c.Store != nil && c.Store.MaxKeys <= 0 {
+		errs = append(errs, "store.max-keys: must be greater than 0")
+	}
+
+	if c.Cors != nil && len(c.Cors.AllowedOrigins) == 0 {
+		errs = append(errs, "cors.allowed-origins: at least one origin is required")
+	}
+
+	for i, r := range c.Responses {
+		if !strings.HasPrefix(r.Path, "/") {
+			errs = append(errs, fmt.Sprintf("responses[%d].path: must start with a /", i))
+		}
+
+		if r.Status != 0 && (r.Status < 100 || r.Status > 599) {
+			errs = append(errs, fmt.Sprintf("responses[%d].status: %d is not a valid status code", i, r.Status))
+		}
+
+		if r.Status == 0 && len(r.Headers) == 0 {
+			errs = append(errs, fmt.Sprintf("responses[%d]: status or headers are required", i))
+		}
+	}
+
+	return errs
+}
+
+// ValidatePath checks if a context path is valid
+func ValidatePath(p string) error {
+	if !strings.HasPrefix(p, "/") {
+		return fmt.Errorf("%q must start with a /", p)
+	}
+
+	if strings.ContainsAny(p, "?#* ") {
+		return fmt.Errorf("%q must not contain any of '?#* '", p)
+	}
+
+	if path.Clean(p) != strings.TrimSuffix(p, "/") && p != "/" {
+		return fmt.Errorf("%q is not a clean path, use %q", p, path.Clean(p))
+	}
+
+	return nil
+}
+
+func (r RateLimit) validate() []string {
+	var errs []string
+
+	if r.Limit != nil && *r.Limit < 0 {
+		errs = append(errs, "ratelimit.limit: must not be negative")
+	}
+
+	if r.Limit != nil && *r.Limit > 0 && r.Window <= 0 {
+		errs = append(errs, "ratelimit.window: must be greater than 0")
+	}
+
+	switch r.Key {
+	case httphandler.RateLimitByContext, httphandler.RateLimitByClientIP:
+	case httphandler.RateLimitByHeader:
+		if r.Header == "" {
+			errs = append(errs, "ratelimit.header: is required by key header")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("ratelimit.key: %q must be one of context, client-ip, header", r.Key))
+	}
+
+	if r.MaxWindow <= 0 {
+		errs = append(errs, "ratelimit.max-window: must be greater than 0")
+	}
+
+	if r.MaxBuckets <= 0 {
+		errs = append(errs, "ratelimit.max-buckets: must be greater than 0")
+	}
+
+	return errs
+}
+
+// Validate returns the errors of the read configuration, prefix is added to the field names
+func (r Read) Validate(prefix string) []string {
+	var errs []string
+
+	switch r.Strategy {
+	case tcp.ReadSingle, tcp.ReadIdle, tcp.ReadLength, tcp.ReadHalfClose:
+	case tcp.ReadDelimiter:
+		if r.Delimiter == "" {
+			errs = append(errs, prefix+"delimiter: is required by strategy delimiter")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("%sstrategy: %q must be one of single, idle, delimiter, length, half-close", prefix, r.Strategy))
+	}
+
+	if duration(r.Timeout) < 0 {
+		errs = append(errs, prefix+"timeout: must not be negative")
+	}
+
+	if duration(r.WriteTimeout) < 0 {
+		errs = append(errs, prefix+"write-timeout: must not be negative")
+	}
+
+	if duration(r.IdleTimeout) < 0 {
+		errs = append(errs, prefix+"idle-timeout: must not be negative")
+	}
+
+	if r.Strategy == tcp.ReadLength && r.LengthBytes != 1 && r.LengthBytes != 2 && r.LengthBytes != 4 {
+		errs = append(errs, fmt.Sprintf("%slength-bytes: %d must be one of 1, 2, 4", prefix, r.LengthBytes))
+	}
+
+	return errs
+}
+
+// Validate returns the errors of the fault configuration, prefix is added to the field names
+func (f Fault) Validate(prefix string, read Read) []string {
+	var errs []string
+
+	switch f.Action {
+	case "", tcp.FaultNone, tcp.FaultReset, tcp.FaultClose, tcp.FaultHalfClose:
+	case tcp.FaultNoRead:
+		if duration(read.Timeout) <= 0 {
+			errs = append(errs, prefix+"action: no-read requires a read.timeout")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("%saction: %q must be one of none, reset, close, half-close, no-read", prefix, f.Action))
+	}
+
+	if f.Delay < 0 {
+		errs = append(errs, prefix+"delay: must not be negative")
+	}
+
+	if f.Rate < 0 {
+		errs = append(errs, prefix+"rate: must not be negative")
+	}
+
+	if f.DropRate < 0 || f.DropRate > 1 {
+		errs = append(errs, prefix+"drop-rate: must be between 0 and 1")
+	}
+
+	if duration(f.MaxDelay) < 0 {
+		errs = append(errs, prefix+"max-delay: must not be negative")
+	}
+
+	return errs
+}
+
+// Tcp creates the fault configuration of a tcp server, nil disables faults
+func (f *Fault) Tcp() *tcp.Fault {
+	if f == nil {
+		return nil
+	}
+
+	return &tcp.Fault{
+		Action:   f.Action,
+		Delay:    f.Delay,
+		Rate:     f.Rate,
+		DropRate: f.DropRate,
+		InBand:   f.InBand,
+		MaxDelay: duration(f.MaxDelay),
+	}
+}
+
+// Tcp creates the read configuration of a tcp server
+func (r Read) Tcp() tcp.Read {
+	return tcp.Read{
+		Strategy:     r.Strategy,
+		Timeout:      duration(r.Timeout),
+		WriteTimeout: duration(r.WriteTimeout),
+		IdleTimeout:  duration(r.IdleTimeout),
+		Delimiter:    []byte(r.Delimiter),
+		LengthBytes:  r.LengthBytes,
+	}
+}
+
+// Handler creates the handler configuration of a context
+func (c Context) Handler(server httphandler.Server) httphandler.Config {
+	server.MaxRequestBody = c.MaxRequestBody
+	server.TrustedAddresses = IPNets(c.TrustedAddresses)
+	server.ForwardedHeaders = c.ForwardedHeaders
+
+	config := httphandler.Config{
+		Path:   c.Path,
+		Server: server,
+	}
+
+	if c.Cookie != nil {
+		config.Cookie = &httphandler.Cookie{
+			Names:    c.Cookie.Names,
+			HttpOnly: c.Cookie.HttpOnly,
+			Secure:   c.Cookie.Secure,
+		}
+	}
+
+	if c.Delay != nil {
+		config.Delay = &httphandler.Delay{
+			MaxDuration: c.Delay.Max,
+		}
+	}
+
+	if c.Slow != nil {
+		config.Slow = &httphandler.Slow{
+			MaxDuration: c.Slow.Max,
+		}
+	}
+
+	if c.Redirect != nil {
+		config.Redirect = &httphandler.Redirect{
+			Max: c.Redirect.Max,
+		}
+	}
+
+	if c.Proxy != nil {
+		config.Proxy = &httphandler.Proxy{
+			AllowedHosts: c.Proxy.AllowedHosts,
+			MaxHops:      c.Proxy.MaxHops,
+			Timeout:      c.Proxy.Timeout,
+			Insecure:     c.Proxy.Insecure,
+		}
+	}
+
+	if c.RateLimit != nil {
+		config.RateLimit = &httphandler.RateLimit{
+			Limit:      integer(c.RateLimit.Limit),
+			Window:     c.RateLimit.Window,
+			Key:        c.RateLimit.Key,
+			Header:     c.RateLimit.Header,
+			MaxWindow:  c.RateLimit.MaxWindow,
+			MaxBuckets: c.RateLimit.MaxBuckets,
+		}
+	}
+
+	if c.Flaky != nil {
+		config.Flaky = &httphandler.Flaky{
+			MaxKeys: c.Flaky.MaxKeys,
+		}
+	}
+
+	if c.Store != nil {
+		config.Store = &httphandler.Store{
+			MaxKeys: c.Store.MaxKeys,
+		}
+	}
+
+	if c.Cors != nil {
+		config.Cors = &httphandler.Cors{
+			AllowedOrigins:   c.Cors.AllowedOrigins,
+			AllowedMethods:   c.Cors.AllowedMethods,
+			AllowedHeaders:   c.Cors.AllowedHeaders,
+			ExposeHeaders:    c.Cors.ExposeHeaders,
+			AllowCredentials: c.Cors.AllowCredentials,
+			MaxAge:           duration(c.Cors.MaxAge),
+		}
+	}
+
+	for _, r := range c.Responses {
+		config.Rules = append(config.Rules, httphandler.Rule{
+			Path:    r.Path,
+			Methods: r.Methods,
+			Status:  r.Status,
+			Headers: r.Headers,
+		})
+	}
+
+	return config
+}
+
+// duration of an optional value, nil is 0
+func duration(d *time.Duration) time.Duration {
+	if d == nil {
+		return 0
+	}
+
+	return *d
+}
+
+// integer of an optional value, nil is 0
+func integer(i *int) int {
+	if i == nil {
+		return 0
+	}
+
+	return *i
+}
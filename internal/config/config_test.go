@@ -0,0 +1,201 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marsom/serverbin/internal/httphandler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+contexts:
+  - path: /a
+    max-request-body: 32
+    trusted-addresses:
+      - 10.0.0.0/8
+    delay:
+      max: 5s
+    redirect: {}
+    cors:
+      allowed-origins: ["https://example.com"]
+    responses:
+      - path: /status
+        methods: [GET]
+        status: 503
+        headers:
+          Retry-After: "10"
+  - path: /b
+    cookie: {}
+    cors:
+      allowed-origins: ["*"]
+      max-age: 0s
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse(strings.NewReader(testConfig))
+	require.Nil(t, err)
+
+	maxAge := time.Minute
+
+	f.ApplyDefaults(Context{
+		MaxRequestBody: 1024,
+		Cookie:         &Cookie{Names: []string{"x"}},
+		Redirect:       &Redirect{Max: 20},
+		Cors:           &Cors{AllowedMethods: []string{"GET"}, ExposeHeaders: []string{"X-Test"}, MaxAge: &maxAge},
+	})
+	require.Nil(t, f.Validate())
+
+	require.Len(t, f.Contexts, 2)
+
+	a := f.Contexts[0].Handler(httphandler.Server{})
+	assert.Equal(t, "/a", a.Path)
+	assert.Equal(t, int64(32), a.Server.MaxRequestBody)
+	assert.Equal(t, "10.0.0.0/8", a.Server.TrustedAddresses[0].String())
+	assert.Equal(t, 5*time.Second, a.Delay.MaxDuration)
+	assert.Equal(t, uint(20), a.Redirect.Max)
+	assert.Equal(t, []string{"GET"}, a.Cors.AllowedMethods)
+	assert.Equal(t, []string{"X-Test"}, a.Cors.ExposeHeaders)
+	assert.Equal(t, time.Minute, a.Cors.MaxAge)
+	assert.Nil(t, a.Cookie)
+	assert.Nil(t, a.Slow)
+	assert.Equal(t, []httphandler.Rule{{
+		Path:    "/status",
+		Methods: []string{"GET"},
+		Status:  503,
+		Headers: map[string]string{"Retry-After": "10"},
+	}}, a.Rules)
+
+	b := f.Contexts[1].Handler(httphandler.Server{})
+	assert.Equal(t, int64(1024), b.Server.MaxRequestBody)
+	assert.Equal(t, []string{"x"}, b.Cookie.Names)
+	assert.Nil(t, b.Redirect)
+
+	// a configured 0 is not replaced by the default
+	assert.Equal(t, time.Duration(0), b.Cors.MaxAge)
+}
+
+func TestParseUnknownField(t *testing.T) {
+	_, err := Parse(strings.NewReader("contexts:\n  - path: /a\n    unknown: 1\n"))
+	require.NotNil(t, err)
+}
+
+func TestParseJSON(t *testing.T) {
+	f, err := Parse(strings.NewReader(`{"contexts": [{"path": "/", "max-request-body": 10, "slow": {"max": "1m"}}]}`))
+	require.Nil(t, err)
+	require.Nil(t, f.Validate())
+	require.Equal(t, time.Minute, f.Contexts[0].Slow.Max)
+}
+
+func TestValidate(t *testing.T) {
+	limit := 10
+
+	f := &File{
+		Contexts: []Context{
+			{Path: "a", MaxRequestBody: 1},
+			{Path: "/b//c", MaxRequestBody: 1},
+			{Path: "/d", MaxRequestBody: 0, Delay: &Delay{}},
+			{Path: "/d/", MaxRequestBody: 1, Responses: []Response{{Path: "/x", Status: 42}}},
+			{Path: "/e", MaxRequestBody: 1, Proxy: &Proxy{MaxHops: 1, Timeout: time.Second}},
+			{Path: "/f", MaxRequestBody: 1, ForwardedHeaders: []string{"x-forwarded-for", "via"}},
+			{Path: "/g", MaxRequestBody: 1, RateLimit: &RateLimit{Limit: &limit, Key: "header", MaxWindow: time.Hour}},
+			{Path: "/h", MaxRequestBody: 1, Flaky: &Flaky{}},
+			{Path: "/i", MaxRequestBody: 1, Store: &Store{MaxKeys: -1}},
+		},
+	}
+
+	err := f.Validate()
+	require.NotNil(t, err)
+
+	for _, expected := range []string{
+		`contexts[0].path: "a" must start with a /`,
+		`contexts[1].path: "/b//c" is not a clean path, use "/b/c"`,
+		`contexts[2].max-request-body: must be greater than 0`,
+		`contexts[2].delay.max: must be greater than 0`,
+		`contexts[3].path: "/d/" is already used by contexts[2]`,
+		`contexts[3].responses[0].status: 42 is not a valid status code`,
+		`contexts[4].proxy.allowed-hosts: at least one host is required`,
+		`contexts[5].forwarded-headers[1]: "via" must be one of forwarded, x-forwarded-for, x-real-ip`,
+		`contexts[6].ratelimit.window: must be greater than 0`,
+		`contexts[6].ratelimit.header: is required by key header`,
+		`contexts[6].ratelimit.max-buckets: must be greater than 0`,
+		`contexts[7].flaky.max-keys: must be greater than 0`,
+		`contexts[8].store.max-keys: must be greater than 0`,
+	} {
+		assert.Contains(t, err.Error(), expected)
+	}
+}
+
+const testServeConfig = `
+management:
+  address: ":8081"
+contexts:
+  - path: /
+listeners:
+  - name: web
+    protocol: http
+    address: ":8080"
+  - name: raw
+    protocol: udp
+    address: ":8080"
+`
+
+func TestValidateServe(t *testing.T) {
+	f, err := Parse(strings.NewReader(testServeConfig))
+	require.Nil(t, err)
+
+	f.ApplyDefaults(Context{MaxRequestBody: 1024})
+	f.ApplyListenerDefaults(Listener{MaxBufferSize: 512})
+	require.Nil(t, f.ValidateServe())
+
+	assert.Equal(t, "/", f.Listeners[0].Contexts[0].Path)
+	assert.Equal(t, int64(1024), f.Listeners[0].Contexts[0].MaxRequestBody)
+	assert.Equal(t, int64(512), f.Listeners[1].MaxBufferSize)
+
+	f.Listeners = append(f.Listeners, Listener{Name: "tcp", Protocol: ProtocolTCP, Address: ":8082", Read: Read{Strategy: "idle"}, Fault: &Fault{Action: "no-read"}})
+	timeout, writeTimeout, maxDelay := time.Second, 2*time.Second, time.Minute
+
+	f.ApplyListenerDefaults(Listener{MaxBufferSize: 512, Read: Read{Strategy: "single", Timeout: &timeout, WriteTimeout: &writeTimeout, LengthBytes: 2}, Fault: &Fault{MaxDelay: &maxDelay}})
+	require.Nil(t, f.ValidateServe())
+	assert.Equal(t, Read{Strategy: "idle", Timeout: &timeout, WriteTimeout: &writeTimeout, LengthBytes: 2}, f.Listeners[2].Read)
+	assert.Equal(t, &Fault{Action: "no-read", MaxDelay: &maxDelay}, f.Listeners[2].Fault)
+	assert.Nil(t, f.Listeners[1].Fault)
+	assert.NotNil(t, f.Validate())
+
+	negative := -time.Second
+
+	f.Listeners = append(f.Listeners,
+		Listener{Name: "web", Protocol: "quic", Address: ":8081"},
+		Listener{Name: "tls", Protocol: ProtocolTCP, Address: ":8083", TLS: &TLS{Cert: "cert.pem"}, MaxBufferSize: 1},
+		Listener{Name: "read", Protocol: ProtocolTCP, Address: ":8084", MaxBufferSize: 1, Read: Read{Strategy: "delimiter", WriteTimeout: &negative, LengthBytes: 3}},
+		Listener{Name: "fault", Protocol: ProtocolTCP, Address: ":8085", MaxBufferSize: 1, Read: Read{Strategy: "single", LengthBytes: 1},
+			Fault: &Fault{Action: "no-read", DropRate: 2}},
+		Listener{Name: "udp", Protocol: ProtocolUDP, Address: ":8086", MaxBufferSize: 1, Fault: &Fault{}},
+		Listener{Name: "length", Protocol: ProtocolTCP, Address: ":8087", MaxBufferSize: 1, Read: Read{Strategy: "length", LengthBytes: 3}},
+	)
+
+	err = f.ValidateServe()
+	require.NotNil(t, err)
+
+	for _, expected := range []string{
+		`listeners[3].name: "web" is already used by listeners[0]`,
+		`listeners[3].address: ":8081" is already used by the management server`,
+		`listeners[3].protocol: "quic" must be one of http, https, tcp, tls, udp`,
+		`listeners[4].tls: not supported by protocol tcp`,
+		`listeners[4].tls: cert and key are required together`,
+		`listeners[4].read.strategy: "" must be one of single, idle, delimiter, length, half-close`,
+		`listeners[5].read.delimiter: is required by strategy delimiter`,
+		`listeners[5].read.write-timeout: must not be negative`,
+		`listeners[8].read.length-bytes: 3 must be one of 1, 2, 4`,
+		`listeners[6].fault.action: no-read requires a read.timeout`,
+		`listeners[6].fault.drop-rate: must be between 0 and 1`,
+		`listeners[7].fault: not supported by protocol udp`,
+	} {
+		assert.Contains(t, err.Error(), expected)
+	}
+
+	// the length prefix is only used by the length strategy
+	assert.NotContains(t, err.Error(), "listeners[5].read.length-bytes")
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+type connContextKey struct{}
+
+//nolint:gochecknoglobals // connection ids are unique per process
+var lastConnectionID uint64
+
+// Connection is a client connection shared by all requests of a connection
+type Connection struct {
+	net.Conn
+	ID       uint64
+	Created  time.Time
+	requests int64
+}
+
+// NextRequest counts a new request on this connection and returns the number of requests so far
+func (c *Connection) NextRequest() int64 {
+	return atomic.AddInt64(&c.requests, 1)
+}
+
+// Requests returns the number of requests on this connection
+func (c *Connection) Requests() int64 {
+	return atomic.LoadInt64(&c.requests)
+}
+
+// WithConn stores the connection of a request in the context
+func WithConn(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, &Connection{
+		Conn:    conn,
+		ID:      atomic.AddUint64(&lastConnectionID, 1),
+		Created: time.Now(),
+	})
+}
+
+// ConnFromContext returns the connection of a request
+func ConnFromContext(ctx context.Context) (net.Conn, bool) {
+	conn, ok := ConnectionFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	return conn.Conn, true
+}
+
+// ConnectionFromContext returns the shared connection of a request
+func ConnectionFromContext(ctx context.Context) (*Connection, bool) {
+	conn, ok := ctx.Value(connContextKey{}).(*Connection)
+
+	return conn, ok
+}
+
+// NetConn returns the socket of a wrapped connection, i.e. of a tls connection which implements NetConn since go 1.18
+func NetConn(conn net.Conn) net.Conn {
+	for {
+		c, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			return conn
+		}
+
+		conn = c.NetConn()
+	}
+}
+
+// PeerCredentials of a unix domain socket peer
+type PeerCredentials struct {
+	Uid uint32 `json:"uid"`
+	Gid uint32 `json:"gid"`
+	Pid int32  `json:"pid"`
+}
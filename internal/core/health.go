@@ -5,12 +5,13 @@ import (
 	"net"
 	"net/http"
 	"net/url"
-	"strings"
 	"sync/atomic"
 )
 
 func FindBaseUrl(r *http.Request, baseUrl *url.URL, trusted []*net.IPNet) (*url.URL, error) {
-	ip := net.ParseIP(strings.Split(r.RemoteAddr, ":")[0])
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+
+	ip := net.ParseIP(host)
 	if ip == nil {
 		return baseUrl, errors.New("remote ip not found")
 	}
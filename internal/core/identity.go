@@ -0,0 +1,69 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+)
+
+// Kubernetes downward api environment variables
+const (
+	EnvPodName      = "POD_NAME"
+	EnvPodNamespace = "POD_NAMESPACE"
+	EnvNodeName     = "NODE_NAME"
+	EnvZone         = "ZONE"
+)
+
+// Identity of the server instance which answered a request
+type Identity struct {
+	Hostname   string            `json:"hostname,omitempty"`
+	InstanceID string            `json:"instance-id,omitempty"`
+	Version    string            `json:"version,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Kubernetes *Kubernetes       `json:"kubernetes,omitempty"`
+}
+
+// Kubernetes is the pod information passed by the downward api
+type Kubernetes struct {
+	Pod       string `json:"pod,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Node      string `json:"node,omitempty"`
+	Zone      string `json:"zone,omitempty"`
+}
+
+// NewIdentity creates the identity of this instance, a random instance id is used if none is given
+func NewIdentity(instanceID, version string, labels map[string]string) (*Identity, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	if instanceID == "" {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		instanceID = hex.EncodeToString(b)
+	}
+
+	identity := &Identity{
+		Hostname:   hostname,
+		InstanceID: instanceID,
+		Version:    version,
+		Labels:     labels,
+	}
+
+	k8s := Kubernetes{
+		Pod:       os.Getenv(EnvPodName),
+		Namespace: os.Getenv(EnvPodNamespace),
+		Node:      os.Getenv(EnvNodeName),
+		Zone:      os.Getenv(EnvZone),
+	}
+
+	if k8s != (Kubernetes{}) {
+		identity.Kubernetes = &k8s
+	}
+
+	return identity, nil
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewIdentity(t *testing.T) {
+	require.Nil(t, os.Unsetenv(EnvPodName))
+	require.Nil(t, os.Unsetenv(EnvPodNamespace))
+	require.Nil(t, os.Unsetenv(EnvNodeName))
+	require.Nil(t, os.Unsetenv(EnvZone))
+
+	a, err := NewIdentity("", "1.0.0", nil)
+	require.Nil(t, err)
+	assert.Len(t, a.InstanceID, 16)
+	assert.NotEmpty(t, a.Hostname)
+	assert.Equal(t, "1.0.0", a.Version)
+	assert.Nil(t, a.Kubernetes)
+
+	b, err := NewIdentity("", "1.0.0", nil)
+	require.Nil(t, err)
+	assert.NotEqual(t, a.InstanceID, b.InstanceID)
+
+	require.Nil(t, os.Setenv(EnvPodName, "serverbin-0"))
+	require.Nil(t, os.Setenv(EnvZone, "zone-a"))
+
+	defer func() {
+		_ = os.Unsetenv(EnvPodName)
+		_ = os.Unsetenv(EnvZone)
+	}()
+
+	c, err := NewIdentity("instance", "1.0.0", map[string]string{"team": "a"})
+	require.Nil(t, err)
+	assert.Equal(t, "instance", c.InstanceID)
+	assert.Equal(t, map[string]string{"team": "a"}, c.Labels)
+	assert.Equal(t, &Kubernetes{Pod: "serverbin-0", Zone: "zone-a"}, c.Kubernetes)
+}
@@ -0,0 +1,43 @@
+//go:build linux
+// +build linux
+
+package core
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// GetPeerCredentials reads the credentials of a unix domain socket peer via SO_PEERCRED
+func GetPeerCredentials(conn net.Conn) (*PeerCredentials, error) {
+	unixConn, ok := NetConn(conn).(*net.UnixConn)
+	if !ok {
+		return nil, errors.New("not a unix domain socket")
+	}
+
+	rawConn, err := unixConn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+
+	err = rawConn.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if credErr != nil {
+		return nil, credErr
+	}
+
+	return &PeerCredentials{
+		Uid: cred.Uid,
+		Gid: cred.Gid,
+		Pid: cred.Pid,
+	}, nil
+}
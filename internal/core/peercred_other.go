@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package core
+
+import (
+	"errors"
+	"net"
+)
+
+// GetPeerCredentials is only supported on linux
+func GetPeerCredentials(conn net.Conn) (*PeerCredentials, error) {
+	return nil, errors.New("peer credentials are not supported on this platform")
+}
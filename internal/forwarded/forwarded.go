@@ -0,0 +1,425 @@
+// Package forwarded parses the Forwarded header of RFC 7239 and the X-Forwarded-For and X-Real-IP headers and
+// resolves the client ip by walking the proxy chain from right to left.
+package forwarded
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Header sources of the client ip
+const (
+	SourceForwarded     = "forwarded"
+	SourceXForwardedFor = "x-forwarded-for"
+	SourceXRealIP       = "x-real-ip"
+)
+
+// DefaultPriority of the header sources
+func DefaultPriority() []string {
+	return []string{SourceForwarded, SourceXForwardedFor, SourceXRealIP}
+}
+
+// Node is the node identifier of a for or by parameter
+type Node struct {
+	Raw        string `json:"raw"`
+	IP         string `json:"ip,omitempty"`
+	Port       string `json:"port,omitempty"`
+	Obfuscated string `json:"obfuscated,omitempty"`
+	Unknown    bool   `json:"unknown,omitempty"`
+}
+
+// Element is added by a single proxy
+type Element struct {
+	For        *Node             `json:"for,omitempty"`
+	By         *Node             `json:"by,omitempty"`
+	Host       string            `json:"host,omitempty"`
+	Proto      string            `json:"proto,omitempty"`
+	Extensions map[string]string `json:"extensions,omitempty"`
+	// Invalid is the raw value of an element which could not be parsed
+	Invalid string `json:"invalid,omitempty"`
+}
+
+// Result of the client ip resolution
+type Result struct {
+	ClientIP string `json:"client-ip"`
+	// Source is the header which resolved the client ip, empty if the remote address is the client
+	Source string `json:"source,omitempty"`
+	// TrustedHops is the number of trusted proxies in front of serverbin
+	TrustedHops   int       `json:"trusted-hops"`
+	Host          string    `json:"host,omitempty"`
+	Proto         string    `json:"proto,omitempty"`
+	Forwarded     []Element `json:"forwarded,omitempty"`
+	XForwardedFor []Element `json:"x-forwarded-for,omitempty"`
+	XRealIP       string    `json:"x-real-ip,omitempty"`
+	Errors        []string  `json:"errors,omitempty"`
+}
+
+// Resolve returns the client ip of a request from remoteIP. The headers are only used if remoteIP is trusted, the
+// chain of a header is walked from right to left until an address is not trusted.
+func Resolve(remoteIP string, h http.Header, trusted []*net.IPNet, priority []string) *Result {
+	result := &Result{
+		ClientIP: remoteIP,
+	}
+
+	if v := h.Values("Forwarded"); len(v) > 0 {
+		elements, err := ParseForwarded(v)
+		if err != nil {
+			result.Errors = append(result.Errors, "forwarded: "+err.Error())
+		}
+
+		result.Forwarded = elements
+	}
+
+	if v := h.Values("X-Forwarded-For"); len(v) > 0 {
+		elements, err := ParseXForwardedFor(v)
+		if err != nil {
+			result.Errors = append(result.Errors, "x-forwarded-for: "+err.Error())
+		}
+
+		result.XForwardedFor = elements
+	}
+
+	result.XRealIP = strings.TrimSpace(h.Get("X-Real-Ip"))
+
+	if !isTrusted(remoteIP, trusted) {
+		return result
+	}
+
+	result.TrustedHops = 1
+
+	for _, source := range priority {
+		switch strings.ToLower(source) {
+		case SourceForwarded:
+			if len(result.Forwarded) > 0 {
+				result.walk(SourceForwarded, result.Forwarded, trusted)
+				return result
+			}
+		case SourceXForwardedFor:
+			if len(result.XForwardedFor) > 0 {
+				result.walk(SourceXForwardedFor, result.XForwardedFor, trusted)
+				return result
+			}
+		case SourceXRealIP:
+			if ip := net.ParseIP(result.XRealIP); ip != nil {
+				result.Source = SourceXRealIP
+				result.ClientIP = ip.String()
+
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+// walk moves from right to left as long as the address which added an element is trusted. The walk stops at an
+// element which can not be verified, the client ip is the last verified address and the element is reported.
+func (r *Result) walk(source string, elements []Element, trusted []*net.IPNet) {
+	r.Source = source
+
+	for i := len(elements) - 1; i >= 0; i-- {
+		e := elements[i]
+
+		// the proxy chain is broken
+		if e.Invalid != "" {
+			r.Errors = append(r.Errors, fmt.Sprintf("%s: chain stops at invalid element %q", source, e.Invalid))
+			return
+		}
+
+		if e.Host != "" {
+			r.Host = e.Host
+		}
+
+		if e.Proto != "" {
+			r.Proto = e.Proto
+		}
+
+		// the address of the next proxy is missing
+		if e.For == nil {
+			r.Errors = append(r.Errors, fmt.Sprintf("%s: chain stops at element %d without for", source, i))
+			return
+		}
+
+		// unknown and obfuscated identifiers can not be trusted
+		if e.For.IP == "" {
+			r.Errors = append(r.Errors, fmt.Sprintf("%s: chain stops at node %q without ip", source, e.For.Raw))
+			return
+		}
+
+		r.ClientIP = e.For.IP
+
+		if !isTrusted(e.For.IP, trusted) {
+			return
+		}
+
+		r.TrustedHops++
+	}
+}
+
+func isTrusted(s string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseForwarded parses the values of the Forwarded header, invalid elements are returned with the raw value on errors
+func ParseForwarded(values []string) ([]Element, error) {
+	var elements []Element
+
+	var errs []string
+
+	for _, value := range values {
+		for _, raw := range split(value, ',') {
+			if strings.TrimSpace(raw) == "" {
+				continue
+			}
+
+			e, err := parseElement(raw)
+			if err != nil {
+				errs = append(errs, err.Error())
+				elements = append(elements, Element{Invalid: strings.TrimSpace(raw)})
+
+				continue
+			}
+
+			elements = append(elements, e)
+		}
+	}
+
+	return elements, joinErrors(errs)
+}
+
+func parseElement(raw string) (Element, error) {
+	e := Element{}
+
+	for _, pair := range split(raw, ';') {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return e, fmt.Errorf("%q is not a key=value pair", pair)
+		}
+
+		key := strings.ToLower(pair[:i])
+
+		value, err := unquote(pair[i+1:])
+		if err != nil {
+			return e, fmt.Errorf("%s: %w", key, err)
+		}
+
+		switch key {
+		case "for", "by":
+			node, err := ParseNode(value)
+			if err != nil {
+				return e, fmt.Errorf("%s: %w", key, err)
+			}
+
+			if key == "for" {
+				e.For = node
+			} else {
+				e.By = node
+			}
+		case "host":
+			e.Host = value
+		case "proto":
+			e.Proto = strings.ToLower(value)
+		default:
+			if e.Extensions == nil {
+				e.Extensions = map[string]string{}
+			}
+
+			e.Extensions[key] = value
+		}
+	}
+
+	return e, nil
+}
+
+// ParseXForwardedFor parses the values of the X-Forwarded-For header, invalid elements are returned with the raw value
+// on errors
+func ParseXForwardedFor(values []string) ([]Element, error) {
+	var elements []Element
+
+	var errs []string
+
+	for _, value := range values {
+		for _, raw := range strings.Split(value, ",") {
+			raw = strings.Trim(strings.TrimSpace(raw), "\"")
+			if raw == "" {
+				continue
+			}
+
+			// ipv6 addresses are not always in brackets
+			if ip := net.ParseIP(raw); ip != nil {
+				elements = append(elements, Element{For: &Node{Raw: raw, IP: ip.String()}})
+				continue
+			}
+
+			node, err := ParseNode(raw)
+			if err != nil {
+				errs = append(errs, err.Error())
+				elements = append(elements, Element{Invalid: raw})
+
+				continue
+			}
+
+			elements = append(elements, Element{For: node})
+		}
+	}
+
+	return elements, joinErrors(errs)
+}
+
+// ParseNode parses a node identifier: an ipv4 address, an ipv6 address in brackets, unknown or an obfuscated
+// identifier with an optional port
+func ParseNode(s string) (*Node, error) {
+	node := &Node{Raw: s}
+
+	name, port := s, ""
+
+	if strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return nil, fmt.Errorf("%q: missing ]", s)
+		}
+
+		name, port = s[:end+1], strings.TrimPrefix(s[end+1:], ":")
+
+		if port == "" && len(s) > end+1 {
+			return nil, fmt.Errorf("%q: invalid port", s)
+		}
+	} else if i := strings.LastIndex(s, ":"); i >= 0 {
+		name, port = s[:i], s[i+1:]
+	}
+
+	if port != "" {
+		if !isObfuscated(port) {
+			n, err := strconv.Atoi(port)
+			if err != nil || n < 0 || n > 65535 {
+				return nil, fmt.Errorf("%q: invalid port", s)
+			}
+		}
+
+		node.Port = port
+	}
+
+	switch {
+	case strings.EqualFold(name, "unknown"):
+		node.Unknown = true
+	case isObfuscated(name):
+		node.Obfuscated = name
+	case strings.HasPrefix(name, "["):
+		ip := net.ParseIP(strings.Trim(name, "[]"))
+		if ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf("%q: invalid ipv6 address", s)
+		}
+
+		node.IP = ip.String()
+	default:
+		ip := net.ParseIP(name)
+		if ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf("%q: invalid node", s)
+		}
+
+		node.IP = ip.String()
+	}
+
+	return node, nil
+}
+
+// isObfuscated checks for _ followed by alphanumeric characters, dots, underscores or dashes
+func isObfuscated(s string) bool {
+	if len(s) < 2 || s[0] != '_' {
+		return false
+	}
+
+	for _, c := range s[1:] {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// split splits s at sep outside of quoted strings
+func split(s string, sep byte) []string {
+	var parts []string
+
+	quoted, escaped, start := false, false, 0
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case c == '\\' && quoted:
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// unquote returns a token or the content of a quoted string
+func unquote(s string) (string, error) {
+	s = strings.TrimSpace(s)
+
+	if !strings.HasPrefix(s, "\"") {
+		if s == "" || strings.ContainsAny(s, "\" \t") {
+			return "", fmt.Errorf("%q is not a valid token", s)
+		}
+
+		return s, nil
+	}
+
+	if len(s) < 2 || !strings.HasSuffix(s, "\"") {
+		return "", fmt.Errorf("%s is not terminated", s)
+	}
+
+	var b strings.Builder
+
+	escaped := false
+
+	for _, c := range s[1 : len(s)-1] {
+		switch {
+		case escaped:
+			b.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		default:
+			b.WriteRune(c)
+		}
+	}
+
+	return b.String(), nil
+}
+
+func joinErrors(errs []string) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errors.New(strings.Join(errs, ", "))
+}
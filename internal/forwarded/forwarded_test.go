@@ -0,0 +1,220 @@
+package forwarded
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func networks(t *testing.T, cidrs ...string) []*net.IPNet {
+	var result []*net.IPNet
+
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+
+		result = append(result, n)
+	}
+
+	return result
+}
+
+func TestParseForwarded(t *testing.T) {
+	elements, err := ParseForwarded([]string{
+		`for=192.0.2.43:47011;proto=HTTPS;host=example.com, for="[2001:db8:cafe::17]:4711";by=_hidden`,
+		`for=unknown, for=_gazonk;ext="a;b"`,
+	})
+	require.NoError(t, err)
+	require.Len(t, elements, 4)
+
+	assert.Equal(t, &Node{Raw: "192.0.2.43:47011", IP: "192.0.2.43", Port: "47011"}, elements[0].For)
+	assert.Equal(t, "https", elements[0].Proto)
+	assert.Equal(t, "example.com", elements[0].Host)
+
+	assert.Equal(t, &Node{Raw: "[2001:db8:cafe::17]:4711", IP: "2001:db8:cafe::17", Port: "4711"}, elements[1].For)
+	assert.Equal(t, &Node{Raw: "_hidden", Obfuscated: "_hidden"}, elements[1].By)
+
+	assert.True(t, elements[2].For.Unknown)
+	assert.Equal(t, "_gazonk", elements[3].For.Obfuscated)
+	assert.Equal(t, map[string]string{"ext": "a;b"}, elements[3].Extensions)
+}
+
+func TestParseForwardedErrors(t *testing.T) {
+	tests := []string{
+		"for",
+		`for="192.0.2.43`,
+		"for=2001:db8::1",
+		"for=[2001:db8::1",
+		"for=192.0.2.43:http",
+		"for=192.0.2.43 proto=http",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			_, err := ParseForwarded([]string{tt + ", for=192.0.2.1"})
+			assert.Error(t, err)
+		})
+	}
+
+	// invalid elements are returned with the raw value on errors
+	elements, err := ParseForwarded([]string{"for=invalid, for=192.0.2.1"})
+	assert.Error(t, err)
+	require.Len(t, elements, 2)
+	assert.Equal(t, "for=invalid", elements[0].Invalid)
+	assert.Equal(t, "192.0.2.1", elements[1].For.IP)
+}
+
+func TestParseXForwardedFor(t *testing.T) {
+	elements, err := ParseXForwardedFor([]string{"192.0.2.43, 2001:db8::1", "[2001:db8::2]:8080"})
+	require.NoError(t, err)
+	require.Len(t, elements, 3)
+
+	assert.Equal(t, "192.0.2.43", elements[0].For.IP)
+	assert.Equal(t, "2001:db8::1", elements[1].For.IP)
+	assert.Equal(t, "2001:db8::2", elements[2].For.IP)
+	assert.Equal(t, "8080", elements[2].For.Port)
+
+	elements, err = ParseXForwardedFor([]string{"192.0.2.43, example.com"})
+	assert.Error(t, err)
+	require.Len(t, elements, 2)
+	assert.Equal(t, "example.com", elements[1].Invalid)
+}
+
+func TestResolve(t *testing.T) {
+	trusted := networks(t, "10.0.0.0/8", "fd00::/8")
+
+	tests := []struct {
+		name     string
+		remoteIP string
+		header   http.Header
+		priority []string
+		clientIP string
+		source   string
+		hops     int
+		errors   []string
+	}{
+		{
+			name:     "no headers",
+			remoteIP: "10.0.0.1",
+			header:   http.Header{},
+			clientIP: "10.0.0.1",
+			hops:     1,
+		},
+		{
+			name:     "untrusted remote",
+			remoteIP: "192.0.2.1",
+			header:   http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			clientIP: "192.0.2.1",
+		},
+		{
+			name:     "stops at first untrusted hop",
+			remoteIP: "10.0.0.1",
+			header:   http.Header{"X-Forwarded-For": {"198.51.100.1, 203.0.113.7, 10.0.0.2"}},
+			clientIP: "203.0.113.7",
+			source:   SourceXForwardedFor,
+			hops:     2,
+		},
+		{
+			name:     "all hops trusted",
+			remoteIP: "fd00::1",
+			header:   http.Header{"Forwarded": {`for="[fd00::2]", for=10.0.0.3`}},
+			clientIP: "fd00::2",
+			source:   SourceForwarded,
+			hops:     3,
+		},
+		{
+			name:     "obfuscated hop",
+			remoteIP: "10.0.0.1",
+			header:   http.Header{"Forwarded": {"for=198.51.100.1, for=_proxy"}},
+			clientIP: "10.0.0.1",
+			source:   SourceForwarded,
+			hops:     1,
+			errors:   []string{`forwarded: chain stops at node "_proxy" without ip`},
+		},
+		{
+			name:     "stops at element without for",
+			remoteIP: "10.0.0.1",
+			header:   http.Header{"Forwarded": {"for=198.51.100.1, for=10.0.0.2, proto=https"}},
+			clientIP: "10.0.0.1",
+			source:   SourceForwarded,
+			hops:     1,
+			errors:   []string{"forwarded: chain stops at element 2 without for"},
+		},
+		{
+			name:     "stops at invalid hop",
+			remoteIP: "10.0.0.1",
+			header:   http.Header{"X-Forwarded-For": {"198.51.100.1, example.com, 10.0.0.2"}},
+			clientIP: "10.0.0.2",
+			source:   SourceXForwardedFor,
+			hops:     2,
+			errors: []string{
+				`x-forwarded-for: "example.com": invalid node`,
+				`x-forwarded-for: chain stops at invalid element "example.com"`,
+			},
+		},
+		{
+			name:     "stops at invalid forwarded element",
+			remoteIP: "10.0.0.1",
+			header:   http.Header{"Forwarded": {"for=198.51.100.1, for=spoofed"}},
+			clientIP: "10.0.0.1",
+			source:   SourceForwarded,
+			hops:     1,
+		},
+		{
+			name:     "forwarded before x-forwarded-for",
+			remoteIP: "10.0.0.1",
+			header:   http.Header{"Forwarded": {"for=198.51.100.1"}, "X-Forwarded-For": {"198.51.100.2"}},
+			clientIP: "198.51.100.1",
+			source:   SourceForwarded,
+			hops:     1,
+		},
+		{
+			name:     "custom priority",
+			remoteIP: "10.0.0.1",
+			header:   http.Header{"Forwarded": {"for=198.51.100.1"}, "X-Real-Ip": {"198.51.100.3"}},
+			priority: []string{SourceXRealIP, SourceForwarded},
+			clientIP: "198.51.100.3",
+			source:   SourceXRealIP,
+			hops:     1,
+		},
+		{
+			name:     "disabled source",
+			remoteIP: "10.0.0.1",
+			header:   http.Header{"Forwarded": {"for=198.51.100.1"}},
+			priority: []string{SourceXForwardedFor},
+			clientIP: "10.0.0.1",
+			hops:     1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			priority := tt.priority
+			if priority == nil {
+				priority = DefaultPriority()
+			}
+
+			result := Resolve(tt.remoteIP, tt.header, trusted, priority)
+			assert.Equal(t, tt.clientIP, result.ClientIP)
+			assert.Equal(t, tt.source, result.Source)
+			assert.Equal(t, tt.hops, result.TrustedHops)
+
+			if tt.errors != nil {
+				assert.Equal(t, tt.errors, result.Errors)
+			}
+		})
+	}
+}
+
+func TestResolveHostAndProto(t *testing.T) {
+	h := http.Header{"Forwarded": {"for=198.51.100.1;host=example.com;proto=https, for=10.0.0.2;proto=http"}}
+
+	result := Resolve("10.0.0.1", h, networks(t, "10.0.0.0/8"), DefaultPriority())
+	assert.Equal(t, "198.51.100.1", result.ClientIP)
+	assert.Equal(t, "example.com", result.Host)
+	assert.Equal(t, "https", result.Proto)
+	assert.Len(t, result.Forwarded, 2)
+}
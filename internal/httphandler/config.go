@@ -3,6 +3,11 @@ package httphandler
 import (
 	"net"
 	"net/url"
+
+	"github.com/marsom/serverbin/internal/core"
+	"github.com/marsom/serverbin/internal/forwarded"
+	"github.com/marsom/serverbin/internal/metrics"
+	"github.com/marsom/serverbin/internal/tracing"
 )
 
 type Server struct {
@@ -10,13 +15,34 @@ type Server struct {
 	BaseUrl           *url.URL
 	ManagementBaseUrl *url.URL
 	TrustedAddresses  []*net.IPNet
+	// ForwardedHeaders resolve the client ip in the order of priority, forwarded.DefaultPriority if empty
+	ForwardedHeaders []string
+	Identity         *core.Identity
+	Metrics          *metrics.Metrics
+	Tracer           *tracing.Tracer
+	// Attempts of the flaky handlers are shared by all contexts
+	Attempts *Attempts
+}
+
+func (s Server) forwardedHeaders() []string {
+	if len(s.ForwardedHeaders) == 0 {
+		return forwarded.DefaultPriority()
+	}
+
+	return s.ForwardedHeaders
 }
 
 type Config struct {
-	Path     string
-	Server   Server
-	Cookie   *Cookie
-	Delay    *Delay
-	Slow     *Slow
-	Redirect *Redirect
+	Path      string
+	Server    Server
+	Cookie    *Cookie
+	Delay     *Delay
+	Slow      *Slow
+	Redirect  *Redirect
+	Cors      *Cors
+	Proxy     *Proxy
+	RateLimit *RateLimit
+	Flaky     *Flaky
+	Store     *Store
+	Rules     []Rule
 }
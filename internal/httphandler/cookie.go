@@ -67,9 +67,15 @@ func (c cookieHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		fn := format(c.Server, r, http.StatusOK, nil)
 		fn(w, r)
 	default:
+		allow(w, c.allowedMethods(r, w.Header())...)
+
 		fn := format(c.Server, r, http.StatusMethodNotAllowed, nil)
 		fn(w, r)
 	}
 }
 
-var _ http.Handler = (*cookieHandler)(nil)
+func (c cookieHandler) allowedMethods(_ *http.Request, _ http.Header) []string {
+	return []string{"GET", "HEAD", "PUT", "DELETE"}
+}
+
+var _ methodsHandler = (*cookieHandler)(nil)
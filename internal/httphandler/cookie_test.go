@@ -92,3 +92,22 @@ func TestCookieHanlderGET(t *testing.T) {
 	err = json.Unmarshal(body, &r)
 	assert.Nil(t, err)
 }
+
+func TestCookieHanlderOPTIONS(t *testing.T) {
+	handler := optionsHandler(&cookieHandler{
+		Server: Server{},
+		Cookie: Cookie{
+			Names: []string{"a"},
+		},
+		Path: "/",
+	})
+
+	req := httptest.NewRequest("OPTIONS", "http://localhost/foo", nil)
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	require.Equal(t, 204, w.Code)
+	assert.Equal(t, "GET, HEAD, PUT, DELETE, OPTIONS", w.Header().Get("Allow"))
+	assert.Empty(t, w.Header().Values("Set-Cookie"))
+}
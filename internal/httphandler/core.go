@@ -12,28 +12,65 @@ func RegisterHandlers(serverMux *http.ServeMux, configs ...Config) {
 
 		root := config.Path
 
+		// token buckets of the context
+		var buckets *buckets
+		if config.RateLimit != nil {
+			buckets = newBuckets(config.RateLimit.MaxBuckets)
+		}
+
+		handle := func(name, pattern string, handler http.Handler) {
+			if h, ok := handler.(methodsHandler); ok {
+				handler = optionsHandler(h)
+			}
+
+			if len(config.Rules) > 0 {
+				handler = rulesHandler(config, handler)
+			}
+
+			if config.RateLimit != nil && config.RateLimit.Limit > 0 {
+				handler = rateLimitedHandler(config.Server, *config.RateLimit, buckets, handler)
+			}
+
+			if config.Cors != nil {
+				handler = CorsHandler(*config.Cors, handler)
+			}
+
+			serverMux.Handle(pattern, config.Server.Metrics.InstrumentHandler(root, name, handler))
+		}
+
 		// methods
 		pattern = path.Join(root, "method") + "/"
-		serverMux.Handle(pattern, &methodHandler{
+		handle("method", pattern, &methodHandler{
 			Server:        config.Server,
 			MethodPattern: defaultMethodPattern,
 			Pattern:       pattern,
 		})
 
+		// anything, any method and path
+		pattern = path.Join(root, "anything")
+		handle("anything", pattern, &anythingHandler{
+			Server: config.Server,
+		})
+
+		pattern = path.Join(root, "anything") + "/"
+		handle("anything", pattern, &anythingHandler{
+			Server: config.Server,
+		})
+
 		// status
 		for i := 200; i <= 299; i++ {
 			pattern = path.Join(root, "status", strconv.Itoa(i))
-			serverMux.HandleFunc(pattern, status(config.Server, i))
+			handle("status", pattern, status(config.Server, i))
 		}
 		for i := 400; i <= 599; i++ {
 			pattern = path.Join(root, "status", strconv.Itoa(i))
-			serverMux.HandleFunc(pattern, status(config.Server, i))
+			handle("status", pattern, status(config.Server, i))
 		}
 
 		// delay
 		if config.Delay != nil {
 			pattern = path.Join(root, "delay") + "/"
-			serverMux.Handle(pattern, &delayHandler{
+			handle("delay", pattern, &delayHandler{
 				Server:  config.Server,
 				Delay:   *config.Delay,
 				Pattern: pattern,
@@ -43,7 +80,7 @@ func RegisterHandlers(serverMux *http.ServeMux, configs ...Config) {
 		// cookies
 		if config.Cookie != nil {
 			pattern = path.Join(root, "cookies")
-			serverMux.Handle(pattern, &cookieHandler{
+			handle("cookies", pattern, &cookieHandler{
 				Server: config.Server,
 				Cookie: *config.Cookie,
 				Path:   root,
@@ -53,7 +90,7 @@ func RegisterHandlers(serverMux *http.ServeMux, configs ...Config) {
 		// slow
 		if config.Slow != nil {
 			pattern = path.Join(root, "slow") + "/"
-			serverMux.Handle(pattern, &slowHandler{
+			handle("slow", pattern, &slowHandler{
 				Server:  config.Server,
 				Slow:    *config.Slow,
 				Pattern: pattern,
@@ -61,28 +98,99 @@ func RegisterHandlers(serverMux *http.ServeMux, configs ...Config) {
 		}
 
 		// redirects
-		pattern = path.Join(root, "redirect") + "/url/"
-		serverMux.Handle(pattern, redirectHandler{
-			Server:   config.Server,
-			Redirect: *config.Redirect,
-			Pattern:  pattern,
-			Mode:     redirectByUrl,
-		})
+		if config.Redirect != nil {
+			pattern = path.Join(root, "redirect") + "/url/"
+			handle("redirect", pattern, redirectHandler{
+				Server:   config.Server,
+				Redirect: *config.Redirect,
+				Pattern:  pattern,
+				Mode:     redirectByUrl,
+			})
 
-		pattern = path.Join(root, "redirect") + "/absolute/"
-		serverMux.Handle(pattern, redirectHandler{
-			Server:   config.Server,
-			Redirect: *config.Redirect,
-			Pattern:  pattern,
-			Mode:     redirectByAbsolutePath,
-		})
+			pattern = path.Join(root, "redirect") + "/absolute/"
+			handle("redirect", pattern, redirectHandler{
+				Server:   config.Server,
+				Redirect: *config.Redirect,
+				Pattern:  pattern,
+				Mode:     redirectByAbsolutePath,
+			})
+
+			pattern = path.Join(root, "redirect") + "/relative/"
+			handle("redirect", pattern, redirectHandler{
+				Server:   config.Server,
+				Redirect: *config.Redirect,
+				Pattern:  pattern,
+				Mode:     redirectByRelativePath,
+			})
+		}
+
+		// proxy and chain
+		if config.Proxy != nil {
+			pattern = path.Join(root, "proxy")
+			handle("proxy", pattern, newProxyHandler(config.Server, *config.Proxy, proxyByUrl))
+
+			pattern = path.Join(root, "chain")
+			handle("chain", pattern, newProxyHandler(config.Server, *config.Proxy, proxyChain))
+		}
+
+		// rate limits, the client decides about the budget
+		if config.RateLimit != nil {
+			pattern = path.Join(root, "ratelimit") + "/"
+			handle("ratelimit", pattern, &rateLimitHandler{
+				Server:    config.Server,
+				RateLimit: *config.RateLimit,
+				Pattern:   pattern,
+				buckets:   buckets,
+			})
+		}
+
+		// flaky, the state is kept per request path
+		if config.Flaky != nil {
+			// the attempts are shared with the other contexts and the management api
+			if config.Server.Attempts == nil {
+				panic("httphandler: the flaky handlers require the attempts of the server")
+			}
+
+			for name, mode := range map[string]flakyMode{
+				"flaky":    flakyByAttempts,
+				"sequence": flakyBySequence,
+				"percent":  flakyByPercent,
+			} {
+				pattern = path.Join(root, name) + "/"
+				handle(name, pattern, &flakyHandler{
+					Server:  config.Server,
+					Flaky:   *config.Flaky,
+					Pattern: pattern,
+					Mode:    mode,
+				})
+			}
+		}
+
+		// store, the resources are kept in memory per context
+		if config.Store != nil {
+			s := newStore()
+
+			pattern = path.Join(root, "store")
+			handle("store", pattern, &storeHandler{
+				Server:  config.Server,
+				Store:   *config.Store,
+				Pattern: pattern + "/",
+				store:   s,
+			})
+
+			pattern = path.Join(root, "store") + "/"
+			handle("store", pattern, &storeHandler{
+				Server:  config.Server,
+				Store:   *config.Store,
+				Pattern: pattern,
+				store:   s,
+			})
+		}
 
-		pattern = path.Join(root, "redirect") + "/relative/"
-		serverMux.Handle(pattern, redirectHandler{
-			Server:   config.Server,
-			Redirect: *config.Redirect,
-			Pattern:  pattern,
-			Mode:     redirectByRelativePath,
+		// cors, the client decides about the policy
+		pattern = path.Join(root, "cors")
+		handle("cors", pattern, &corsHandler{
+			Server: config.Server,
 		})
 	}
 
@@ -0,0 +1,218 @@
+package httphandler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cors configuration
+type Cors struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposeHeaders    []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// CorsHandler applies the cors policy to all responses and answers preflight requests
+func CorsHandler(cors Cors, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+
+		if isPreflight(r) {
+			if !cors.allowOrigin(origin) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			method := r.Header.Get("Access-Control-Request-Method")
+			if !containsToken(cors.AllowedMethods, method) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			requestHeaders := splitTokens(r.Header.Values("Access-Control-Request-Headers"))
+			for _, header := range requestHeaders {
+				if !containsToken(cors.AllowedHeaders, header) {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+			}
+
+			h := w.Header()
+			cors.setOrigin(h, origin)
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+
+			// browsers ignore the wildcard for credentialed requests, the requested method is reflected instead
+			if contains(cors.AllowedMethods, "*") {
+				h.Set("Access-Control-Allow-Methods", method)
+			} else {
+				h.Set("Access-Control-Allow-Methods", strings.Join(cors.AllowedMethods, ", "))
+			}
+
+			if len(requestHeaders) > 0 {
+				// reflect the requested headers, they are all allowed at this point
+				h.Set("Access-Control-Allow-Headers", strings.Join(requestHeaders, ", "))
+			}
+
+			if cors.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(cors.MaxAge.Seconds())))
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
+		if origin != "" && cors.allowOrigin(origin) {
+			h := w.Header()
+			cors.setOrigin(h, origin)
+
+			if len(cors.ExposeHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(cors.ExposeHeaders, ", "))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c Cors) allowOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+
+		// wildcard subdomains, i.e. https://*.example.com
+		if i := strings.Index(allowed, "*"); i >= 0 {
+			prefix, suffix := allowed[:i], allowed[i+1:]
+			// the wildcard matches at least one character
+			if len(origin) > len(prefix)+len(suffix) &&
+				strings.HasPrefix(strings.ToLower(origin), strings.ToLower(prefix)) &&
+				strings.HasSuffix(strings.ToLower(origin), strings.ToLower(suffix)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (c Cors) setOrigin(h http.Header, origin string) {
+	// a wildcard is not allowed in combination with credentials
+	if contains(c.AllowedOrigins, "*") && !c.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Add("Vary", "Origin")
+	}
+
+	if c.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+var _ http.Handler = (*corsHandler)(nil)
+
+// corsHandler answers with the cors policy requested by the client via query parameters
+type corsHandler struct {
+	Server
+}
+
+func (h corsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	header := w.Header()
+
+	if values := q["allow-origin"]; len(values) > 0 {
+		for _, value := range values {
+			header.Add("Access-Control-Allow-Origin", value)
+		}
+	} else if origin := r.Header.Get("Origin"); origin != "" {
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Add("Vary", "Origin")
+	}
+
+	if value := q.Get("allow-credentials"); value != "" {
+		header.Set("Access-Control-Allow-Credentials", value)
+	}
+
+	if isPreflight(r) {
+		if values := splitTokens(q["allow-methods"]); len(values) > 0 {
+			header.Set("Access-Control-Allow-Methods", strings.Join(values, ", "))
+		} else {
+			header.Set("Access-Control-Allow-Methods", r.Header.Get("Access-Control-Request-Method"))
+		}
+
+		if values := splitTokens(q["allow-headers"]); len(values) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(values, ", "))
+		} else if values := r.Header.Values("Access-Control-Request-Headers"); len(values) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(splitTokens(values), ", "))
+		}
+
+		if value := q.Get("max-age"); value != "" {
+			header.Set("Access-Control-Max-Age", value)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	}
+
+	if values := splitTokens(q["expose-headers"]); len(values) > 0 {
+		header.Set("Access-Control-Expose-Headers", strings.Join(values, ", "))
+	}
+
+	fn := format(h.Server, r, http.StatusOK, nil)
+	fn(w, r)
+}
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// splitTokens splits comma separated header values
+func splitTokens(values []string) []string {
+	var tokens []string
+
+	for _, value := range values {
+		for _, token := range strings.Split(value, ",") {
+			if token := strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+
+	return tokens
+}
+
+// containsToken checks case-insensitive if the token is allowed
+func containsToken(allowed []string, token string) bool {
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(a, token) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,157 @@
+package httphandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	cors0 = Cors{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		AllowedMethods:   []string{"GET", "PUT"},
+		AllowedHeaders:   []string{"X-Test"},
+		ExposeHeaders:    []string{"X-Exposed"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+)
+
+func TestCorsHandlerPreflight(t *testing.T) {
+	handler := CorsHandler(cors0, status(server0, 200))
+
+	req := httptest.NewRequest("OPTIONS", "http://localhost/foo", nil)
+	req.Header.Set("Origin", "https://a.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "x-test")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Equal(t, "https://a.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "true", resp.Header.Get("Access-Control-Allow-Credentials"))
+	require.Equal(t, "GET, PUT", resp.Header.Get("Access-Control-Allow-Methods"))
+	require.Equal(t, "x-test", resp.Header.Get("Access-Control-Allow-Headers"))
+	require.Equal(t, "600", resp.Header.Get("Access-Control-Max-Age"))
+}
+
+func TestCorsHandlerPreflightDenied(t *testing.T) {
+	handler := CorsHandler(cors0, status(server0, 200))
+
+	tests := map[string]http.Header{
+		"origin": {
+			"Origin":                        []string{"https://example.org"},
+			"Access-Control-Request-Method": []string{"GET"},
+		},
+		"empty label": {
+			"Origin":                        []string{"https://.example.com"},
+			"Access-Control-Request-Method": []string{"GET"},
+		},
+		"method": {
+			"Origin":                        []string{"https://a.example.com"},
+			"Access-Control-Request-Method": []string{"DELETE"},
+		},
+		"header": {
+			"Origin":                         []string{"https://a.example.com"},
+			"Access-Control-Request-Method":  []string{"GET"},
+			"Access-Control-Request-Headers": []string{"X-Other"},
+		},
+	}
+
+	for name, header := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("OPTIONS", "http://localhost/foo", nil)
+			req.Header = header
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			resp := w.Result()
+			require.Equal(t, http.StatusForbidden, resp.StatusCode)
+			require.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
+
+func TestCorsHandlerPreflightWildcardMethods(t *testing.T) {
+	cors := cors0
+	cors.AllowedMethods = []string{"*"}
+
+	handler := CorsHandler(cors, status(server0, 200))
+
+	req := httptest.NewRequest("OPTIONS", "http://localhost/foo", nil)
+	req.Header.Set("Origin", "https://a.example.com")
+	req.Header.Set("Access-Control-Request-Method", "DELETE")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Equal(t, "DELETE", resp.Header.Get("Access-Control-Allow-Methods"))
+}
+
+func TestCorsHandlerWildcard(t *testing.T) {
+	handler := CorsHandler(Cors{AllowedOrigins: []string{"*"}}, status(server0, 200))
+
+	req := httptest.NewRequest("GET", "http://localhost/foo", nil)
+	req.Header.Set("Origin", "https://example.org")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	require.Equal(t, 200, resp.StatusCode)
+	require.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+	require.Empty(t, resp.Header.Get("Access-Control-Allow-Credentials"))
+}
+
+func TestCorsEndpoint(t *testing.T) {
+	handler := &corsHandler{Server: server0}
+
+	req := httptest.NewRequest("OPTIONS", "http://localhost/cors?allow-origin=*&allow-methods=GET,POST&max-age=5", nil)
+	req.Header.Set("Origin", "https://example.org")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "X-A, X-B")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "GET, POST", resp.Header.Get("Access-Control-Allow-Methods"))
+	require.Equal(t, "X-A, X-B", resp.Header.Get("Access-Control-Allow-Headers"))
+	require.Equal(t, "5", resp.Header.Get("Access-Control-Max-Age"))
+
+	req = httptest.NewRequest("GET", "http://localhost/cors?expose-headers=X-A&allow-credentials=true", nil)
+	req.Header.Set("Origin", "https://example.org")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	resp = w.Result()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "https://example.org", resp.Header.Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "true", resp.Header.Get("Access-Control-Allow-Credentials"))
+	require.Equal(t, "X-A", resp.Header.Get("Access-Control-Expose-Headers"))
+}
+
+func TestCorsEndpointRules(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterHandlers(mux, Config{
+		Path:   "/api",
+		Server: Server{MaxRequestBody: 1024},
+		Rules:  []Rule{{Path: "/cors", Status: http.StatusServiceUnavailable}},
+	})
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "http://localhost/api/cors", nil))
+
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
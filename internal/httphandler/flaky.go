@@ -0,0 +1,307 @@
+package httphandler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type flakyMode int
+
+const (
+	flakyByAttempts flakyMode = iota
+	flakyBySequence
+	flakyByPercent
+)
+
+var errMaxKeys = errors.New("max keys reached, reset the attempts with the management api")
+
+// Flaky configuration for the flaky, sequence and percent handlers
+type Flaky struct {
+	// MaxKeys of the attempt counters
+	MaxKeys int
+}
+
+var _ http.Handler = (*flakyHandler)(nil)
+
+type flakyHandler struct {
+	Server
+	Flaky
+	Pattern string
+	Mode    flakyMode
+}
+
+func (h flakyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, h.Pattern)
+	if key == "" && h.Mode != flakyByPercent {
+		fn := format(h.Server, r, http.StatusBadRequest, errors.New("key is missing"))
+		fn(w, r)
+
+		return
+	}
+
+	var attempt, code int
+	var err error
+
+	switch h.Mode {
+	case flakyByAttempts:
+		attempt, code, err = h.attempts(r)
+	case flakyBySequence:
+		attempt, code, err = h.sequence(r)
+	case flakyByPercent:
+		attempt, code, err = h.percent(r, key)
+	}
+
+	if err != nil {
+		code = http.StatusBadRequest
+
+		// the request is valid but the attempts can not be counted
+		if errors.Is(err, errMaxKeys) {
+			code = http.StatusInsufficientStorage
+		}
+
+		fn := format(h.Server, r, code, err)
+		fn(w, r)
+
+		return
+	}
+
+	if attempt > 0 {
+		w.Header().Set("X-Serverbin-Attempt", strconv.Itoa(attempt))
+	}
+
+	fn := format(h.Server, r, code, nil)
+	fn(w, r)
+}
+
+// attempts fails the first attempts of the key
+func (h flakyHandler) attempts(r *http.Request) (int, int, error) {
+	fail, err := queryInt(r, "fail", 1)
+	if err != nil || fail < 0 {
+		return 0, 0, fmt.Errorf("fail %q must be a number greater or equal 0", r.URL.Query().Get("fail"))
+	}
+
+	code, err := queryCode(r, http.StatusServiceUnavailable)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	attempt, _, err := h.Attempts.next(r.URL.Path, h.MaxKeys, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if attempt <= fail {
+		return attempt, code, nil
+	}
+
+	return attempt, http.StatusOK, nil
+}
+
+// sequence cycles through the codes of the key
+func (h flakyHandler) sequence(r *http.Request) (int, int, error) {
+	query := r.URL.Query().Get("codes")
+	if query == "" {
+		return 0, 0, errors.New("codes is missing")
+	}
+
+	var codes []int
+
+	for _, s := range strings.Split(query, ",") {
+		code, err := parseCode(s)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		codes = append(codes, code)
+	}
+
+	attempt, _, err := h.Attempts.next(r.URL.Path, h.MaxKeys, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return attempt, codes[(attempt-1)%len(codes)], nil
+}
+
+// percent fails randomly, a seed makes the failures of the key reproducible
+func (h flakyHandler) percent(r *http.Request, p string) (int, int, error) {
+	percent, err := strconv.ParseFloat(p, 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return 0, 0, fmt.Errorf("percent %q must be a number between 0 and 100", p)
+	}
+
+	code, err := queryCode(r, http.StatusInternalServerError)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	attempt := 0
+
+	//nolint:gosec // no security context
+	random := rand.Float64()
+
+	if s := r.URL.Query().Get("seed"); s != "" {
+		seed, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("seed %q must be a number", s)
+		}
+
+		attempt, random, err = h.Attempts.next(r.URL.Path+"?seed="+s, h.MaxKeys, &seed)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if random*100 < percent {
+		return attempt, code, nil
+	}
+
+	return attempt, http.StatusOK, nil
+}
+
+func queryInt(r *http.Request, name string, value int) (int, error) {
+	if s := r.URL.Query().Get(name); s != "" {
+		return strconv.Atoi(s)
+	}
+
+	return value, nil
+}
+
+func queryCode(r *http.Request, code int) (int, error) {
+	if s := r.URL.Query().Get("code"); s != "" {
+		return parseCode(s)
+	}
+
+	return code, nil
+}
+
+func parseCode(s string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || code < 200 || code > 599 {
+		return 0, fmt.Errorf("code %q must be a status code between 200 and 599", s)
+	}
+
+	return code, nil
+}
+
+// Attempts of the flaky, sequence and percent handlers by request path
+type Attempts struct {
+	mu      sync.Mutex
+	entries map[string]*attempts
+}
+
+type attempts struct {
+	count int
+	rand  *rand.Rand
+}
+
+// NewAttempts returns empty attempt counters
+func NewAttempts() *Attempts {
+	return &Attempts{
+		entries: make(map[string]*attempts),
+	}
+}
+
+// next counts an attempt of the key and returns the random number of the seed
+func (a *Attempts) next(key string, maxKeys int, seed *int64) (int, float64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e, ok := a.entries[key]
+	if !ok {
+		if len(a.entries) >= maxKeys {
+			return 0, 0, errMaxKeys
+		}
+
+		e = &attempts{}
+		if seed != nil {
+			//nolint:gosec // no security context
+			e.rand = rand.New(rand.NewSource(*seed))
+		}
+
+		a.entries[key] = e
+	}
+
+	e.count++
+
+	if e.rand != nil {
+		return e.count, e.rand.Float64(), nil
+	}
+
+	return e.count, 0, nil
+}
+
+// Reset the attempts of a key or all attempts if key is empty
+func (a *Attempts) Reset(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if key == "" {
+		a.entries = make(map[string]*attempts)
+		return
+	}
+
+	for k := range a.entries {
+		// the seeds of a percent key
+		if k == key || strings.HasPrefix(k, key+"?") {
+			delete(a.entries, k)
+		}
+	}
+}
+
+// Handler lists and resets the attempts, the request path after the prefix is the key
+func (a *Attempts) Handler(prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, prefix)
+		if key != "" {
+			key = "/" + key
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			a.list(w)
+		case http.MethodDelete:
+			a.Reset(key)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (a *Attempts) list(w http.ResponseWriter) {
+	type item struct {
+		Key      string `json:"key"`
+		Attempts int    `json:"attempts"`
+	}
+
+	a.mu.Lock()
+
+	items := make([]item, 0, len(a.entries))
+	for key, e := range a.entries {
+		items = append(items, item{Key: key, Attempts: e.count})
+	}
+
+	a.mu.Unlock()
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Key < items[j].Key
+	})
+
+	body, err := json.MarshalIndent(items, "", " ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(append(body, '\n'))
+}
@@ -0,0 +1,95 @@
+package httphandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func flakyMux(attempts *Attempts, maxKeys int) *http.ServeMux {
+	mux := http.NewServeMux()
+	RegisterHandlers(mux, Config{
+		Path:   "/api",
+		Server: Server{MaxRequestBody: 1024, Attempts: attempts},
+		Flaky:  &Flaky{MaxKeys: maxKeys},
+	})
+
+	return mux
+}
+
+func codes(mux *http.ServeMux, target string, n int) []int {
+	var result []int
+
+	for i := 0; i < n; i++ {
+		result = append(result, serve(mux, target, nil).Code)
+	}
+
+	return result
+}
+
+func TestFlaky(t *testing.T) {
+	attempts := NewAttempts()
+	mux := flakyMux(attempts, 10)
+
+	assert.Equal(t, []int{502, 502, 200, 200}, codes(mux, "http://localhost/api/flaky/a?fail=2&code=502", 4))
+	assert.Equal(t, []int{503, 200}, codes(mux, "http://localhost/api/flaky/b", 2))
+
+	w := serve(mux, "http://localhost/api/flaky/b", nil)
+	assert.Equal(t, "3", w.Header().Get("X-Serverbin-Attempt"))
+
+	// reset a key with the management api
+	req := httptest.NewRequest("DELETE", "http://localhost/-/attempts/api/flaky/a", nil)
+	attempts.Handler("/-/attempts/").ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, []int{502, 200}, codes(mux, "http://localhost/api/flaky/a?fail=1&code=502", 2))
+
+	w = httptest.NewRecorder()
+	attempts.Handler("/-/attempts/").ServeHTTP(w, httptest.NewRequest("GET", "http://localhost/-/attempts/", nil))
+	assert.JSONEq(t, `[{"key":"/api/flaky/a","attempts":2},{"key":"/api/flaky/b","attempts":3}]`, w.Body.String())
+}
+
+func TestSequence(t *testing.T) {
+	mux := flakyMux(NewAttempts(), 10)
+
+	assert.Equal(t, []int{500, 502, 200, 500}, codes(mux, "http://localhost/api/sequence/a?codes=500,502,200", 4))
+	assert.Equal(t, []int{400}, codes(mux, "http://localhost/api/sequence/b?codes=500,abc", 1))
+	assert.Equal(t, []int{400}, codes(mux, "http://localhost/api/sequence/", 1))
+
+	w := serve(mux, "http://localhost/api/sequence/c", nil)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []interface{}{"codes is missing"}, decodeResponse(t, w)["errors"])
+}
+
+func TestPercent(t *testing.T) {
+	attempts := NewAttempts()
+	mux := flakyMux(attempts, 10)
+
+	assert.Equal(t, []int{200, 200}, codes(mux, "http://localhost/api/percent/0", 2))
+	assert.Equal(t, []int{500, 500}, codes(mux, "http://localhost/api/percent/100", 2))
+	assert.Equal(t, []int{400}, codes(mux, "http://localhost/api/percent/101", 1))
+
+	// the failures of a seed are reproducible
+	seeded := codes(mux, "http://localhost/api/percent/50?seed=42&code=503", 20)
+	assert.Contains(t, seeded, 503)
+	assert.Contains(t, seeded, 200)
+
+	attempts.Reset("/api/percent/50")
+	assert.Equal(t, seeded, codes(mux, "http://localhost/api/percent/50?seed=42&code=503", 20))
+}
+
+func TestAttemptsMaxKeys(t *testing.T) {
+	attempts := NewAttempts()
+	mux := flakyMux(attempts, 1)
+
+	assert.Equal(t, http.StatusServiceUnavailable, serve(mux, "http://localhost/api/flaky/a", nil).Code)
+
+	w := serve(mux, "http://localhost/api/flaky/b", nil)
+	require.Equal(t, http.StatusInsufficientStorage, w.Code)
+	assert.Equal(t, []interface{}{errMaxKeys.Error()}, decodeResponse(t, w)["errors"])
+
+	attempts.Reset("")
+	assert.Equal(t, http.StatusServiceUnavailable, serve(mux, "http://localhost/api/flaky/b", nil).Code)
+}
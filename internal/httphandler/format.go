@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -63,9 +64,12 @@ func format(config Server, r *http.Request, statusCode int, errs ...error) http.
 
 	r.Body = http.MaxBytesReader(nil, r.Body, config.MaxRequestBody)
 
-	accept := r.Header.Get("Accept")
+	return negotiate(r, statusCode, newResponse(config, r, errs...))
+}
 
-	resp := newResponse(config, r, errs...)
+// negotiate the format of the response with the accept header
+func negotiate(r *http.Request, statusCode int, resp *response) http.HandlerFunc {
+	accept := r.Header.Get("Accept")
 
 	// return json if nothing is specified
 	if accept == "" {
@@ -138,6 +142,18 @@ func formatTEXT(statusCode int, resp *response) http.HandlerFunc {
 			_, _ = w.Write([]byte("\n\n"))
 		}
 
+		if resp.Upstream != nil {
+			_, _ = w.Write([]byte("# Upstream\n\n"))
+			_, _ = w.Write([]byte("url: " + resp.Upstream.URL + "\n"))
+			_, _ = w.Write([]byte("status: " + strconv.Itoa(resp.Upstream.Status) + "\n"))
+			_, _ = w.Write([]byte("duration: " + resp.Upstream.Duration + "\n"))
+
+			if resp.Upstream.Error != "" {
+				_, _ = w.Write([]byte("error: " + resp.Upstream.Error + "\n"))
+			}
+			_, _ = w.Write([]byte("\n\n"))
+		}
+
 		if len(resp.Cookies) > 0 {
 			_, _ = w.Write([]byte("# Cookies\n\n"))
 			for _, cookie := range resp.Cookies {
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/marsom/serverbin/internal/inspect"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -27,13 +28,15 @@ var formatTests = []formatTest{
 			header: nil,
 		},
 		response: response{
+			Schema:    inspect.Schema,
 			Errors:    nil,
+			Method:    "GET",
+			URL:       "/foo",
 			Headers:   nil,
 			Cookies:   nil,
-			Multipart: nil,
 			Form:      nil,
 			Payload:   nil,
-			Origin:    origin{
+			Origin:    inspect.Origin{
 				ClientIP: "192.0.2.1",
 				RemoteIP: "192.0.2.1",
 			},
@@ -46,13 +49,15 @@ var formatTests = []formatTest{
 			header: nil,
 		},
 		response: response{
+			Schema:    inspect.Schema,
 			Errors:    nil,
+			Method:    "PUT",
+			URL:       "/foo",
 			Headers:   nil,
 			Cookies:   nil,
-			Multipart: nil,
 			Form:      nil,
 			Payload:   nil,
-			Origin:    origin{
+			Origin:    inspect.Origin{
 				ClientIP: "192.0.2.1",
 				RemoteIP: "192.0.2.1",
 			},
@@ -65,16 +70,20 @@ var formatTests = []formatTest{
 			header: nil,
 		},
 		response: response{
+			Schema:    inspect.Schema,
 			Errors:    nil,
+			Method:    "PUT",
+			URL:       "/foo",
 			Headers:   nil,
 			Cookies:   nil,
-			Multipart: nil,
 			Form:      nil,
-			Payload:   &Payload{
+			Payload:   &inspect.Payload{
+				Type:   inspect.TypeText,
+				Size:   4,
 				Base64: base64.StdEncoding.EncodeToString([]byte("test")),
-				Json:   nil,
+				Text:   "test",
 			},
-			Origin:    origin{
+			Origin:    inspect.Origin{
 				ClientIP: "192.0.2.1",
 				RemoteIP: "192.0.2.1",
 			},
@@ -0,0 +1,351 @@
+package httphandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// mergePatch applies a JSON Merge Patch (RFC 7396)
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+
+		t[key] = mergePatch(t[key], value)
+	}
+
+	return t
+}
+
+// patchOperation of a JSON Patch (RFC 6902)
+type patchOperation struct {
+	Op    string           `json:"op"`
+	Path  *string          `json:"path"`
+	From  *string          `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// UnmarshalJSON keeps a null value, a nil Value is a missing member
+func (op *patchOperation) UnmarshalJSON(data []byte) error {
+	type operation patchOperation
+
+	if err := json.Unmarshal(data, (*operation)(op)); err != nil {
+		return err
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	if value, ok := members["value"]; ok {
+		op.Value = &value
+	}
+
+	return nil
+}
+
+// jsonPatch applies the operations of a JSON Patch (RFC 6902), the document is not changed if an operation fails
+func jsonPatch(doc interface{}, patch []byte) (interface{}, error) {
+	var operations []patchOperation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, fmt.Errorf("json patch is invalid: %w", err)
+	}
+
+	// work on a copy
+	doc = copyJSON(doc)
+
+	for i, op := range operations {
+		var err error
+
+		doc, err = op.apply(doc)
+		if err != nil {
+			return nil, fmt.Errorf("json patch operation %d (%s): %w", i, op.Op, err)
+		}
+	}
+
+	return doc, nil
+}
+
+func (op patchOperation) apply(doc interface{}) (interface{}, error) {
+	if op.Path == nil {
+		return nil, errors.New("path is missing")
+	}
+
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New("value is missing")
+		}
+
+		var value interface{}
+		if err := decodeJSON(*op.Value, &value); err != nil {
+			return nil, err
+		}
+
+		switch op.Op {
+		case "add":
+			return pointerAdd(doc, path, value)
+		case "replace":
+			if _, err := pointerGet(doc, path); err != nil {
+				return nil, err
+			}
+
+			return pointerSet(doc, path, value)
+		default:
+			current, err := pointerGet(doc, path)
+			if err != nil {
+				return nil, err
+			}
+
+			if !reflect.DeepEqual(current, value) {
+				return nil, fmt.Errorf("value of %s is not equal", *op.Path)
+			}
+
+			return doc, nil
+		}
+	case "remove":
+		return pointerRemove(doc, path)
+	case "move", "copy":
+		if op.From == nil {
+			return nil, errors.New("from is missing")
+		}
+
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := pointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "move" {
+			if strings.HasPrefix(*op.Path+"/", *op.From+"/") && *op.Path != *op.From {
+				return nil, errors.New("a value can not be moved into one of its children")
+			}
+
+			if doc, err = pointerRemove(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			value = copyJSON(value)
+		}
+
+		return pointerAdd(doc, path, value)
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into the reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("pointer %q must start with a /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+// arrayIndex of a reference token, "-" is the end of the array if end is set
+func arrayIndex(token string, length int, end bool) (int, error) {
+	if token == "-" && end {
+		return length, nil
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("%q is not an array index", token)
+	}
+
+	if i > length || (i == length && !end) {
+		return 0, fmt.Errorf("array index %d is out of bounds", i)
+	}
+
+	return i, nil
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			value, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(v), false)
+			if err != nil {
+				return nil, err
+			}
+
+			doc = v[i]
+		default:
+			return nil, fmt.Errorf("%q can not be resolved", token)
+		}
+	}
+
+	return doc, nil
+}
+
+// pointerAdd adds the value and returns the changed document
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	token := path[len(path)-1]
+
+	switch v := parent.(type) {
+	case map[string]interface{}:
+		v[token] = value
+
+		return doc, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(v), true)
+		if err != nil {
+			return nil, err
+		}
+
+		v = append(v, nil)
+		copy(v[i+1:], v[i:])
+		v[i] = value
+
+		return pointerSet(doc, path[:len(path)-1], v)
+	default:
+		return nil, fmt.Errorf("%q can not be resolved", token)
+	}
+}
+
+// pointerRemove removes the value and returns the changed document
+func pointerRemove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errors.New("the root can not be removed")
+	}
+
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	token := path[len(path)-1]
+
+	switch v := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := v[token]; !ok {
+			return nil, fmt.Errorf("member %q does not exist", token)
+		}
+
+		delete(v, token)
+
+		return doc, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(v), false)
+		if err != nil {
+			return nil, err
+		}
+
+		v = append(v[:i:i], v[i+1:]...)
+
+		return pointerSet(doc, path[:len(path)-1], v)
+	default:
+		return nil, fmt.Errorf("%q can not be resolved", token)
+	}
+}
+
+// pointerSet replaces an existing value, arrays change their length and must be set in their parent
+func pointerSet(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	token := path[len(path)-1]
+
+	switch v := parent.(type) {
+	case map[string]interface{}:
+		v[token] = value
+	case []interface{}:
+		i, err := arrayIndex(token, len(v), false)
+		if err != nil {
+			return nil, err
+		}
+
+		v[i] = value
+	}
+
+	return doc, nil
+}
+
+// decodeJSON decodes a json document, numbers are decoded as json.Number to keep their precision
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	return decoder.Decode(v)
+}
+
+// copyJSON returns a deep copy of a decoded json value
+func copyJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			c[key] = copyJSON(item)
+		}
+
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, item := range v {
+			c[i] = copyJSON(item)
+		}
+
+		return c
+	default:
+		return v
+	}
+}
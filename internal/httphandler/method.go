@@ -1,19 +1,24 @@
 package httphandler
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
 var (
-	defaultMethodPattern = regexp.MustCompile("[a-zA-Z]{3,7}")
+	// defaultMethodPattern matches a method token (RFC 7230), this includes WebDAV and extension methods
+	defaultMethodPattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]{1,64}$")
 )
 
-var _ http.Handler = (*methodHandler)(nil)
+var _ methodsHandler = (*methodHandler)(nil)
 
+// methodHandler only allows the method of the path, standard methods are case insensitive and extension methods exact
 type methodHandler struct {
 	Server
 	MethodPattern *regexp.Regexp
@@ -21,26 +26,174 @@ type methodHandler struct {
 }
 
 func (h methodHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	method := strings.ToUpper(strings.TrimPrefix(r.URL.Path, h.Pattern))
+	method, ok := h.method(r)
+	if !ok {
+		fn := format(h.Server, r, http.StatusBadRequest,
+			fmt.Errorf("method %q must be a token of at most 64 characters", method),
+		)
+		fn(w, r)
+
+		return
+	}
+
+	if r.Method != method {
+		allow(w, method)
 
-	if method != r.Method {
 		fn := format(h.Server, r, http.StatusMethodNotAllowed, fmt.Errorf("only %s requests are allowed", method))
 		fn(w, r)
 
 		return
 	}
 
+	serveMethod(h.Server, w, r)
+}
+
+func (h methodHandler) allowedMethods(r *http.Request, _ http.Header) []string {
+	if method, ok := h.method(r); ok {
+		return []string{method}
+	}
+
+	return nil
+}
+
+// method of the path, false if the path is not a valid method
+func (h methodHandler) method(r *http.Request) (string, bool) {
+	method := strings.TrimPrefix(r.URL.Path, h.Pattern)
+
 	if !h.MethodPattern.MatchString(method) {
-		fn := format(h.Server, r, http.StatusBadRequest,
-			errors.New("given method must only contain characters from A-Z"),
-			errors.New("must be at least 3 but not more than 7 characters long"),
-		)
+		return method, false
+	}
+
+	// lower case paths and standard methods are upper case, other mixed case paths are extension methods
+	if upper := strings.ToUpper(method); method == strings.ToLower(method) || standardMethod(upper) {
+		method = upper
+	}
+
+	return method, true
+}
+
+// standardMethod returns true for the methods of HTTP (RFC 7231, RFC 5789) and WebDAV (RFC 4918)
+func standardMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+		http.MethodConnect, http.MethodOptions, http.MethodTrace,
+		"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK":
+		return true
+	default:
+		return false
+	}
+}
+
+var _ http.Handler = (*anythingHandler)(nil)
+
+// anythingHandler echoes requests of any method and path
+type anythingHandler struct {
+	Server
+}
+
+func (h anythingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveMethod(h.Server, w, r)
+}
+
+// serveMethod returns the data of a request, TRACE and CONNECT follow their semantics
+func serveMethod(config Server, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodTrace:
+		trace(w, r)
+	case http.MethodConnect:
+		tunnel(config, w, r)
+	default:
+		fn := format(config, r, http.StatusOK, nil)
 		fn(w, r)
+	}
+}
+
+// methodsHandler knows the allowed methods of a request
+type methodsHandler interface {
+	http.Handler
+
+	// allowedMethods of the request or nil if they are unknown, header receives additional headers of the OPTIONS response
+	allowedMethods(r *http.Request, header http.Header) []string
+}
+
+// optionsHandler answers OPTIONS requests with the allowed methods of the handler, unless OPTIONS is one of them
+func optionsHandler(next methodsHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			if methods := next.allowedMethods(r, w.Header()); methods != nil && !contains(methods, http.MethodOptions) {
+				options(w, methods...)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allow sets the Allow header, OPTIONS is always allowed
+func allow(w http.ResponseWriter, methods ...string) {
+	if !contains(methods, http.MethodOptions) {
+		methods = append(methods, http.MethodOptions)
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+}
+
+// options answers an OPTIONS request with the allowed methods
+func options(w http.ResponseWriter, methods ...string) {
+	allow(w, methods...)
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// trace returns the received request without body as message/http (RFC 7231), credentials are not reflected
+func trace(w http.ResponseWriter, r *http.Request) {
+	header := r.Header.Clone()
+	header.Del("Authorization")
+	header.Del("Proxy-Authorization")
+	header.Del("Cookie")
+
+	var message bytes.Buffer
+
+	_, _ = fmt.Fprintf(&message, "%s %s %s\r\nHost: %s\r\n", r.Method, r.RequestURI, r.Proto, r.Host)
+	_ = header.Write(&message)
+	_, _ = message.WriteString("\r\n")
+
+	w.Header().Set("Content-Type", "message/http")
+	w.Header().Set("Content-Length", strconv.Itoa(message.Len()))
+	w.WriteHeader(http.StatusOK)
+
+	_, _ = w.Write(message.Bytes())
+}
+
+// tunnel answers a CONNECT request with 200 and echoes the data of the tunnel until the client closes it
+func tunnel(config Server, w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		fn := format(config, r, http.StatusNotImplemented, errors.New("tunnels require http/1.x"))
+		fn(w, r)
+
+		return
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		fn := format(config, r, http.StatusNotImplemented, errors.New("tunnels require http/1.x"), err)
+		fn(w, r)
+
+		return
+	}
+
+	defer conn.Close()
+
+	if _, err := rw.WriteString(r.Proto + " 200 Connection Established\r\n\r\n"); err != nil {
+		return
+	}
 
+	if err := rw.Flush(); err != nil {
 		return
 	}
 
-	// return data
-	fn := format(h.Server, r, http.StatusOK, nil)
-	fn(w, r)
+	// the reader contains the data which was buffered with the request
+	_, _ = io.Copy(conn, rw.Reader)
 }
@@ -0,0 +1,129 @@
+package httphandler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func methodMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	RegisterHandlers(mux, Config{
+		Path:   "/api",
+		Server: Server{MaxRequestBody: 1024},
+	})
+
+	return mux
+}
+
+func TestMethod(t *testing.T) {
+	mux := methodMux()
+
+	for _, method := range []string{"GET", "PROPFIND", "PURGE", "VERSION-CONTROL", "BASELINE-CONTROL"} {
+		w := send(mux, method, "http://localhost/api/method/"+strings.ToLower(method), "", nil)
+		assert.Equal(t, http.StatusOK, w.Code, method)
+	}
+
+	// standard methods are case insensitive
+	for _, path := range []string{"Get", "GET", "PropFind"} {
+		w := send(mux, strings.ToUpper(path), "http://localhost/api/method/"+path, "", nil)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+
+	// extension methods are case sensitive
+	w := send(mux, "myMethod", "http://localhost/api/method/myMethod", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = send(mux, "POST", "http://localhost/api/method/myMethod", "", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "myMethod, OPTIONS", w.Header().Get("Allow"))
+
+	w = send(mux, "GET", "http://localhost/api/method/propfind", "", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "PROPFIND, OPTIONS", w.Header().Get("Allow"))
+	assert.Equal(t, []interface{}{"only PROPFIND requests are allowed"}, decodeResponse(t, w)["errors"])
+
+	w = send(mux, "OPTIONS", "http://localhost/api/method/propfind", "", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "PROPFIND, OPTIONS", w.Header().Get("Allow"))
+
+	w = send(mux, "OPTIONS", "http://localhost/api/method/options", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = send(mux, "GET", "http://localhost/api/method/options", "", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "OPTIONS", w.Header().Get("Allow"))
+
+	w = send(mux, "GET", "http://localhost/api/method/"+strings.Repeat("A", 65), "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = send(mux, "GET", "http://localhost/api/method/a%20b", "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAnything(t *testing.T) {
+	mux := methodMux()
+
+	for _, target := range []string{"/api/anything", "/api/anything/a/b?c=d"} {
+		for _, method := range []string{"GET", "DELETE", "PROPFIND", "SOME-VERY-LONG-EXTENSION-METHOD"} {
+			w := send(mux, method, "http://localhost"+target, "", nil)
+			require.Equal(t, http.StatusOK, w.Code, method)
+			assert.Equal(t, method, decodeResponse(t, w)["method"], method)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	mux := methodMux()
+
+	w := send(mux, "TRACE", "http://localhost/api/anything/a", "", http.Header{
+		"X-Test":        []string{"1"},
+		"Authorization": []string{"Basic c2VjcmV0"},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "message/http", w.Header().Get("Content-Type"))
+	assert.Equal(t, "TRACE http://localhost/api/anything/a HTTP/1.1\r\nHost: localhost\r\nX-Test: 1\r\n\r\n", w.Body.String())
+
+	w = send(mux, "TRACE", "http://localhost/api/method/trace", "", nil)
+	assert.Equal(t, "message/http", w.Header().Get("Content-Type"))
+}
+
+func TestConnect(t *testing.T) {
+	server := httptest.NewServer(methodMux())
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	require.Nil(t, err)
+
+	defer conn.Close()
+
+	_, err = fmt.Fprintf(conn, "CONNECT /api/anything HTTP/1.1\r\nHost: example.com:443\r\n\r\nhello")
+	require.Nil(t, err)
+
+	reader := bufio.NewReader(conn)
+
+	status, err := reader.ReadString('\n')
+	require.Nil(t, err)
+	assert.Equal(t, "HTTP/1.1 200 Connection Established\r\n", status)
+
+	empty, err := reader.ReadString('\n')
+	require.Nil(t, err)
+	assert.Equal(t, "\r\n", empty)
+
+	// the data of the tunnel is echoed
+	_, err = conn.Write([]byte(" world"))
+	require.Nil(t, err)
+
+	data := make([]byte, len("hello world"))
+	_, err = io.ReadFull(reader, data)
+	require.Nil(t, err)
+	assert.Equal(t, "hello world", string(data))
+}
@@ -0,0 +1,310 @@
+package httphandler
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HopsHeader counts the proxy hops of a request
+const HopsHeader = "X-Serverbin-Hops"
+
+// maxUpstreamBody is the max size of an upstream response body in the combined response
+const maxUpstreamBody = 1 << 20
+
+type proxyMode int
+
+const (
+	proxyByUrl proxyMode = iota
+	proxyChain
+)
+
+// Proxy configuration for requests to upstream servers
+type Proxy struct {
+	// AllowedHosts of the upstream servers, i.e. backend, *.svc.cluster.local or backend:8080. * allows all hosts.
+	AllowedHosts []string
+	MaxHops      int
+	Timeout      time.Duration
+	Insecure     bool
+}
+
+type upstream struct {
+	URL      string      `json:"url"`
+	Status   int         `json:"status,omitempty"`
+	Headers  http.Header `json:"headers,omitempty"`
+	Duration string      `json:"duration"`
+	Body     interface{} `json:"body,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+var _ http.Handler = (*proxyHandler)(nil)
+
+type proxyHandler struct {
+	Server
+	Proxy
+	Mode   proxyMode
+	client *http.Client
+}
+
+func newProxyHandler(server Server, proxy Proxy, mode proxyMode) *proxyHandler {
+	transport := &http.Transport{
+		//nolint:gosec // upstream servers may use self-signed certificates
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: proxy.Insecure},
+	}
+
+	return &proxyHandler{
+		Server: server,
+		Proxy:  proxy,
+		Mode:   mode,
+		client: &http.Client{
+			Transport: server.Tracer.Transport(transport),
+			Timeout:   proxy.Timeout,
+			// redirects are returned to the client
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+func (h *proxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	hops := 0
+
+	if v := r.Header.Get(HopsHeader); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 {
+			fn := format(h.Server, r, http.StatusBadRequest, fmt.Errorf("%s is not a positive integer", HopsHeader))
+			fn(w, r)
+
+			return
+		}
+
+		hops = i
+	}
+
+	target, err := h.target(r)
+	if err != nil {
+		fn := format(h.Server, r, http.StatusBadRequest, err)
+		fn(w, r)
+
+		return
+	}
+
+	// last hop of a chain
+	if target == nil {
+		fn := format(h.Server, r, http.StatusOK, nil)
+		fn(w, r)
+
+		return
+	}
+
+	if hops >= h.MaxHops {
+		fn := format(h.Server, r, http.StatusLoopDetected, fmt.Errorf("max hops %d reached", h.MaxHops))
+		fn(w, r)
+
+		return
+	}
+
+	if !h.allowed(target) {
+		fn := format(h.Server, r, http.StatusForbidden, fmt.Errorf("host %q is not allowed", target.Host))
+		fn(w, r)
+
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, h.MaxRequestBody))
+	if err != nil {
+		fn := format(h.Server, r, http.StatusBadRequest, errors.New("could not read request body"), err)
+		fn(w, r)
+
+		return
+	}
+
+	up := h.forward(r, target, body, hops+1)
+
+	statusCode := up.Status
+	if up.Error != "" {
+		statusCode = http.StatusBadGateway
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	resp := newResponse(h.Server, r)
+	resp.Upstream = up
+
+	fn := negotiate(r, statusCode, resp)
+	fn(w, r)
+}
+
+// target returns the upstream url, nil if the request is the last hop of a chain
+func (h *proxyHandler) target(r *http.Request) (*url.URL, error) {
+	query := r.URL.Query()
+
+	if h.Mode == proxyByUrl {
+		return parseUpstreamUrl(query.Get("url"))
+	}
+
+	hops := query["hop"]
+	if len(hops) == 0 {
+		return nil, nil
+	}
+
+	next, err := parseUpstreamUrl(hops[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// the next hop forwards to the remaining hops
+	next.Path = path.Join("/", next.Path, "chain")
+
+	q := next.Query()
+	q.Del("hop")
+
+	for _, hop := range hops[1:] {
+		q.Add("hop", hop)
+	}
+
+	next.RawQuery = q.Encode()
+
+	return next, nil
+}
+
+func parseUpstreamUrl(s string) (*url.URL, error) {
+	if s == "" {
+		return nil, errors.New("upstream url is missing")
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream url: %w", err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("upstream url %q must be an absolute http or https url", s)
+	}
+
+	return u, nil
+}
+
+// allowed checks the host of the url, patterns with a port must match the port too
+func (p Proxy) allowed(u *url.URL) bool {
+	for _, pattern := range p.AllowedHosts {
+		if pattern == "*" {
+			return true
+		}
+
+		host := u.Hostname()
+		if _, _, err := net.SplitHostPort(pattern); err == nil {
+			host = u.Host
+		}
+
+		// wildcard subdomains, i.e. *.svc.cluster.local
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(strings.ToLower(host), strings.ToLower(pattern[1:])) {
+				return true
+			}
+
+			continue
+		}
+
+		if strings.EqualFold(pattern, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forward sends the request with all end-to-end headers to the upstream server
+func (h *proxyHandler) forward(r *http.Request, target *url.URL, body []byte, hops int) *upstream {
+	up := &upstream{
+		URL: target.String(),
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		up.Error = err.Error()
+		return up
+	}
+
+	for k, v := range r.Header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+
+	removeHopByHopHeaders(req.Header)
+
+	req.Header.Set(HopsHeader, strconv.Itoa(hops))
+
+	if remoteIP, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := r.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+			remoteIP = strings.Join(prior, ", ") + ", " + remoteIP
+		}
+
+		req.Header.Set("X-Forwarded-For", remoteIP)
+	}
+
+	start := time.Now()
+
+	resp, err := h.client.Do(req)
+
+	up.Duration = time.Since(start).String()
+
+	if err != nil {
+		up.Error = err.Error()
+		return up
+	}
+	defer resp.Body.Close()
+
+	up.Status = resp.StatusCode
+	up.Headers = resp.Header
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxUpstreamBody))
+	if err != nil {
+		up.Error = err.Error()
+		return up
+	}
+
+	var jsonData interface{}
+	if err := json.Unmarshal(data, &jsonData); err == nil {
+		up.Body = jsonData
+	} else if len(data) > 0 {
+		up.Body = string(data)
+	}
+
+	return up
+}
+
+// removeHopByHopHeaders removes the headers which are not forwarded to the upstream server
+func removeHopByHopHeaders(h http.Header) {
+	for _, v := range h.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			h.Del(strings.TrimSpace(token))
+		}
+	}
+
+	for _, k := range []string{
+		"Connection",
+		"Keep-Alive",
+		"Proxy-Authenticate",
+		"Proxy-Authorization",
+		"Proxy-Connection",
+		"Te",
+		"Trailer",
+		"Transfer-Encoding",
+		"Upgrade",
+		// the transport negotiates the encoding and decompresses the body
+		"Accept-Encoding",
+	} {
+		h.Del(k)
+	}
+}
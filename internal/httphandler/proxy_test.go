@@ -0,0 +1,159 @@
+package httphandler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chainServer is a serverbin with the proxy and chain handlers on /api
+func chainServer(t *testing.T, proxy Proxy) *httptest.Server {
+	mux := http.NewServeMux()
+	RegisterHandlers(mux, Config{
+		Path:   "/api",
+		Server: Server{MaxRequestBody: 1024},
+		Proxy:  &proxy,
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	return resp
+}
+
+func TestProxy(t *testing.T) {
+	var received http.Header
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte(`{"name": "upstream"}`))
+	}))
+	defer upstream.Close()
+
+	h := newProxyHandler(Server{MaxRequestBody: 1024}, Proxy{
+		AllowedHosts: []string{"127.0.0.1"},
+		MaxHops:      2,
+		Timeout:      time.Second,
+	}, proxyByUrl)
+
+	r := httptest.NewRequest(http.MethodGet, "/proxy?url="+url.QueryEscape(upstream.URL+"/status"), nil)
+	r.Header.Set("X-Custom", "a")
+	r.Header.Set("Connection", "X-Secret")
+	r.Header.Set("X-Secret", "b")
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusTeapot, w.Code)
+	assert.Equal(t, "a", received.Get("X-Custom"))
+	assert.Empty(t, received.Get("X-Secret"))
+	assert.Equal(t, "1", received.Get(HopsHeader))
+	assert.Equal(t, "192.0.2.1", received.Get("X-Forwarded-For"))
+
+	resp := decodeResponse(t, w)
+	up := resp["upstream"].(map[string]interface{})
+	assert.Equal(t, float64(http.StatusTeapot), up["status"])
+	assert.Equal(t, map[string]interface{}{"name": "upstream"}, up["body"])
+	assert.Contains(t, resp, "headers")
+}
+
+func TestProxyErrors(t *testing.T) {
+	h := newProxyHandler(Server{MaxRequestBody: 1024}, Proxy{
+		AllowedHosts: []string{"*.svc.cluster.local", "127.0.0.1:1"},
+		MaxHops:      2,
+		Timeout:      time.Second,
+	}, proxyByUrl)
+
+	tests := []struct {
+		name   string
+		target string
+		hops   string
+		status int
+	}{
+		{name: "missing url", target: "/proxy", status: http.StatusBadRequest},
+		{name: "relative url", target: "/proxy?url=/status/200", status: http.StatusBadRequest},
+		{name: "not allowed", target: "/proxy?url=http://example.com/", status: http.StatusForbidden},
+		{name: "not allowed port", target: "/proxy?url=http://127.0.0.1:2/", status: http.StatusForbidden},
+		{name: "max hops", target: "/proxy?url=http://backend.svc.cluster.local/", hops: "2", status: http.StatusLoopDetected},
+		{name: "invalid hops", target: "/proxy?url=http://backend.svc.cluster.local/", hops: "x", status: http.StatusBadRequest},
+		{name: "unreachable", target: "/proxy?url=http://127.0.0.1:1/", status: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.hops != "" {
+				r.Header.Set(HopsHeader, tt.hops)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	proxy := Proxy{AllowedHosts: []string{"127.0.0.1"}, MaxHops: 5, Timeout: time.Second}
+
+	b := chainServer(t, proxy)
+	c := chainServer(t, proxy)
+
+	a := chainServer(t, proxy)
+
+	target := a.URL + "/api/chain?hop=" + url.QueryEscape(b.URL+"/api") + "&hop=" + url.QueryEscape(c.URL+"/api")
+
+	resp, err := http.Get(target)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	// a -> b
+	up := body["upstream"].(map[string]interface{})
+	assert.Contains(t, up["url"], b.URL+"/api/chain?hop=")
+
+	// b -> c
+	up = up["body"].(map[string]interface{})["upstream"].(map[string]interface{})
+	assert.Equal(t, c.URL+"/api/chain", up["url"])
+
+	// c is the last hop
+	last := up["body"].(map[string]interface{})
+	assert.NotContains(t, last, "upstream")
+	assert.Equal(t, []interface{}{"2"}, last["headers"].(map[string]interface{})[HopsHeader])
+}
+
+func TestChainMaxHops(t *testing.T) {
+	proxy := Proxy{AllowedHosts: []string{"127.0.0.1"}, MaxHops: 1, Timeout: time.Second}
+
+	b := chainServer(t, proxy)
+	a := chainServer(t, proxy)
+
+	target := a.URL + "/api/chain?hop=" + url.QueryEscape(b.URL+"/api") + "&hop=" + url.QueryEscape(a.URL+"/api")
+
+	resp, err := http.Get(target)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusLoopDetected, resp.StatusCode)
+}
@@ -0,0 +1,227 @@
+package httphandler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errMaxBuckets = errors.New("max rate limit buckets reached, retry after the unused buckets are purged")
+
+// Rate limit keys
+const (
+	// RateLimitByContext shares one bucket of all clients
+	RateLimitByContext = "context"
+	// RateLimitByClientIP uses a bucket per client ip
+	RateLimitByClientIP = "client-ip"
+	// RateLimitByHeader uses a bucket per api key header, the client ip is used without header
+	RateLimitByHeader = "header"
+)
+
+// RateLimit configuration, a token bucket of Limit requests which is refilled within the Window
+type RateLimit struct {
+	// Limit of all requests of the context, 0 only enables the ratelimit endpoint
+	Limit  int
+	Window time.Duration
+	// Key of the buckets: context, client-ip or header
+	Key string
+	// Header with the api key of the header key
+	Header string
+	// MaxWindow of the ratelimit endpoint
+	MaxWindow time.Duration
+	// MaxBuckets of all keys and budgets of the context
+	MaxBuckets int
+}
+
+// key returns the bucket key of a request
+func (l RateLimit) key(config Server, r *http.Request) string {
+	switch l.Key {
+	case RateLimitByContext:
+		return ""
+	case RateLimitByHeader:
+		if value := r.Header.Get(l.Header); value != "" {
+			return "header:" + value
+		}
+	}
+
+	return "ip:" + ClientIP(config, r)
+}
+
+var _ http.Handler = (*rateLimitHandler)(nil)
+
+// rateLimitHandler is the ratelimit endpoint, the client chooses the limit and the window
+type rateLimitHandler struct {
+	Server
+	RateLimit
+	Pattern string
+	buckets *buckets
+}
+
+func (h rateLimitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	limit, window, err := parseRateLimit(strings.TrimPrefix(r.URL.Path, h.Pattern))
+	if err != nil {
+		fn := format(h.Server, r, http.StatusBadRequest, err)
+		fn(w, r)
+
+		return
+	}
+
+	if window > h.MaxWindow {
+		fn := format(h.Server, r, http.StatusBadRequest, fmt.Errorf("window must not be greater than %s", h.MaxWindow))
+		fn(w, r)
+
+		return
+	}
+
+	key := fmt.Sprintf("%d/%s/%s", limit, window, h.key(h.Server, r))
+
+	if err := h.buckets.take(w, key, limit, window, time.Now()); err != nil {
+		fn := format(h.Server, r, http.StatusTooManyRequests, err)
+		fn(w, r)
+
+		return
+	}
+
+	fn := format(h.Server, r, http.StatusOK, nil)
+	fn(w, r)
+}
+
+// parseRateLimit parses {limit}/{window}, the window is a duration or a number of seconds
+func parseRateLimit(s string) (int, time.Duration, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return 0, 0, errors.New("path must be /ratelimit/{limit}/{window}")
+	}
+
+	limit, err := strconv.Atoi(parts[0])
+	if err != nil || limit <= 0 {
+		return 0, 0, fmt.Errorf("limit %q must be a number greater than 0", parts[0])
+	}
+
+	window, err := parseWindow(parts[1])
+	if err != nil || window <= 0 {
+		return 0, 0, fmt.Errorf("window %q must be a duration or a number of seconds greater than 0", parts[1])
+	}
+
+	return limit, window, nil
+}
+
+func parseWindow(s string) (time.Duration, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if seconds > math.MaxInt64/int64(time.Second) {
+			return 0, fmt.Errorf("window %q is too large", s)
+		}
+
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+// rateLimitedHandler limits all requests of a context
+func rateLimitedHandler(config Server, limit RateLimit, b *buckets, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := b.take(w, limit.key(config, r), limit.Limit, limit.Window, time.Now()); err != nil {
+			fn := format(config, r, http.StatusTooManyRequests, err)
+			fn(w, r)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+var errRateLimitExceeded = errors.New("rate limit exceeded")
+
+// buckets of the token bucket rate limiter
+type buckets struct {
+	mu         sync.Mutex
+	buckets    map[string]*bucket
+	purged     time.Time
+	maxBuckets int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	window time.Duration
+}
+
+func newBuckets(maxBuckets int) *buckets {
+	return &buckets{
+		buckets:    make(map[string]*bucket),
+		maxBuckets: maxBuckets,
+	}
+}
+
+// take a token of the bucket and set the rate limit headers, an error is returned if the bucket is empty or no
+// bucket can be added
+func (b *buckets) take(w http.ResponseWriter, key string, limit int, window time.Duration, now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.purge(now)
+
+	rate := float64(limit) / window.Seconds()
+
+	bu, ok := b.buckets[key]
+	if !ok {
+		if len(b.buckets) >= b.maxBuckets {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(b.purged.Add(time.Minute).Sub(now).Seconds()))))
+
+			return errMaxBuckets
+		}
+
+		bu = &bucket{tokens: float64(limit), last: now, window: window}
+		b.buckets[key] = bu
+	}
+
+	bu.tokens = math.Min(float64(limit), bu.tokens+now.Sub(bu.last).Seconds()*rate)
+	bu.last = now
+
+	allowed := bu.tokens >= 1
+	if allowed {
+		bu.tokens--
+	}
+
+	// seconds until the bucket is full again
+	reset := int(math.Ceil((float64(limit) - bu.tokens) / rate))
+
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(int(bu.tokens)))
+	h.Set("RateLimit-Reset", strconv.Itoa(reset))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit, int(math.Ceil(window.Seconds()))))
+	h.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(int(bu.tokens)))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(time.Duration(reset)*time.Second).Unix(), 10))
+
+	if !allowed {
+		h.Set("Retry-After", strconv.Itoa(int(math.Ceil((1-bu.tokens)/rate))))
+
+		return errRateLimitExceeded
+	}
+
+	return nil
+}
+
+// purge the full buckets once a minute
+func (b *buckets) purge(now time.Time) {
+	if now.Sub(b.purged) < time.Minute {
+		return
+	}
+
+	b.purged = now
+
+	for key, bu := range b.buckets {
+		if now.Sub(bu.last) >= bu.window {
+			delete(b.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package httphandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rateLimitMux(limit RateLimit) *http.ServeMux {
+	mux := http.NewServeMux()
+	RegisterHandlers(mux, Config{
+		Path:      "/api",
+		Server:    Server{MaxRequestBody: 1024},
+		RateLimit: &limit,
+	})
+
+	return mux
+}
+
+func serve(mux *http.ServeMux, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestRateLimitEndpoint(t *testing.T) {
+	mux := rateLimitMux(RateLimit{Key: RateLimitByClientIP, MaxWindow: time.Hour, MaxBuckets: 100})
+
+	for i := 2; i >= 0; i-- {
+		w := serve(mux, "http://localhost/api/ratelimit/3/60", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "3", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "3", w.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, strconv.Itoa(i), w.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "3;w=60", w.Header().Get("RateLimit-Policy"))
+	}
+
+	w := serve(mux, "http://localhost/api/ratelimit/3/60", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "20", w.Header().Get("Retry-After"))
+	assert.Equal(t, "60", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, []interface{}{"rate limit exceeded"}, decodeResponse(t, w)["errors"])
+
+	// another budget has its own bucket
+	w = serve(mux, "http://localhost/api/ratelimit/3/30s", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRateLimitEndpointErrors(t *testing.T) {
+	mux := rateLimitMux(RateLimit{Key: RateLimitByClientIP, MaxWindow: time.Hour, MaxBuckets: 100})
+
+	for _, target := range []string{"/api/ratelimit/3", "/api/ratelimit/0/1m", "/api/ratelimit/3/abc", "/api/ratelimit/3/2h", "/api/ratelimit/3/18446744074"} {
+		w := serve(mux, "http://localhost"+target, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+	}
+}
+
+func TestRateLimitContext(t *testing.T) {
+	mux := rateLimitMux(RateLimit{Limit: 1, Window: time.Minute, Key: RateLimitByHeader, Header: "X-Api-Key", MaxWindow: time.Hour, MaxBuckets: 100})
+
+	a := http.Header{"X-Api-Key": []string{"a"}}
+	b := http.Header{"X-Api-Key": []string{"b"}}
+
+	assert.Equal(t, http.StatusOK, serve(mux, "http://localhost/api/status/200", a).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(mux, "http://localhost/api/status/200", a).Code)
+	assert.Equal(t, http.StatusTeapot, serve(mux, "http://localhost/api/status/418", b).Code)
+
+	// without header the client ip is used
+	assert.Equal(t, http.StatusOK, serve(mux, "http://localhost/api/status/200", nil).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(mux, "http://localhost/api/status/200", nil).Code)
+}
+
+func TestBucketsRefill(t *testing.T) {
+	b := newBuckets(2)
+	w := httptest.NewRecorder()
+	now := time.Now()
+
+	assert.Nil(t, b.take(w, "k", 2, 10*time.Second, now))
+	assert.Nil(t, b.take(w, "k", 2, 10*time.Second, now))
+	assert.Equal(t, errRateLimitExceeded, b.take(w, "k", 2, 10*time.Second, now))
+	assert.Equal(t, "5", w.Header().Get("Retry-After"))
+
+	// one token is refilled after 5s
+	assert.Nil(t, b.take(w, "k", 2, 10*time.Second, now.Add(5*time.Second)))
+	assert.Equal(t, errRateLimitExceeded, b.take(w, "k", 2, 10*time.Second, now.Add(5*time.Second)))
+
+	// full buckets are purged
+	assert.Nil(t, b.take(w, "other", 2, 10*time.Second, now.Add(2*time.Minute)))
+	assert.Len(t, b.buckets, 1)
+}
+
+func TestBucketsMax(t *testing.T) {
+	b := newBuckets(2)
+	now := time.Now()
+
+	assert.Nil(t, b.take(httptest.NewRecorder(), "a", 1, time.Second, now))
+	assert.Nil(t, b.take(httptest.NewRecorder(), "b", 1, time.Second, now))
+
+	w := httptest.NewRecorder()
+	assert.Equal(t, errMaxBuckets, b.take(w, "c", 1, time.Second, now.Add(30*time.Second)))
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	// existing buckets are still used
+	assert.Nil(t, b.take(httptest.NewRecorder(), "a", 1, time.Second, now.Add(30*time.Second)))
+
+	// unused buckets are purged
+	assert.Nil(t, b.take(httptest.NewRecorder(), "c", 1, time.Second, now.Add(time.Minute)))
+}
+
+func TestRateLimitMaxBuckets(t *testing.T) {
+	mux := rateLimitMux(RateLimit{Key: RateLimitByClientIP, MaxWindow: time.Hour, MaxBuckets: 1})
+
+	assert.Equal(t, http.StatusOK, serve(mux, "http://localhost/api/ratelimit/3/1m", nil).Code)
+
+	w := serve(mux, "http://localhost/api/ratelimit/4/1m", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
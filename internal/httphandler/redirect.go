@@ -41,8 +41,8 @@ func (h redirectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if depth >= 20 || depth < 0 {
-		fn := format(h.Server, r, http.StatusBadRequest, errors.New("max redirect count is 20"))
+	if depth >= int(h.Max) || depth < 0 {
+		fn := format(h.Server, r, http.StatusBadRequest, fmt.Errorf("max redirect count is %d", h.Max))
 		fn(w, r)
 
 		return
@@ -2,20 +2,27 @@ package httphandler
 
 import (
 	"bytes"
-	"encoding/base64"
-	"encoding/json"
 	"io"
 	"log"
-	"mime/multipart"
 	"net"
 	"net/http"
 	"net/url"
-	"strings"
+	"strconv"
+	"time"
+
+	"github.com/marsom/serverbin/internal/core"
+	"github.com/marsom/serverbin/internal/forwarded"
+	"github.com/marsom/serverbin/internal/inspect"
+	"github.com/marsom/serverbin/internal/tracing"
 )
 
-type origin struct {
-	ClientIP string `json:"client-ip,omitempty"`
-	RemoteIP string `json:"remote-ip,omitempty"`
+type connection struct {
+	ID           uint64 `json:"id"`
+	Requests     int64  `json:"requests"`
+	Age          string `json:"age"`
+	LocalAddress string `json:"local-address,omitempty"`
+	LocalPort    int    `json:"local-port,omitempty"`
+	Reused       bool   `json:"reused"`
 }
 
 type cookie struct {
@@ -24,94 +31,88 @@ type cookie struct {
 	Value string `json:"value,omitempty"`
 }
 
-type Payload struct {
-	Base64 string      `json:"base64,omitempty"`
-	Json   interface{} `json:"json,omitempty"`
+type response struct {
+	Schema     string           `json:"schema"`
+	Errors     []string         `json:"errors,omitempty"`
+	Method     string           `json:"method,omitempty"`
+	URL        string           `json:"url,omitempty"`
+	Headers    http.Header      `json:"headers,omitempty"`
+	Cookies    []cookie         `json:"cookies,omitempty"`
+	Form       url.Values       `json:"form,omitempty"`
+	Payload    *inspect.Payload `json:"payload,omitempty"`
+	Origin     inspect.Origin   `json:"origin,omitempty"`
+	Connection *connection      `json:"connection,omitempty"`
+	Server     *core.Identity   `json:"server,omitempty"`
+	Trace      *tracing.Trace   `json:"trace,omitempty"`
+	Upstream   *upstream        `json:"upstream,omitempty"`
 }
 
-type multiPart struct {
-	*Payload
-	Name     string `json:"name,omitempty"`
-	FileName string `json:"filename,omitempty"`
+// ClientIP returns the ip of the client, forwarded headers are used if the remote address is trusted
+func ClientIP(config Server, r *http.Request) string {
+	return newOrigin(config, r).ClientIP
 }
 
-type response struct {
-	Errors    []string     `json:"errors,omitempty"`
-	Headers   http.Header  `json:"headers,omitempty"`
-	Cookies   []cookie     `json:"cookies,omitempty"`
-	Multipart []*multiPart `json:"multiPart,omitempty"`
-	Form      url.Values   `json:"form,omitempty"`
-	Payload   *Payload     `json:"payload,omitempty"`
-	Origin    origin       `json:"origin,omitempty"`
-}
+func newOrigin(config Server, r *http.Request) inspect.Origin {
+	data := inspect.Origin{}
 
-func newOrigin(config Server, r *http.Request) origin {
-	data := origin{}
+	// unix domain sockets
+	if conn, ok := core.ConnFromContext(r.Context()); ok {
+		if cred, err := core.GetPeerCredentials(conn); err == nil {
+			data.PeerCredentials = cred
+		}
+	}
 
 	if remoteAddr, _, err := net.SplitHostPort(r.RemoteAddr); err == nil && remoteAddr != "" {
 		data.RemoteIP = remoteAddr
-		data.ClientIP = remoteAddr
-
-		// X-Forwarded-For: <client>, <proxy1>, <proxy2>
-		// X-Forwarded-For: 192.0.2.43, "[2001:db8:cafe::17]"
-		if header := r.Header.Get("X-Forwarded-For"); header != "" {
-			if clientIP := net.ParseIP(strings.Trim(strings.Split(header, ",")[0], "\"[]")); clientIP != nil {
-				if remoteIp := net.ParseIP(remoteAddr); remoteIp != nil {
-					for _, network := range config.TrustedAddresses {
-						if network.Contains(remoteIp) {
-							data.ClientIP = clientIP.String()
-							break
-						}
-					}
-				}
-			}
-		}
 
-		// Forwarded: for=192.0.2.43, for="[2001:db8:cafe::17]"
-		// Forwarded: for=123.34.567.89
-		// Forwarded: for=12.34.56.78, for=23.45.67.89;secret=egah2CGj55fSJFs, for=10.1.2.3
-		if header := r.Header.Get("Forwarded"); header != "" {
-			for _, part := range strings.Split(header, ",") {
-				part := strings.TrimSpace(part)
-
-				if strings.HasPrefix(part, "for=") {
-					if clientIP := net.ParseIP(strings.Trim(strings.Split(strings.TrimPrefix(part, "for="), ";")[0], "\"[]")); clientIP != nil {
-						data.ClientIP = clientIP.String()
-						break
-					}
-				}
-			}
+		// walk the proxy chain of the forwarded headers from right to left
+		result := forwarded.Resolve(remoteAddr, r.Header, config.TrustedAddresses, config.forwardedHeaders())
+		data.ClientIP = result.ClientIP
 
+		if result.Forwarded != nil || result.XForwardedFor != nil || result.XRealIP != "" || result.Errors != nil {
+			data.Forwarded = result
 		}
 	}
 
 	return data
 }
 
-func newPayload(data []byte) *Payload {
-	if len(data) > 0 {
-		p := &Payload{
-			Base64: base64.StdEncoding.EncodeToString(data),
-		}
+func newConnection(r *http.Request) *connection {
+	conn, ok := core.ConnectionFromContext(r.Context())
+	if !ok {
+		return nil
+	}
 
-		var jsonData interface{}
+	data := &connection{
+		ID:       conn.ID,
+		Requests: conn.Requests(),
+		Age:      time.Since(conn.Created).Round(time.Microsecond).String(),
+		Reused:   conn.Requests() > 1,
+	}
 
-		if err := json.Unmarshal(data, &jsonData); err == nil {
-			p.Json = jsonData
-		}
+	if addr := conn.LocalAddr(); addr != nil {
+		data.LocalAddress = addr.String()
 
-		return p
+		if host, port, err := net.SplitHostPort(addr.String()); err == nil {
+			data.LocalAddress = host
+			data.LocalPort, _ = strconv.Atoi(port)
+		}
 	}
 
-	return nil
+	return data
 }
 
 func newResponse(config Server, r *http.Request, errs ...error) *response {
 	resp := response{
-		Headers:   r.Header,
-		Multipart: []*multiPart{},
-		Origin:    newOrigin(config, r),
-		Errors:    nil,
+		Schema:     inspect.Schema,
+		Headers:    r.Header,
+		Origin:     newOrigin(config, r),
+		Connection: newConnection(r),
+		Server:     config.Identity,
+		Trace:      tracing.FromRequest(r),
+		Errors:     inspect.Errors(errs...),
+		Method:     r.Method,
+		URL:        r.URL.RequestURI(),
 	}
 
 	// cookies
@@ -127,56 +128,7 @@ func newResponse(config Server, r *http.Request, errs ...error) *response {
 		}
 	}
 
-	// errors
-	if len(errs) > 0 {
-		for _, err := range errs {
-			if err != nil {
-				resp.Errors = append(resp.Errors, err.Error())
-			}
-		}
-	}
-
-	// multiPart/form-data
-	reader, err := r.MultipartReader()
-	if err == nil {
-		for {
-			part, err := reader.NextPart()
-			if err == io.EOF {
-				break
-			}
-
-			if err != nil {
-				log.Printf("could not get next part: %s", err)
-				continue
-			}
-
-			// anonymous function to call defer inside loop
-			func() {
-				defer func(part *multipart.Part) {
-					if err := part.Close(); err != nil {
-						log.Printf("failed closing multipart '%s': %s", part.FormName(), err)
-					}
-				}(part)
-
-				buf := &bytes.Buffer{}
-
-				if _, err = io.Copy(buf, part); err == nil {
-					resp.Multipart = append(resp.Multipart, &multiPart{
-						Payload:  newPayload(buf.Bytes()),
-						Name:     part.FormName(),
-						FileName: part.FileName(),
-					})
-				}
-			}()
-		}
-	}
-
-	// application/x-www-form-urlencoded
-	if err := r.ParseForm(); err == nil {
-		resp.Form = r.Form
-	}
-
-	// Payload
+	// payload
 	body, err := io.ReadAll(r.Body)
 	defer func(r io.Closer) {
 		if err := r.Close(); err != nil {
@@ -184,8 +136,17 @@ func newResponse(config Server, r *http.Request, errs ...error) *response {
 		}
 	}(r.Body)
 
-	if err == nil {
-		resp.Payload = newPayload(body)
+	if err != nil {
+		resp.Errors = append(resp.Errors, "could not read request body: "+err.Error())
+	} else {
+		resp.Payload = inspect.Inspect(body, r.Header.Get("Content-Type"))
+	}
+
+	// query parameters and application/x-www-form-urlencoded
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err := r.ParseForm(); err == nil {
+		resp.Form = r.Form
 	}
 
 	return &resp
@@ -2,16 +2,21 @@ package httphandler
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
 	"strings"
 	"testing"
 
+	"github.com/marsom/serverbin/internal/core"
+	"github.com/marsom/serverbin/internal/inspect"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -49,13 +54,15 @@ var responseTests = []responseTest{
 			header: nil,
 		},
 		response: response{
+			Schema:    inspect.Schema,
 			Errors:    nil,
+			Method:    "GET",
+			URL:       "/foo",
 			Headers:   nil,
 			Cookies:   nil,
-			Multipart: nil,
 			Form:      nil,
 			Payload:   nil,
-			Origin: origin{
+			Origin: inspect.Origin{
 				ClientIP: "192.0.2.1",
 				RemoteIP: "192.0.2.1",
 			},
@@ -71,13 +78,15 @@ var responseTests = []responseTest{
 			header: nil,
 		},
 		response: response{
+			Schema:    inspect.Schema,
 			Errors:    nil,
+			Method:    "PUT",
+			URL:       "/foo",
 			Headers:   nil,
 			Cookies:   nil,
-			Multipart: nil,
 			Form:      nil,
 			Payload:   nil,
-			Origin: origin{
+			Origin: inspect.Origin{
 				ClientIP: "192.0.2.1",
 				RemoteIP: "192.0.2.1",
 			},
@@ -93,16 +102,20 @@ var responseTests = []responseTest{
 			header: nil,
 		},
 		response: response{
+			Schema:    inspect.Schema,
 			Errors:    nil,
+			Method:    "PUT",
+			URL:       "/foo",
 			Headers:   nil,
 			Cookies:   nil,
-			Multipart: nil,
 			Form:      nil,
-			Payload: &Payload{
+			Payload: &inspect.Payload{
+				Type:   inspect.TypeText,
+				Size:   4,
 				Base64: base64.StdEncoding.EncodeToString([]byte("test")),
-				Json:   nil,
+				Text:   "test",
 			},
-			Origin: origin{
+			Origin: inspect.Origin{
 				ClientIP: "192.0.2.1",
 				RemoteIP: "192.0.2.1",
 			},
@@ -118,16 +131,20 @@ var responseTests = []responseTest{
 			header: nil,
 		},
 		response: response{
+			Schema:    inspect.Schema,
 			Errors:    nil,
+			Method:    "PUT",
+			URL:       "/foo",
 			Headers:   nil,
 			Cookies:   nil,
-			Multipart: nil,
 			Form:      nil,
-			Payload: &Payload{
+			Payload: &inspect.Payload{
+				Type:   inspect.TypeText,
+				Size:   4,
 				Base64: base64.StdEncoding.EncodeToString([]byte("test")),
-				Json:   nil,
+				Text:   "test",
 			},
-			Origin: origin{
+			Origin: inspect.Origin{
 				ClientIP: "192.0.2.1",
 				RemoteIP: "192.0.2.1",
 			},
@@ -172,6 +189,8 @@ func TestMultipartRequest(t *testing.T) {
 
 	mw.Close()
 
+	data := append([]byte(nil), b.Bytes()...)
+
 	req := httptest.NewRequest("PUT", "http://localhost/foo", &b)
 	req.Header.Set("Content-Type", mw.FormDataContentType())
 
@@ -188,32 +207,43 @@ func TestMultipartRequest(t *testing.T) {
 	assert.Nil(t, err)
 
 	expected := response{
+		Schema:    inspect.Schema,
 		Errors:    nil,
+		Method:    "PUT",
+		URL:       "/foo",
 		Headers:   http.Header{
 			"Content-Type": []string{mw.FormDataContentType()},
 		},
 		Cookies:   nil,
-		Multipart: []*multiPart{
-			{
-				Payload: &Payload{
-					Base64: base64.StdEncoding.EncodeToString([]byte("test1")),
-					Json:   nil,
+		Form:      nil,
+		Payload: &inspect.Payload{
+			Type:   inspect.TypeMultipart,
+			Size:   len(data),
+			Base64: base64.StdEncoding.EncodeToString(data),
+			Multipart: []*inspect.Part{
+				{
+					Name:    "a",
+					Headers: textproto.MIMEHeader{"Content-Disposition": {`form-data; name="a"`}},
+					Payload: &inspect.Payload{
+						Type:   inspect.TypeText,
+						Size:   5,
+						Base64: base64.StdEncoding.EncodeToString([]byte("test1")),
+						Text:   "test1",
+					},
 				},
-				Name:     "a",
-				FileName: "",
-			},
-			{
-				Payload: &Payload{
-					Base64: base64.StdEncoding.EncodeToString([]byte("test2")),
-					Json:   nil,
+				{
+					Name:    "b",
+					Headers: textproto.MIMEHeader{"Content-Disposition": {`form-data; name="b"`}},
+					Payload: &inspect.Payload{
+						Type:   inspect.TypeText,
+						Size:   5,
+						Base64: base64.StdEncoding.EncodeToString([]byte("test2")),
+						Text:   "test2",
+					},
 				},
-				Name:     "b",
-				FileName: "",
 			},
 		},
-		Form:      nil,
-		Payload:   nil,
-		Origin: origin{
+		Origin: inspect.Origin{
 			ClientIP: "192.0.2.1",
 			RemoteIP: "192.0.2.1",
 		},
@@ -221,3 +251,34 @@ func TestMultipartRequest(t *testing.T) {
 
 	assert.Equal(t, expected, r)
 }
+
+type testConn struct {
+	net.Conn
+}
+
+func (c testConn) LocalAddr() net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 8080}
+}
+
+func TestResponseConnection(t *testing.T) {
+	ctx := core.WithConn(context.Background(), testConn{})
+	conn, ok := core.ConnectionFromContext(ctx)
+	require.True(t, ok)
+
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+
+	conn.NextRequest()
+	c := newConnection(r)
+	assert.Equal(t, conn.ID, c.ID)
+	assert.Equal(t, int64(1), c.Requests)
+	assert.Equal(t, "192.0.2.10", c.LocalAddress)
+	assert.Equal(t, 8080, c.LocalPort)
+	assert.False(t, c.Reused)
+
+	conn.NextRequest()
+	c = newConnection(r)
+	assert.Equal(t, int64(2), c.Requests)
+	assert.True(t, c.Reused)
+
+	assert.Nil(t, newConnection(httptest.NewRequest("GET", "/", nil)))
+}
@@ -0,0 +1,55 @@
+package httphandler
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Rule configuration overrides the response of matching requests
+type Rule struct {
+	// Path prefix relative to the context path
+	Path string
+	// Methods to match, all methods match if empty
+	Methods []string
+	// Status code to return instead of the handler response, the handler response is used if 0
+	Status int
+	// Headers added to the response
+	Headers map[string]string
+}
+
+func (rule Rule) matches(root string, r *http.Request) bool {
+	if len(rule.Methods) > 0 && !containsToken(rule.Methods, r.Method) {
+		return false
+	}
+
+	prefix := path.Join(root, rule.Path)
+
+	return r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, strings.TrimSuffix(prefix, "/")+"/")
+}
+
+// rulesHandler applies the first matching rule
+func rulesHandler(config Config, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, rule := range config.Rules {
+			if !rule.matches(config.Path, r) {
+				continue
+			}
+
+			for key, value := range rule.Headers {
+				w.Header().Set(key, value)
+			}
+
+			if rule.Status != 0 {
+				fn := format(config.Server, r, rule.Status, nil)
+				fn(w, r)
+
+				return
+			}
+
+			break
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
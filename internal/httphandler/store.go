@@ -0,0 +1,555 @@
+package httphandler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+
+	// idempotencyKeyTTL after which an idempotency key can be used for another request
+	idempotencyKeyTTL = 24 * time.Hour
+)
+
+var errStoreFull = errors.New("max keys of the store reached")
+
+// Store configuration of the in memory resource store
+type Store struct {
+	// MaxKeys of the resources and of the idempotency keys
+	MaxKeys int
+}
+
+var _ methodsHandler = (*storeHandler)(nil)
+
+// storeHandler is a json resource store, /store is the collection and /store/{key} a resource
+type storeHandler struct {
+	Server
+	Store
+	Pattern string
+	store   *store
+}
+
+func (h storeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := h.key(r)
+	if key == "" {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			h.list(w, r)
+		case http.MethodPost:
+			h.create(w, r)
+		default:
+			allow(w, h.allowedMethods(r, w.Header())...)
+			h.fail(w, r, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		}
+
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.get(w, r, key)
+	case http.MethodPut:
+		h.put(w, r, key)
+	case http.MethodPatch:
+		h.patch(w, r, key)
+	case http.MethodDelete:
+		h.delete(w, r, key)
+	default:
+		allow(w, h.allowedMethods(r, w.Header())...)
+		h.fail(w, r, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+	}
+}
+
+func (h storeHandler) allowedMethods(r *http.Request, header http.Header) []string {
+	if h.key(r) == "" {
+		return []string{"GET", "HEAD", "POST"}
+	}
+
+	header.Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+
+	return []string{"GET", "HEAD", "PUT", "PATCH", "DELETE"}
+}
+
+// key of the item, empty for the collection
+func (h storeHandler) key(r *http.Request) string {
+	return strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(h.Pattern, "/")), "/")
+}
+
+// fail writes an error response, the body is restored because it is part of the response
+func (h storeHandler) fail(w http.ResponseWriter, r *http.Request, code int, err error, body ...byte) {
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	fn := format(h.Server, r, code, err)
+	fn(w, r)
+}
+
+func (h storeHandler) list(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", defaultPageLimit)
+	if err != nil || limit <= 0 || limit > maxPageLimit {
+		h.fail(w, r, http.StatusBadRequest, fmt.Errorf("limit %q must be a number between 1 and %d", r.URL.Query().Get("limit"), maxPageLimit))
+		return
+	}
+
+	cursor := r.URL.Query().Get("cursor")
+	page, next, total := h.store.list(cursor, limit)
+
+	type item struct {
+		Key   string          `json:"key"`
+		ETag  string          `json:"etag"`
+		Value json.RawMessage `json:"value"`
+	}
+
+	body := struct {
+		Items []item `json:"items"`
+		Next  string `json:"next,omitempty"`
+	}{
+		Items: make([]item, 0, len(page)),
+		Next:  next,
+	}
+
+	for _, e := range page {
+		body.Items = append(body.Items, item{Key: e.key, ETag: e.etag, Value: e.value})
+	}
+
+	if next != "" {
+		query := url.Values{"limit": []string{strconv.Itoa(limit)}, "cursor": []string{next}}
+		w.Header().Set("Link", fmt.Sprintf("<%s?%s>; rel=\"next\"", r.URL.Path, query.Encode()))
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	data, err := json.MarshalIndent(body, "", " ")
+	if err != nil {
+		h.fail(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, append(data, '\n'))
+}
+
+// create a resource with a generated key, a repeated request with the same Idempotency-Key is replayed
+func (h storeHandler) create(w http.ResponseWriter, r *http.Request) {
+	body, value, ok := h.readValue(w, r)
+	if !ok {
+		return
+	}
+
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+
+	e, replayed, err := h.store.create(idempotencyKey, body, value, h.MaxKeys)
+	if err != nil {
+		code := http.StatusInsufficientStorage
+		if !errors.Is(err, errStoreFull) {
+			code = http.StatusUnprocessableEntity
+		}
+
+		h.fail(w, r, code, err, body...)
+
+		return
+	}
+
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+
+	w.Header().Set("Location", strings.TrimSuffix(h.Pattern, "/")+"/"+url.PathEscape(e.key))
+	h.writeEntry(w, r, http.StatusCreated, e)
+}
+
+func (h storeHandler) get(w http.ResponseWriter, r *http.Request, key string) {
+	e := h.store.get(key)
+	if e == nil {
+		h.fail(w, r, http.StatusNotFound, fmt.Errorf("key %q does not exist", key))
+		return
+	}
+
+	if matchETag(r.Header.Get("If-None-Match"), e, true) {
+		w.Header().Set("ETag", e.etag)
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	h.writeEntry(w, r, http.StatusOK, e)
+}
+
+// put creates or replaces a resource
+func (h storeHandler) put(w http.ResponseWriter, r *http.Request, key string) {
+	body, value, ok := h.readValue(w, r)
+	if !ok {
+		return
+	}
+
+	e, created, err := h.store.update(key, h.MaxKeys, func(current *entry) ([]byte, error) {
+		if err := precondition(r, current); err != nil {
+			return nil, err
+		}
+
+		return value, nil
+	})
+	if err != nil {
+		h.fail(w, r, errorCode(err), err, body...)
+		return
+	}
+
+	if created {
+		w.Header().Set("Location", r.URL.Path)
+		h.writeEntry(w, r, http.StatusCreated, e)
+
+		return
+	}
+
+	h.writeEntry(w, r, http.StatusOK, e)
+}
+
+// patch a resource with a json merge patch or a json patch
+func (h storeHandler) patch(w http.ResponseWriter, r *http.Request, key string) {
+	w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+
+	contentType := strings.TrimSpace(strings.SplitN(r.Header.Get("Content-Type"), ";", 2)[0])
+	if contentType != mergePatchType && contentType != jsonPatchType {
+		h.fail(w, r, http.StatusUnsupportedMediaType, fmt.Errorf("content type %q is not supported", contentType))
+		return
+	}
+
+	body, patch, ok := h.readValue(w, r)
+	if !ok {
+		return
+	}
+
+	e, _, err := h.store.update(key, h.MaxKeys, func(current *entry) ([]byte, error) {
+		if current == nil {
+			return nil, errNotFound{key: key}
+		}
+
+		if err := precondition(r, current); err != nil {
+			return nil, err
+		}
+
+		var doc interface{}
+		if err := decodeJSON(current.value, &doc); err != nil {
+			return nil, err
+		}
+
+		if contentType == mergePatchType {
+			var p interface{}
+			if err := decodeJSON(patch, &p); err != nil {
+				return nil, err
+			}
+
+			doc = mergePatch(doc, p)
+		} else {
+			var err error
+			if doc, err = jsonPatch(doc, patch); err != nil {
+				return nil, errPatch{err: err}
+			}
+		}
+
+		return json.Marshal(doc)
+	})
+	if err != nil {
+		h.fail(w, r, errorCode(err), err, body...)
+		return
+	}
+
+	h.writeEntry(w, r, http.StatusOK, e)
+}
+
+func (h storeHandler) delete(w http.ResponseWriter, r *http.Request, key string) {
+	if err := h.store.delete(key, func(current *entry) error {
+		if current == nil {
+			return errNotFound{key: key}
+		}
+
+		return precondition(r, current)
+	}); err != nil {
+		h.fail(w, r, errorCode(err), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readValue reads the request body which must be a json document
+func (h storeHandler) readValue(w http.ResponseWriter, r *http.Request) ([]byte, []byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, h.MaxRequestBody))
+	if err != nil {
+		h.fail(w, r, http.StatusRequestEntityTooLarge, errors.New("could not read request body"), body...)
+		return nil, nil, false
+	}
+
+	var value bytes.Buffer
+	if err := json.Compact(&value, body); err != nil {
+		h.fail(w, r, http.StatusBadRequest, fmt.Errorf("request body is not valid json: %w", err), body...)
+		return nil, nil, false
+	}
+
+	return body, value.Bytes(), true
+}
+
+func (h storeHandler) writeEntry(w http.ResponseWriter, r *http.Request, code int, e *entry) {
+	w.Header().Set("ETag", e.etag)
+	w.Header().Set("Last-Modified", e.modified.UTC().Format(http.TimeFormat))
+
+	writeJSON(w, r, code, append(e.value, '\n'))
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, code int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(code)
+
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
+
+type errNotFound struct {
+	key string
+}
+
+func (e errNotFound) Error() string {
+	return fmt.Sprintf("key %q does not exist", e.key)
+}
+
+type errPrecondition struct {
+	header string
+}
+
+func (e errPrecondition) Error() string {
+	return fmt.Sprintf("precondition %s failed", e.header)
+}
+
+type errPatch struct {
+	err error
+}
+
+func (e errPatch) Error() string {
+	return e.err.Error()
+}
+
+func errorCode(err error) int {
+	switch err.(type) {
+	case errNotFound:
+		return http.StatusNotFound
+	case errPrecondition:
+		return http.StatusPreconditionFailed
+	case errPatch:
+		return http.StatusUnprocessableEntity
+	}
+
+	if errors.Is(err, errStoreFull) {
+		return http.StatusInsufficientStorage
+	}
+
+	return http.StatusBadRequest
+}
+
+// precondition checks the If-Match and If-None-Match headers of a write
+func precondition(r *http.Request, current *entry) error {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !matchETag(ifMatch, current, false) {
+		return errPrecondition{header: "If-Match"}
+	}
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && matchETag(ifNoneMatch, current, true) {
+		return errPrecondition{header: "If-None-Match"}
+	}
+
+	return nil
+}
+
+// matchETag returns true if the entry exists and matches one of the etags or *. The weak comparison of If-None-Match
+// ignores the W/ prefix, weak etags never match with the strong comparison of If-Match (RFC 7232).
+func matchETag(header string, e *entry, weak bool) bool {
+	if e == nil || header == "" {
+		return false
+	}
+
+	for _, etag := range strings.Split(header, ",") {
+		etag = strings.TrimSpace(etag)
+		if weak {
+			etag = strings.TrimPrefix(etag, "W/")
+		}
+
+		if etag == "*" || etag == e.etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// store of the json resources and the responses of the idempotency keys
+type store struct {
+	mu          sync.Mutex
+	entries     map[string]*entry
+	idempotency map[string]idempotent
+	sequence    int
+}
+
+type entry struct {
+	key      string
+	value    []byte
+	etag     string
+	modified time.Time
+}
+
+// idempotent is the outcome of a create request
+type idempotent struct {
+	fingerprint string
+	entry       *entry
+	created     time.Time
+}
+
+func newStore() *store {
+	return &store{
+		entries:     make(map[string]*entry),
+		idempotency: make(map[string]idempotent),
+	}
+}
+
+func newEntry(key string, value []byte) *entry {
+	sum := sha256.Sum256(value)
+
+	return &entry{
+		key:      key,
+		value:    value,
+		etag:     `"` + hex.EncodeToString(sum[:8]) + `"`,
+		modified: time.Now(),
+	}
+}
+
+func (s *store) get(key string) *entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.entries[key]
+}
+
+// list a page of the entries in the order of the keys after the cursor and return the next cursor
+func (s *store) list(cursor string, limit int) ([]*entry, string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.entries))
+	for key := range s.entries {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	start := sort.SearchStrings(keys, cursor)
+	if start < len(keys) && keys[start] == cursor {
+		start++
+	}
+
+	var page []*entry
+	for _, key := range keys[start:] {
+		if len(page) == limit {
+			return page, page[len(page)-1].key, len(keys)
+		}
+
+		page = append(page, s.entries[key])
+	}
+
+	return page, "", len(keys)
+}
+
+// create an entry with a generated key, the entry of a known idempotency key is returned again
+func (s *store) create(idempotencyKey string, body, value []byte, maxKeys int) (*entry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sum := sha256.Sum256(body)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	if idempotencyKey != "" {
+		if i, ok := s.idempotency[idempotencyKey]; ok && time.Since(i.created) < idempotencyKeyTTL {
+			if i.fingerprint != fingerprint {
+				return nil, false, fmt.Errorf("idempotency key %q was used with another request body", idempotencyKey)
+			}
+
+			return i.entry, true, nil
+		}
+	}
+
+	if len(s.entries) >= maxKeys {
+		return nil, false, errStoreFull
+	}
+
+	var key string
+	for key == "" || s.entries[key] != nil {
+		s.sequence++
+		key = strconv.Itoa(s.sequence)
+	}
+
+	e := newEntry(key, value)
+	s.entries[key] = e
+
+	if idempotencyKey != "" {
+		s.idempotency[idempotencyKey] = idempotent{fingerprint: fingerprint, entry: e, created: time.Now()}
+	}
+
+	return e, false, nil
+}
+
+// update an entry with the value of fn which gets the current entry or nil, true is returned if the entry was created
+func (s *store) update(key string, maxKeys int, fn func(current *entry) ([]byte, error)) (*entry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := s.entries[key]
+
+	// preconditions and missing entries are reported before a full store
+	value, err := fn(current)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if current == nil && len(s.entries) >= maxKeys {
+		return nil, false, errStoreFull
+	}
+
+	e := newEntry(key, value)
+	s.entries[key] = e
+
+	return e, current == nil, nil
+}
+
+// delete an entry and its idempotency key if fn which gets the current entry or nil returns no error
+func (s *store) delete(key string, fn func(current *entry) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := fn(s.entries[key]); err != nil {
+		return err
+	}
+
+	delete(s.entries, key)
+
+	// the idempotency keys are bound by the max keys of the entries
+	for idempotencyKey, i := range s.idempotency {
+		if i.entry.key == key {
+			delete(s.idempotency, idempotencyKey)
+		}
+	}
+
+	return nil
+}
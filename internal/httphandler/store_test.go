@@ -0,0 +1,232 @@
+package httphandler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func storeMux(maxKeys int) *http.ServeMux {
+	mux := http.NewServeMux()
+	RegisterHandlers(mux, Config{
+		Path:   "/api",
+		Server: Server{MaxRequestBody: 1024},
+		Store:  &Store{MaxKeys: maxKeys},
+	})
+
+	return mux
+}
+
+func send(mux *http.ServeMux, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestStoreConditionalWrites(t *testing.T) {
+	mux := storeMux(10)
+
+	w := send(mux, "PUT", "http://localhost/api/store/a", `{"name": "a"}`, nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `{"name":"a"}`+"\n", w.Body.String())
+
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// create only
+	w = send(mux, "PUT", "http://localhost/api/store/a", `{}`, http.Header{"If-None-Match": []string{"*"}})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = send(mux, "GET", "http://localhost/api/store/a", "", http.Header{"If-None-Match": []string{etag}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// If-Match uses the strong comparison
+	w = send(mux, "PUT", "http://localhost/api/store/a", `{"name": "b"}`, http.Header{"If-Match": []string{"W/" + etag}})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = send(mux, "GET", "http://localhost/api/store/a", "", http.Header{"If-None-Match": []string{"W/" + etag}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = send(mux, "PUT", "http://localhost/api/store/a", `{"name": "b"}`, http.Header{"If-Match": []string{etag}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	// lost update
+	w = send(mux, "PUT", "http://localhost/api/store/a", `{"name": "c"}`, http.Header{"If-Match": []string{etag}})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = send(mux, "DELETE", "http://localhost/api/store/a", "", http.Header{"If-Match": []string{etag}})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = send(mux, "DELETE", "http://localhost/api/store/a", "", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = send(mux, "GET", "http://localhost/api/store/a", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = send(mux, "PUT", "http://localhost/api/store/a", `{`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestStoreIdempotency(t *testing.T) {
+	mux := storeMux(10)
+	key := http.Header{"Idempotency-Key": []string{"k1"}}
+
+	first := send(mux, "POST", "http://localhost/api/store", `{"a":1}`, key)
+	require.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, "/api/store/1", first.Header().Get("Location"))
+
+	second := send(mux, "POST", "http://localhost/api/store", `{"a":1}`, key)
+	require.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, first.Header().Get("Location"), second.Header().Get("Location"))
+
+	w := send(mux, "POST", "http://localhost/api/store", `{"a":2}`, key)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	w = send(mux, "POST", "http://localhost/api/store", `{"a":1}`, nil)
+	assert.Equal(t, "/api/store/2", w.Header().Get("Location"))
+}
+
+func TestStoreIdempotencyKeys(t *testing.T) {
+	mux := storeMux(2)
+
+	for i := 0; i < 4; i++ {
+		key := http.Header{"Idempotency-Key": []string{fmt.Sprintf("k%d", i)}}
+
+		w := send(mux, "POST", "http://localhost/api/store", `{}`, key)
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		// the idempotency key is removed with the resource
+		require.Equal(t, http.StatusNoContent, send(mux, "DELETE", "http://localhost"+w.Header().Get("Location"), "", nil).Code)
+	}
+
+	for i := 0; i < 2; i++ {
+		key := http.Header{"Idempotency-Key": []string{fmt.Sprintf("k%d", i)}}
+		require.Equal(t, http.StatusCreated, send(mux, "POST", "http://localhost/api/store", `{"a":1}`, key).Code)
+	}
+
+	w := send(mux, "POST", "http://localhost/api/store", `{}`, http.Header{"Idempotency-Key": []string{"k2"}})
+	assert.Equal(t, http.StatusInsufficientStorage, w.Code)
+
+	// replays are possible in a full store
+	w = send(mux, "POST", "http://localhost/api/store", `{"a":1}`, http.Header{"Idempotency-Key": []string{"k0"}})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+}
+
+func TestStorePatch(t *testing.T) {
+	mux := storeMux(10)
+	send(mux, "PUT", "http://localhost/api/store/a", `{"a":1,"b":{"c":2},"l":[1,2]}`, nil)
+
+	merge := http.Header{"Content-Type": []string{mergePatchType}}
+	w := send(mux, "PATCH", "http://localhost/api/store/a", `{"a":null,"b":{"d":3}}`, merge)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"b":{"c":2,"d":3},"l":[1,2]}`, w.Body.String())
+
+	patch := http.Header{"Content-Type": []string{jsonPatchType}}
+	w = send(mux, "PATCH", "http://localhost/api/store/a", `[
+		{"op":"add","path":"/l/1","value":5},
+		{"op":"remove","path":"/l/0"},
+		{"op":"move","from":"/b/c","path":"/c"},
+		{"op":"copy","from":"/c","path":"/b/e"},
+		{"op":"replace","path":"/b/d","value":"x"},
+		{"op":"test","path":"/l","value":[5,2]}
+	]`, patch)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"b":{"d":"x","e":2},"c":2,"l":[5,2]}`, w.Body.String())
+
+	// a failed test leaves the resource unchanged
+	w = send(mux, "PATCH", "http://localhost/api/store/a", `[{"op":"remove","path":"/c"},{"op":"test","path":"/l/0","value":1}]`, patch)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	w = send(mux, "GET", "http://localhost/api/store/a", "", nil)
+	assert.JSONEq(t, `{"b":{"d":"x","e":2},"c":2,"l":[5,2]}`, w.Body.String())
+
+	w = send(mux, "PATCH", "http://localhost/api/store/a", `{}`, http.Header{"Content-Type": []string{"application/json"}})
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.Equal(t, mergePatchType+", "+jsonPatchType, w.Header().Get("Accept-Patch"))
+
+	w = send(mux, "PATCH", "http://localhost/api/store/b", `{}`, merge)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// null values and the root
+	w = send(mux, "PATCH", "http://localhost/api/store/a", `[
+		{"op":"add","path":"/n","value":null},
+		{"op":"test","path":"/n","value":null},
+		{"op":"replace","path":"/c","value":null}
+	]`, patch)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"b":{"d":"x","e":2},"c":null,"l":[5,2],"n":null}`, w.Body.String())
+
+	w = send(mux, "PATCH", "http://localhost/api/store/a", `[{"op":"replace","path":"","value":[1]},{"op":"replace","path":"/0","value":2}]`, patch)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[2]`, w.Body.String())
+
+	w = send(mux, "PATCH", "http://localhost/api/store/a", `[{"op":"add","path":"/-"}]`, patch)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// numbers keep their precision
+	send(mux, "PUT", "http://localhost/api/store/n", `{"a":9007199254740993,"b":1.5}`, nil)
+
+	w = send(mux, "PATCH", "http://localhost/api/store/n", `{"c":9007199254740995}`, merge)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"a":9007199254740993,"b":1.5,"c":9007199254740995}`+"\n", w.Body.String())
+
+	w = send(mux, "PATCH", "http://localhost/api/store/n", `[{"op":"test","path":"/a","value":9007199254740993},{"op":"replace","path":"/b","value":9007199254740997}]`, patch)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"a":9007199254740993,"b":9007199254740997,"c":9007199254740995}`+"\n", w.Body.String())
+}
+
+func TestStoreList(t *testing.T) {
+	mux := storeMux(3)
+
+	for _, key := range []string{"c", "a", "b"} {
+		require.Equal(t, http.StatusCreated, send(mux, "PUT", "http://localhost/api/store/"+key, `"`+key+`"`, nil).Code)
+	}
+
+	w := send(mux, "PUT", "http://localhost/api/store/d", `{}`, nil)
+	assert.Equal(t, http.StatusInsufficientStorage, w.Code)
+
+	// missing keys are reported before a full store
+	w = send(mux, "PATCH", "http://localhost/api/store/d", `{}`, http.Header{"Content-Type": []string{mergePatchType}})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = send(mux, "PUT", "http://localhost/api/store/d", `{}`, http.Header{"If-Match": []string{"*"}})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = send(mux, "GET", "http://localhost/api/store?limit=2", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, `</api/store?cursor=b&limit=2>; rel="next"`, w.Header().Get("Link"))
+	assert.Contains(t, w.Body.String(), `"next": "b"`)
+
+	w = send(mux, "GET", "http://localhost/api/store/?limit=2&cursor=b", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Link"))
+	assert.Contains(t, w.Body.String(), `"key": "c"`)
+	assert.NotContains(t, w.Body.String(), `"next"`)
+
+	w = send(mux, "GET", "http://localhost/api/store?limit=0", "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = send(mux, "DELETE", "http://localhost/api/store", "", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, HEAD, POST, OPTIONS", w.Header().Get("Allow"))
+
+	w = send(mux, "OPTIONS", "http://localhost/api/store/a", "", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, HEAD, PUT, PATCH, DELETE, OPTIONS", w.Header().Get("Allow"))
+	assert.Equal(t, mergePatchType+", "+jsonPatchType, w.Header().Get("Accept-Patch"))
+}
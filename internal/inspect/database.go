@@ -0,0 +1,222 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// PostgreSQL startup message
+type PostgreSQL struct {
+	// Message is one of startup, ssl-request, gssenc-request or cancel-request
+	Message    string            `json:"message"`
+	Version    string            `json:"version,omitempty"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// MySQL handshake response of a client
+type MySQL struct {
+	// Message is one of handshake-response or ssl-request
+	Message      string `json:"message"`
+	Capabilities uint32 `json:"capabilities"`
+	Charset      uint8  `json:"charset"`
+	User         string `json:"user,omitempty"`
+	Database     string `json:"database,omitempty"`
+	AuthPlugin   string `json:"auth-plugin,omitempty"`
+}
+
+const (
+	postgresSSLRequest    = 80877103
+	postgresGSSENCRequest = 80877104
+	postgresCancelRequest = 80877102
+	postgresMaxStartup    = 10000
+
+	mysqlHeaderLength        = 4
+	mysqlSSLRequestLength    = 32
+	mysqlClientConnectWithDB = 0x00000008
+	mysqlClientProtocol41    = 0x00000200
+	mysqlClientSSL           = 0x00000800
+	mysqlClientSecureConn    = 0x00008000
+	mysqlClientPluginAuth    = 0x00080000
+	mysqlClientLenencAuth    = 0x00200000
+)
+
+func isPostgreSQL(data []byte) bool {
+	if len(data) < 8 {
+		return false
+	}
+
+	length := binary.BigEndian.Uint32(data)
+	code := binary.BigEndian.Uint32(data[4:])
+
+	switch {
+	case code == postgresSSLRequest || code == postgresGSSENCRequest:
+		return length == 8
+	case code == postgresCancelRequest:
+		return length == 16
+	case code>>16 == 3:
+		return length > 8 && length <= postgresMaxStartup
+	default:
+		return false
+	}
+}
+
+// parsePostgreSQL decodes the first message of a client connection
+func parsePostgreSQL(data []byte) (*PostgreSQL, error) {
+	length := int(binary.BigEndian.Uint32(data))
+	code := binary.BigEndian.Uint32(data[4:])
+
+	switch code {
+	case postgresSSLRequest:
+		return &PostgreSQL{Message: "ssl-request"}, nil
+	case postgresGSSENCRequest:
+		return &PostgreSQL{Message: "gssenc-request"}, nil
+	case postgresCancelRequest:
+		return &PostgreSQL{Message: "cancel-request"}, nil
+	}
+
+	p := &PostgreSQL{
+		Message: "startup",
+		Version: fmt.Sprintf("%d.%d", code>>16, code&0xffff),
+	}
+
+	var err error
+	if length > len(data) {
+		length, err = len(data), errIncomplete
+	}
+
+	// key\0value\0 pairs terminated by \0
+	fields := bytes.Split(data[8:length], []byte{0})
+	for i := 0; i+1 < len(fields) && len(fields[i]) > 0; i += 2 {
+		if p.Parameters == nil {
+			p.Parameters = map[string]string{}
+		}
+
+		p.Parameters[string(fields[i])] = string(fields[i+1])
+	}
+
+	return p, err
+}
+
+func isMySQL(data []byte) bool {
+	if len(data) < mysqlHeaderLength+mysqlSSLRequestLength {
+		return false
+	}
+
+	// the handshake response is the second packet of the connection
+	if length := int(data[0]) | int(data[1])<<8 | int(data[2])<<16; length < mysqlSSLRequestLength || data[3] != 1 {
+		return false
+	}
+
+	capabilities := binary.LittleEndian.Uint32(data[mysqlHeaderLength:])
+	if capabilities&mysqlClientProtocol41 == 0 {
+		return false
+	}
+
+	// filler of 23 zero bytes after the capabilities, max packet size and charset
+	for _, b := range data[mysqlHeaderLength+9 : mysqlHeaderLength+mysqlSSLRequestLength] {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseMySQL decodes the HandshakeResponse41 or SSLRequest packet
+func parseMySQL(data []byte) (*MySQL, error) {
+	length := int(data[0]) | int(data[1])<<8 | int(data[2])<<16
+	payload := data[mysqlHeaderLength:]
+
+	var err error
+	if length > len(payload) {
+		err = errIncomplete
+	} else {
+		payload = payload[:length]
+	}
+
+	m := &MySQL{
+		Message:      "handshake-response",
+		Capabilities: binary.LittleEndian.Uint32(payload),
+		Charset:      payload[8],
+	}
+
+	if length == mysqlSSLRequestLength && m.Capabilities&mysqlClientSSL != 0 {
+		m.Message = "ssl-request"
+		return m, nil
+	}
+
+	rest := payload[mysqlSSLRequestLength:]
+
+	m.User, rest = nullTerminated(rest)
+
+	// auth response
+	switch {
+	case m.Capabilities&mysqlClientLenencAuth != 0:
+		var n int
+		n, rest = lengthEncoded(rest)
+		rest = skip(rest, n)
+	case m.Capabilities&mysqlClientSecureConn != 0 && len(rest) > 0:
+		rest = skip(rest[1:], int(rest[0]))
+	default:
+		_, rest = nullTerminated(rest)
+	}
+
+	if m.Capabilities&mysqlClientConnectWithDB != 0 {
+		m.Database, rest = nullTerminated(rest)
+	}
+
+	if m.Capabilities&mysqlClientPluginAuth != 0 {
+		m.AuthPlugin, _ = nullTerminated(rest)
+	}
+
+	return m, err
+}
+
+func nullTerminated(data []byte) (string, []byte) {
+	i := bytes.IndexByte(data, 0)
+	if i < 0 {
+		return string(data), nil
+	}
+
+	return string(data[:i]), data[i+1:]
+}
+
+// lengthEncoded decodes a length-encoded integer
+func lengthEncoded(data []byte) (int, []byte) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	var size int
+
+	switch data[0] {
+	case 0xfc:
+		size = 2
+	case 0xfd:
+		size = 3
+	case 0xfe:
+		size = 8
+	default:
+		return int(data[0]), data[1:]
+	}
+
+	if len(data) < size+1 {
+		return 0, nil
+	}
+
+	n := 0
+	for i := size; i > 0; i-- {
+		n = n<<8 | int(data[i])
+	}
+
+	return n, data[size+1:]
+}
+
+func skip(data []byte, n int) []byte {
+	if n < 0 || n > len(data) {
+		return nil
+	}
+
+	return data[n:]
+}
@@ -0,0 +1,196 @@
+package inspect
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DNS query of a message over tcp
+type DNS struct {
+	ID               uint16        `json:"id"`
+	Opcode           string        `json:"opcode"`
+	RecursionDesired bool          `json:"recursion-desired"`
+	Questions        []DNSQuestion `json:"questions,omitempty"`
+}
+
+// DNSQuestion of a query
+type DNSQuestion struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Class string `json:"class"`
+}
+
+const (
+	dnsHeaderLength = 12
+	dnsMaxQuestions = 16
+	dnsMaxPointers  = 16
+)
+
+var errDNSName = errors.New("invalid name")
+
+// isDNS checks for a query with a two byte length prefix
+func isDNS(data []byte) bool {
+	if len(data) < 2+dnsHeaderLength {
+		return false
+	}
+
+	length := int(binary.BigEndian.Uint16(data))
+	msg := data[2:]
+
+	flags := binary.BigEndian.Uint16(msg[2:])
+	questions := binary.BigEndian.Uint16(msg[4:])
+
+	return length >= dnsHeaderLength &&
+		flags&0x8000 == 0 && // query
+		(flags>>11)&0xf <= 5 && // known opcode
+		flags&0x0070 == 0 && // zero bits
+		questions > 0 && questions <= dnsMaxQuestions
+}
+
+// parseDNS decodes the header and the questions of a message
+func parseDNS(msg []byte) (*DNS, error) {
+	flags := binary.BigEndian.Uint16(msg[2:])
+
+	d := &DNS{
+		ID:               binary.BigEndian.Uint16(msg),
+		Opcode:           dnsOpcodeName(int(flags>>11) & 0xf),
+		RecursionDesired: flags&0x0100 != 0,
+	}
+
+	offset := dnsHeaderLength
+
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[4:])); i++ {
+		name, next, err := dnsName(msg, offset)
+		if err != nil {
+			return d, err
+		}
+
+		if next+4 > len(msg) {
+			return d, errIncomplete
+		}
+
+		d.Questions = append(d.Questions, DNSQuestion{
+			Name:  name,
+			Type:  dnsTypeName(binary.BigEndian.Uint16(msg[next:])),
+			Class: dnsClassName(binary.BigEndian.Uint16(msg[next+2:])),
+		})
+
+		offset = next + 4
+	}
+
+	return d, nil
+}
+
+// dnsName decodes a name at offset and returns the offset after the name, compression pointers are followed
+func dnsName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+
+	next := -1
+
+	for pointers := 0; ; {
+		if offset >= len(msg) {
+			return "", 0, errIncomplete
+		}
+
+		length := int(msg[offset])
+
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+
+			return strings.Join(labels, ".") + ".", next, nil
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(msg) {
+				return "", 0, errIncomplete
+			}
+
+			if pointers++; pointers > dnsMaxPointers {
+				return "", 0, errDNSName
+			}
+
+			if next < 0 {
+				next = offset + 2
+			}
+
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3fff)
+		case length&0xc0 != 0:
+			return "", 0, errDNSName
+		default:
+			if offset+1+length > len(msg) {
+				return "", 0, errIncomplete
+			}
+
+			labels = append(labels, string(msg[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+}
+
+func dnsOpcodeName(opcode int) string {
+	switch opcode {
+	case 0:
+		return "QUERY"
+	case 1:
+		return "IQUERY"
+	case 2:
+		return "STATUS"
+	case 4:
+		return "NOTIFY"
+	case 5:
+		return "UPDATE"
+	default:
+		return fmt.Sprint(opcode)
+	}
+}
+
+func dnsTypeName(typ uint16) string {
+	switch typ {
+	case 1:
+		return "A"
+	case 2:
+		return "NS"
+	case 5:
+		return "CNAME"
+	case 6:
+		return "SOA"
+	case 12:
+		return "PTR"
+	case 15:
+		return "MX"
+	case 16:
+		return "TXT"
+	case 28:
+		return "AAAA"
+	case 33:
+		return "SRV"
+	case 64:
+		return "SVCB"
+	case 65:
+		return "HTTPS"
+	case 252:
+		return "AXFR"
+	case 255:
+		return "ANY"
+	case 257:
+		return "CAA"
+	default:
+		return fmt.Sprintf("TYPE%d", typ)
+	}
+}
+
+func dnsClassName(class uint16) string {
+	switch class {
+	case 1:
+		return "IN"
+	case 3:
+		return "CH"
+	case 255:
+		return "ANY"
+	default:
+		return fmt.Sprintf("CLASS%d", class)
+	}
+}
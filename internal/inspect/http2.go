@@ -0,0 +1,124 @@
+package inspect
+
+import (
+	"fmt"
+)
+
+// HTTP2 frames which follow the client connection preface
+type HTTP2 struct {
+	Frames []HTTP2Frame `json:"frames,omitempty"`
+}
+
+// HTTP2Frame header, the settings are decoded for SETTINGS frames
+type HTTP2Frame struct {
+	Type     string            `json:"type"`
+	Flags    uint8             `json:"flags"`
+	StreamID uint32            `json:"stream-id"`
+	Length   int               `json:"length"`
+	Settings map[string]uint32 `json:"settings,omitempty"`
+	// WindowIncrement of WINDOW_UPDATE frames
+	WindowIncrement uint32 `json:"window-increment,omitempty"`
+}
+
+const (
+	http2FrameHeaderLength = 9
+	http2FrameSettings     = 0x4
+	http2FrameWindowUpdate = 0x8
+	http2SettingLength     = 6
+)
+
+// parseHTTP2 decodes the frames after the preface, HEADERS frames are not decompressed
+func parseHTTP2(data []byte) (*HTTP2, error) {
+	h := &HTTP2{}
+
+	for len(data) > 0 {
+		if len(data) < http2FrameHeaderLength {
+			return h, errIncomplete
+		}
+
+		c := &cursor{b: data}
+
+		frame := HTTP2Frame{
+			Length: c.u24(),
+		}
+
+		typ := c.u8()
+		frame.Type = http2FrameName(typ)
+		frame.Flags = c.u8()
+		frame.StreamID = c.u32() & 0x7fffffff
+
+		payload := c.bytes(frame.Length)
+
+		switch {
+		case c.err != nil:
+			h.Frames = append(h.Frames, frame)
+			return h, errIncomplete
+		case typ == http2FrameSettings:
+			settings := &cursor{b: payload}
+			for len(settings.b) >= http2SettingLength {
+				id := settings.u16()
+
+				if frame.Settings == nil {
+					frame.Settings = map[string]uint32{}
+				}
+
+				frame.Settings[http2SettingName(id)] = settings.u32()
+			}
+		case typ == http2FrameWindowUpdate && len(payload) == 4:
+			frame.WindowIncrement = (&cursor{b: payload}).u32() & 0x7fffffff
+		}
+
+		h.Frames = append(h.Frames, frame)
+		data = c.b
+	}
+
+	return h, nil
+}
+
+func http2FrameName(typ uint8) string {
+	switch typ {
+	case 0x0:
+		return "DATA"
+	case 0x1:
+		return "HEADERS"
+	case 0x2:
+		return "PRIORITY"
+	case 0x3:
+		return "RST_STREAM"
+	case http2FrameSettings:
+		return "SETTINGS"
+	case 0x5:
+		return "PUSH_PROMISE"
+	case 0x6:
+		return "PING"
+	case 0x7:
+		return "GOAWAY"
+	case http2FrameWindowUpdate:
+		return "WINDOW_UPDATE"
+	case 0x9:
+		return "CONTINUATION"
+	default:
+		return fmt.Sprintf("0x%02X", typ)
+	}
+}
+
+func http2SettingName(id uint16) string {
+	switch id {
+	case 0x1:
+		return "HEADER_TABLE_SIZE"
+	case 0x2:
+		return "ENABLE_PUSH"
+	case 0x3:
+		return "MAX_CONCURRENT_STREAMS"
+	case 0x4:
+		return "INITIAL_WINDOW_SIZE"
+	case 0x5:
+		return "MAX_FRAME_SIZE"
+	case 0x6:
+		return "MAX_HEADER_LIST_SIZE"
+	case 0x8:
+		return "ENABLE_CONNECT_PROTOCOL"
+	default:
+		return fmt.Sprintf("0x%02X", id)
+	}
+}
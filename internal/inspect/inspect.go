@@ -0,0 +1,305 @@
+// Package inspect decodes the origin and the payload of a request into the schema which is shared by the echo
+// responses of the http, tcp and udp servers.
+package inspect
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/marsom/serverbin/internal/core"
+	"github.com/marsom/serverbin/internal/forwarded"
+	"github.com/marsom/serverbin/internal/proxyprotocol"
+)
+
+// Schema is the version of the echo responses, it changes with incompatible changes only
+const Schema = "serverbin/v1"
+
+// Types of a payload
+const (
+	TypeBinary        = "binary"
+	TypeText          = "text"
+	TypeJSON          = "json"
+	TypeForm          = "form"
+	TypeMultipart     = "multipart"
+	TypeHTTP          = "http"
+	TypeTLS           = "tls"
+	TypeHTTP2         = "http2"
+	TypeSSH           = "ssh"
+	TypeSMTP          = "smtp"
+	TypeRedis         = "redis"
+	TypePostgreSQL    = "postgresql"
+	TypeMySQL         = "mysql"
+	TypeDNS           = "dns"
+	TypeProxyProtocol = "proxy-protocol"
+)
+
+// maxDepth limits the nested payloads, i.e. the multipart body of a http request in a tcp payload
+const maxDepth = 3
+
+// Origin of a request
+type Origin struct {
+	ClientIP        string                `json:"client-ip,omitempty"`
+	RemoteIP        string                `json:"remote-ip,omitempty"`
+	Forwarded       *forwarded.Result     `json:"forwarded,omitempty"`
+	ProxyProtocol   *ProxyProtocol        `json:"proxy-protocol,omitempty"`
+	PeerCredentials *core.PeerCredentials `json:"peer-credentials,omitempty"`
+}
+
+// ProxyProtocol header of a connection
+type ProxyProtocol struct {
+	Version     string `json:"version,omitempty"`
+	Protocol    string `json:"protocol,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+}
+
+// NewProxyProtocol returns the addresses of a proxy protocol header
+func NewProxyProtocol(protocol proxyprotocol.ProxyProtocol) *ProxyProtocol {
+	p := &ProxyProtocol{
+		Version:  protocol.Version(),
+		Protocol: protocol.Protocol(),
+	}
+
+	if v := protocol.Source(); v != nil {
+		p.Source = v.String()
+	}
+
+	if v := protocol.Destination(); v != nil {
+		p.Destination = v.String()
+	}
+
+	return p
+}
+
+// Payload is the decoded body of a http request, a tcp connection or an udp packet
+type Payload struct {
+	// Type is the detected type of the payload
+	Type string `json:"type"`
+	Size int    `json:"size"`
+	// Truncated is set if the payload exceeds the max size of a server
+	Truncated     bool           `json:"truncated,omitempty"`
+	Base64        string         `json:"base64,omitempty"`
+	Text          string         `json:"text,omitempty"`
+	Json          interface{}    `json:"json,omitempty"`
+	Form          url.Values     `json:"form,omitempty"`
+	Multipart     []*Part        `json:"multipart,omitempty"`
+	Http          *HTTP          `json:"http,omitempty"`
+	TLS           *TLS           `json:"tls,omitempty"`
+	HTTP2         *HTTP2         `json:"http2,omitempty"`
+	SSH           *SSH           `json:"ssh,omitempty"`
+	SMTP          *SMTP          `json:"smtp,omitempty"`
+	Redis         *Redis         `json:"redis,omitempty"`
+	PostgreSQL    *PostgreSQL    `json:"postgresql,omitempty"`
+	MySQL         *MySQL         `json:"mysql,omitempty"`
+	DNS           *DNS           `json:"dns,omitempty"`
+	ProxyProtocol *ProxyProtocol `json:"proxy-protocol,omitempty"`
+	Errors        []string       `json:"errors,omitempty"`
+}
+
+// Part of a multipart payload
+type Part struct {
+	Name     string               `json:"name,omitempty"`
+	FileName string               `json:"filename,omitempty"`
+	Headers  textproto.MIMEHeader `json:"headers,omitempty"`
+	Payload  *Payload             `json:"payload,omitempty"`
+}
+
+// HTTP/1.x request
+type HTTP struct {
+	Method  string      `json:"method,omitempty"`
+	URL     string      `json:"url,omitempty"`
+	Proto   string      `json:"proto,omitempty"`
+	Host    string      `json:"host,omitempty"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    *Payload    `json:"body,omitempty"`
+}
+
+// Inspect decodes data, the content type is optional and used for form and multipart payloads. nil is returned for
+// empty data.
+func Inspect(data []byte, contentType string) *Payload {
+	return inspect(data, contentType, 0)
+}
+
+func inspect(data []byte, contentType string, depth int) *Payload {
+	if len(data) == 0 {
+		return nil
+	}
+
+	p := &Payload{
+		Size:   len(data),
+		Base64: base64.StdEncoding.EncodeToString(data),
+	}
+
+	// proxy protocol header which was not consumed by the server
+	if isProxyProtocol(data) {
+		r := proxyprotocol.NewReader(bytes.NewReader(data), true, true)
+
+		rest, err := io.ReadAll(r)
+		if err == nil {
+			err = r.Error()
+		}
+
+		if protocol, ok := r.ProxyProtocol(); ok {
+			p.ProxyProtocol = NewProxyProtocol(protocol)
+			data = rest
+		}
+
+		if err != nil {
+			p.Errors = append(p.Errors, "proxy protocol: "+err.Error())
+		}
+
+		if len(data) == 0 {
+			p.Type = TypeProxyProtocol
+			return p
+		}
+	}
+
+	var jsonData interface{}
+	if err := json.Unmarshal(data, &jsonData); err == nil {
+		p.Json = jsonData
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/") && depth < maxDepth:
+		p.Type = TypeMultipart
+		p.Multipart = p.parseMultipart(data, params["boundary"], depth)
+	case mediaType == "application/x-www-form-urlencoded":
+		p.Type = TypeForm
+
+		form, err := url.ParseQuery(string(data))
+		if err != nil {
+			p.Errors = append(p.Errors, "form: "+err.Error())
+		}
+
+		p.Form = form
+	case p.Json != nil:
+		p.Type = TypeJSON
+	case p.sniff(data):
+	case depth < maxDepth && p.parseHTTP(data, depth):
+		p.Type = TypeHTTP
+	case isText(data):
+		p.Type = TypeText
+		p.Text = string(data)
+	default:
+		p.Type = TypeBinary
+	}
+
+	return p
+}
+
+func (p *Payload) parseMultipart(data []byte, boundary string, depth int) []*Part {
+	if boundary == "" {
+		p.Errors = append(p.Errors, "multipart: boundary is missing")
+		return nil
+	}
+
+	parts := []*Part{}
+
+	reader := multipart.NewReader(bytes.NewReader(data), boundary)
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			p.Errors = append(p.Errors, "multipart: "+err.Error())
+			break
+		}
+
+		body, err := io.ReadAll(part)
+		if err != nil {
+			p.Errors = append(p.Errors, "multipart: "+err.Error())
+		}
+
+		parts = append(parts, &Part{
+			Name:     part.FormName(),
+			FileName: part.FileName(),
+			Headers:  part.Header,
+			Payload:  inspect(body, part.Header.Get("Content-Type"), depth+1),
+		})
+
+		_ = part.Close()
+	}
+
+	return parts
+}
+
+// parseHTTP decodes a HTTP/1.x request, the body is decoded as far as it is present
+func (p *Payload) parseHTTP(data []byte, depth int) bool {
+	r, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return false
+	}
+
+	p.Http = &HTTP{
+		Method:  r.Method,
+		Proto:   r.Proto,
+		Host:    r.Host,
+		Headers: r.Header,
+	}
+
+	if r.URL != nil {
+		p.Http.URL = r.URL.String()
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = errors.New("body is incomplete")
+		}
+
+		p.Errors = append(p.Errors, "http: "+err.Error())
+	}
+
+	p.Http.Body = inspect(body, r.Header.Get("Content-Type"), depth+1)
+
+	return true
+}
+
+func isProxyProtocol(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PROXY ")) || bytes.HasPrefix(data, []byte("\r\n\r\n\x00\r\nQUIT\n"))
+}
+
+// isText checks for valid utf-8 without control characters except whitespaces
+func isText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+
+	for _, r := range string(data) {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Errors returns the messages of all errors which are not nil
+func Errors(errs ...error) []string {
+	var messages []string
+
+	for _, err := range errs {
+		if err != nil {
+			messages = append(messages, err.Error())
+		}
+	}
+
+	return messages
+}
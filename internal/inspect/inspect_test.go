@@ -0,0 +1,204 @@
+package inspect
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectEmpty(t *testing.T) {
+	assert.Nil(t, Inspect(nil, ""))
+	assert.Nil(t, Inspect([]byte{}, "application/json"))
+}
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		contentType string
+		expected    *Payload
+	}{
+		{
+			name: "text",
+			data: "hello\r\n",
+			expected: &Payload{
+				Type: TypeText,
+				Text: "hello\r\n",
+			},
+		},
+		{
+			name: "binary",
+			data: "\x00\x01\x02",
+			expected: &Payload{
+				Type: TypeBinary,
+			},
+		},
+		{
+			name: "json",
+			data: `{"a": 1}`,
+			expected: &Payload{
+				Type: TypeJSON,
+				Json: map[string]interface{}{"a": float64(1)},
+			},
+		},
+		{
+			name:        "form",
+			data:        "a=1&b=2&a=3",
+			contentType: "application/x-www-form-urlencoded",
+			expected: &Payload{
+				Type: TypeForm,
+				Form: url.Values{"a": {"1", "3"}, "b": {"2"}},
+			},
+		},
+		{
+			name: "proxy protocol",
+			data: "PROXY TCP4 192.0.2.1 192.0.2.2 4711 80\r\n",
+			expected: &Payload{
+				Type: TypeProxyProtocol,
+				ProxyProtocol: &ProxyProtocol{
+					Version:     "v1",
+					Source:      "192.0.2.1:4711",
+					Destination: "192.0.2.2:80",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.expected.Size = len(tt.data)
+			tt.expected.Base64 = base64.StdEncoding.EncodeToString([]byte(tt.data))
+
+			assert.Equal(t, tt.expected, Inspect([]byte(tt.data), tt.contentType))
+		})
+	}
+}
+
+func TestInspectProxyProtocolPayload(t *testing.T) {
+	p := Inspect([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 4711 80\r\n{\"a\": true}"), "")
+	require.NotNil(t, p)
+	require.NotNil(t, p.ProxyProtocol)
+	assert.Equal(t, TypeJSON, p.Type)
+	assert.Equal(t, map[string]interface{}{"a": true}, p.Json)
+}
+
+func TestInspectHTTP(t *testing.T) {
+	data := "POST /foo?bar=1 HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"Content-Type: application/x-www-form-urlencoded\r\n" +
+		"Content-Length: 3\r\n" +
+		"\r\n" +
+		"a=1"
+
+	p := Inspect([]byte(data), "")
+	require.NotNil(t, p)
+	require.NotNil(t, p.Http)
+	assert.Equal(t, TypeHTTP, p.Type)
+	assert.Equal(t, "POST", p.Http.Method)
+	assert.Equal(t, "/foo?bar=1", p.Http.URL)
+	assert.Equal(t, "HTTP/1.1", p.Http.Proto)
+	assert.Equal(t, "example.com", p.Http.Host)
+	assert.Equal(t, "3", p.Http.Headers.Get("Content-Length"))
+	require.NotNil(t, p.Http.Body)
+	assert.Equal(t, url.Values{"a": {"1"}}, p.Http.Body.Form)
+	assert.Empty(t, p.Errors)
+
+	// incomplete body
+	p = Inspect([]byte("PUT / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 10\r\n\r\nabc"), "")
+	require.NotNil(t, p)
+	require.NotNil(t, p.Http)
+	assert.Equal(t, "abc", p.Http.Body.Text)
+	assert.Equal(t, []string{"http: body is incomplete"}, p.Errors)
+}
+
+func TestInspectMultipart(t *testing.T) {
+	var b bytes.Buffer
+
+	mw := multipart.NewWriter(&b)
+
+	fw, err := mw.CreateFormField("a")
+	require.NoError(t, err)
+
+	_, _ = io.WriteString(fw, `{"b": "c"}`)
+
+	fw, err = mw.CreateFormFile("file", "test.bin")
+	require.NoError(t, err)
+
+	_, _ = fw.Write([]byte{0, 1, 2})
+
+	require.NoError(t, mw.Close())
+
+	p := Inspect(b.Bytes(), mw.FormDataContentType())
+	require.NotNil(t, p)
+	assert.Equal(t, TypeMultipart, p.Type)
+	require.Len(t, p.Multipart, 2)
+
+	assert.Equal(t, "a", p.Multipart[0].Name)
+	assert.Equal(t, TypeJSON, p.Multipart[0].Payload.Type)
+	assert.Equal(t, map[string]interface{}{"b": "c"}, p.Multipart[0].Payload.Json)
+
+	assert.Equal(t, "file", p.Multipart[1].Name)
+	assert.Equal(t, "test.bin", p.Multipart[1].FileName)
+	assert.Equal(t, TypeBinary, p.Multipart[1].Payload.Type)
+
+	p = Inspect(b.Bytes(), "multipart/form-data")
+	assert.Equal(t, []string{"multipart: boundary is missing"}, p.Errors)
+}
+
+func clientHello(t *testing.T, config *tls.Config) []byte {
+	client, server := net.Pipe()
+
+	go func() {
+		_ = tls.Client(client, config).Handshake()
+	}()
+
+	buf := make([]byte, 4096)
+
+	n, err := server.Read(buf)
+	require.NoError(t, err)
+
+	_ = server.Close()
+	_ = client.Close()
+
+	return buf[:n]
+}
+
+func TestInspectTLS(t *testing.T) {
+	data := clientHello(t, &tls.Config{
+		ServerName: "example.com",
+		NextProtos: []string{"h2", "http/1.1"},
+		MinVersion: tls.VersionTLS12,
+		MaxVersion: tls.VersionTLS13,
+	})
+
+	p := Inspect(data, "")
+	require.NotNil(t, p)
+	require.NotNil(t, p.TLS)
+	assert.Equal(t, TypeTLS, p.Type)
+	assert.Empty(t, p.Errors)
+	assert.Equal(t, "TLS 1.2", p.TLS.ClientVersion)
+	assert.Equal(t, "example.com", p.TLS.ServerName)
+	assert.Equal(t, []string{"h2", "http/1.1"}, p.TLS.ALPN)
+	assert.Equal(t, []string{"TLS 1.3", "TLS 1.2"}, p.TLS.SupportedVersions)
+	assert.Contains(t, p.TLS.CipherSuites, "TLS_AES_128_GCM_SHA256")
+
+	// truncated records keep the fields which are present
+	p = Inspect(data[:60], "")
+	require.NotNil(t, p.TLS)
+	assert.Equal(t, "TLS 1.2", p.TLS.ClientVersion)
+	assert.Equal(t, []string{"tls: client hello is truncated"}, p.Errors)
+}
+
+func TestErrors(t *testing.T) {
+	assert.Nil(t, Errors())
+	assert.Nil(t, Errors(nil))
+	assert.Equal(t, []string{"unexpected EOF", "EOF"}, Errors(io.ErrUnexpectedEOF, nil, io.EOF))
+}
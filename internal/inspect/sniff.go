@@ -0,0 +1,236 @@
+package inspect
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SSH identification string
+type SSH struct {
+	Version  string `json:"version"`
+	Software string `json:"software,omitempty"`
+	Comments string `json:"comments,omitempty"`
+}
+
+// SMTP commands of a client session
+type SMTP struct {
+	// Command is the greeting, i.e. EHLO or HELO
+	Command  string   `json:"command"`
+	Domain   string   `json:"domain,omitempty"`
+	MailFrom string   `json:"mail-from,omitempty"`
+	RcptTo   []string `json:"rcpt-to,omitempty"`
+	StartTLS bool     `json:"starttls,omitempty"`
+}
+
+// Redis command in the RESP format
+type Redis struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+const (
+	http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+	// respMaxLength is the maximum length of a bulk string (proto-max-bulk-len) and of an array of redis
+	respMaxLength = 512 * 1024 * 1024
+)
+
+var errIncomplete = errors.New("message is incomplete")
+
+// sniff decodes the first message of the known protocols and sets the type of the payload
+func (p *Payload) sniff(data []byte) bool {
+	var err error
+
+	switch {
+	case isClientHello(data):
+		p.Type = TypeTLS
+		p.TLS, err = parseClientHello(data)
+	case bytes.HasPrefix(data, []byte(http2Preface)):
+		p.Type = TypeHTTP2
+		p.HTTP2, err = parseHTTP2(data[len(http2Preface):])
+	case bytes.HasPrefix(data, []byte("SSH-")):
+		p.Type = TypeSSH
+		p.SSH, err = parseSSH(data)
+	case isPostgreSQL(data):
+		p.Type = TypePostgreSQL
+		p.PostgreSQL, err = parsePostgreSQL(data)
+	case isMySQL(data):
+		p.Type = TypeMySQL
+		p.MySQL, err = parseMySQL(data)
+	case isDNS(data):
+		p.Type = TypeDNS
+		p.DNS, err = parseDNS(data[2:])
+	case isRedis(data):
+		p.Type = TypeRedis
+		p.Redis, err = parseRedis(data)
+	case isSMTP(data):
+		p.Type = TypeSMTP
+		p.SMTP = parseSMTP(data)
+	default:
+		return false
+	}
+
+	if err != nil {
+		p.Errors = append(p.Errors, p.Type+": "+err.Error())
+	}
+
+	return true
+}
+
+// parseSSH decodes the identification string SSH-protoversion-softwareversion SP comments CR LF
+func parseSSH(data []byte) (*SSH, error) {
+	line, complete := firstLine(data)
+
+	fields := strings.SplitN(strings.TrimPrefix(line, "SSH-"), "-", 2)
+
+	s := &SSH{
+		Version: fields[0],
+	}
+
+	if len(fields) > 1 {
+		software := strings.SplitN(fields[1], " ", 2)
+		s.Software = software[0]
+
+		if len(software) > 1 {
+			s.Comments = software[1]
+		}
+	}
+
+	if !complete {
+		return s, errIncomplete
+	}
+
+	return s, nil
+}
+
+func isSMTP(data []byte) bool {
+	line, _ := firstLine(data)
+	verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+	return verb == "EHLO" || verb == "HELO" || verb == "LHLO"
+}
+
+// parseSMTP decodes the greeting and the envelope commands of a client
+func parseSMTP(data []byte) *SMTP {
+	s := &SMTP{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		fields := strings.SplitN(line, " ", 2)
+		verb := strings.ToUpper(fields[0])
+
+		arg := ""
+		if len(fields) > 1 {
+			arg = strings.TrimSpace(fields[1])
+		}
+
+		switch {
+		case s.Command == "":
+			s.Command = verb
+			s.Domain = arg
+		case verb == "STARTTLS":
+			s.StartTLS = true
+		case verb == "MAIL" && strings.HasPrefix(strings.ToUpper(arg), "FROM:"):
+			s.MailFrom = strings.TrimSpace(arg[len("FROM:"):])
+		case verb == "RCPT" && strings.HasPrefix(strings.ToUpper(arg), "TO:"):
+			s.RcptTo = append(s.RcptTo, strings.TrimSpace(arg[len("TO:"):]))
+		case verb == "DATA":
+			// the content is not part of the envelope
+			return s
+		}
+	}
+
+	return s
+}
+
+func isRedis(data []byte) bool {
+	line, complete := firstLine(data)
+	if !complete || len(line) < 2 || line[0] != '*' {
+		return false
+	}
+
+	_, err := strconv.Atoi(line[1:])
+
+	return err == nil
+}
+
+// parseRedis decodes the first array of bulk strings
+func parseRedis(data []byte) (*Redis, error) {
+	n, data, err := respLength(data, '*')
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+
+	for i := 0; i < n; i++ {
+		var length int
+
+		length, data, err = respLength(data, '$')
+		if err != nil {
+			return newRedis(args), err
+		}
+
+		// length is at most respMaxLength but must not be added to
+		if length > len(data)-2 {
+			return newRedis(args), errIncomplete
+		}
+
+		args = append(args, string(data[:length]))
+		data = data[length+2:]
+	}
+
+	return newRedis(args), nil
+}
+
+func newRedis(args []string) *Redis {
+	if len(args) == 0 {
+		return nil
+	}
+
+	r := &Redis{
+		Command: strings.ToUpper(args[0]),
+	}
+
+	if len(args) > 1 {
+		r.Args = args[1:]
+	}
+
+	return r
+}
+
+// respLength reads a line of the format <prefix><length>\r\n and returns the remaining data
+func respLength(data []byte, prefix byte) (int, []byte, error) {
+	line, complete := firstLine(data)
+	if !complete {
+		return 0, nil, errIncomplete
+	}
+
+	rest := data[bytes.IndexByte(data, '\n')+1:]
+
+	if len(line) < 2 || line[0] != prefix {
+		return 0, rest, fmt.Errorf("expected %c but got %q", prefix, line)
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > respMaxLength {
+		return 0, rest, fmt.Errorf("invalid length %q", line[1:])
+	}
+
+	return n, rest, nil
+}
+
+// firstLine returns the first line without the line ending and if the line is terminated
+func firstLine(data []byte) (string, bool) {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return string(data), false
+	}
+
+	return strings.TrimRight(string(data[:i]), "\r"), true
+}
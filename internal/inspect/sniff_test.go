@@ -0,0 +1,209 @@
+package inspect
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniffSSH(t *testing.T) {
+	p := Inspect([]byte("SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.1\r\n\x00\x00\x05\xdc"), "")
+	require.NotNil(t, p)
+	assert.Equal(t, TypeSSH, p.Type)
+	assert.Equal(t, &SSH{Version: "2.0", Software: "OpenSSH_8.9p1", Comments: "Ubuntu-3ubuntu0.1"}, p.SSH)
+	assert.Empty(t, p.Errors)
+
+	p = Inspect([]byte("SSH-2.0-Go"), "")
+	assert.Equal(t, &SSH{Version: "2.0", Software: "Go"}, p.SSH)
+	assert.Equal(t, []string{"ssh: message is incomplete"}, p.Errors)
+}
+
+func TestSniffSMTP(t *testing.T) {
+	p := Inspect([]byte("EHLO client.example.com\r\nSTARTTLS\r\nMAIL FROM:<a@example.com>\r\n"+
+		"RCPT TO:<b@example.com>\r\nrcpt to:<c@example.com>\r\nDATA\r\nRCPT TO:<d@example.com>\r\n"), "")
+	require.NotNil(t, p)
+	assert.Equal(t, TypeSMTP, p.Type)
+	assert.Equal(t, &SMTP{
+		Command:  "EHLO",
+		Domain:   "client.example.com",
+		MailFrom: "<a@example.com>",
+		RcptTo:   []string{"<b@example.com>", "<c@example.com>"},
+		StartTLS: true,
+	}, p.SMTP)
+}
+
+func TestSniffRedis(t *testing.T) {
+	p := Inspect([]byte("*3\r\n$3\r\nset\r\n$1\r\na\r\n$5\r\nb\r\nc\n\r\n*1\r\n$4\r\nPING\r\n"), "")
+	require.NotNil(t, p)
+	assert.Equal(t, TypeRedis, p.Type)
+	assert.Equal(t, &Redis{Command: "SET", Args: []string{"a", "b\r\nc\n"}}, p.Redis)
+	assert.Empty(t, p.Errors)
+
+	p = Inspect([]byte("*2\r\n$4\r\nECHO\r\n$100\r\nabc"), "")
+	assert.Equal(t, &Redis{Command: "ECHO"}, p.Redis)
+	assert.Equal(t, []string{"redis: message is incomplete"}, p.Errors)
+}
+
+func TestSniffHTTP2(t *testing.T) {
+	data := []byte(http2Preface)
+	// SETTINGS with ENABLE_PUSH=0 and INITIAL_WINDOW_SIZE=4194304
+	data = append(data, 0, 0, 12, 0x4, 0, 0, 0, 0, 0, 0, 0x2, 0, 0, 0, 0, 0, 0x4, 0, 0x40, 0, 0)
+	// WINDOW_UPDATE of 1073741823
+	data = append(data, 0, 0, 4, 0x8, 0, 0, 0, 0, 0, 0x3f, 0xff, 0xff, 0xff)
+	// HEADERS of stream 1, the payload is truncated
+	data = append(data, 0, 0, 10, 0x1, 0x5, 0, 0, 0, 1, 0x82)
+
+	p := Inspect(data, "")
+	require.NotNil(t, p)
+	assert.Equal(t, TypeHTTP2, p.Type)
+	require.NotNil(t, p.HTTP2)
+	assert.Equal(t, []HTTP2Frame{
+		{Type: "SETTINGS", Length: 12, Settings: map[string]uint32{"ENABLE_PUSH": 0, "INITIAL_WINDOW_SIZE": 4194304}},
+		{Type: "WINDOW_UPDATE", Length: 4, WindowIncrement: 1073741823},
+		{Type: "HEADERS", Flags: 0x5, StreamID: 1, Length: 10},
+	}, p.HTTP2.Frames)
+	assert.Equal(t, []string{"http2: message is incomplete"}, p.Errors)
+}
+
+func TestSniffPostgreSQL(t *testing.T) {
+	params := "user\x00postgres\x00database\x00test\x00application_name\x00psql\x00\x00"
+
+	data := make([]byte, 8, 8+len(params))
+	binary.BigEndian.PutUint32(data, uint32(8+len(params)))
+	binary.BigEndian.PutUint32(data[4:], 3<<16)
+	data = append(data, params...)
+
+	p := Inspect(data, "")
+	require.NotNil(t, p)
+	assert.Equal(t, TypePostgreSQL, p.Type)
+	assert.Equal(t, &PostgreSQL{
+		Message: "startup",
+		Version: "3.0",
+		Parameters: map[string]string{
+			"user":             "postgres",
+			"database":         "test",
+			"application_name": "psql",
+		},
+	}, p.PostgreSQL)
+	assert.Empty(t, p.Errors)
+
+	p = Inspect([]byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}, "")
+	assert.Equal(t, &PostgreSQL{Message: "ssl-request"}, p.PostgreSQL)
+}
+
+func TestSniffMySQL(t *testing.T) {
+	// HandshakeResponse41 of the mysql client with user root, database test and caching_sha2_password
+	data, err := hex.DecodeString("55000001" + "8da2bf19" + "00000001" + "ff" + "0000000000000000000000000000000000000000000000" +
+		"726f6f7400" + "14" + "0102030405060708090a0b0c0d0e0f1011121314" + "7465737400" +
+		"63616368696e675f736861325f70617373776f726400")
+	require.NoError(t, err)
+
+	p := Inspect(data, "")
+	require.NotNil(t, p)
+	assert.Equal(t, TypeMySQL, p.Type)
+	assert.Equal(t, &MySQL{
+		Message:      "handshake-response",
+		Capabilities: 0x19bfa28d,
+		Charset:      0xff,
+		User:         "root",
+		Database:     "test",
+		AuthPlugin:   "caching_sha2_password",
+	}, p.MySQL)
+	assert.Empty(t, p.Errors)
+
+	// SSLRequest
+	data[0] = 32
+	data[5] |= 0x08
+	p = Inspect(data[:36], "")
+	assert.Equal(t, "ssl-request", p.MySQL.Message)
+}
+
+func TestSniffDNS(t *testing.T) {
+	msg, err := hex.DecodeString("abcd" + "0100" + "0002" + "0000" + "0000" + "0000" +
+		"076578616d706c6503636f6d00" + "0001" + "0001" +
+		"03777777c00c" + "001c" + "0001")
+	require.NoError(t, err)
+
+	data := make([]byte, 2, 2+len(msg))
+	binary.BigEndian.PutUint16(data, uint16(len(msg)))
+	data = append(data, msg...)
+
+	p := Inspect(data, "")
+	require.NotNil(t, p)
+	assert.Equal(t, TypeDNS, p.Type)
+	assert.Equal(t, &DNS{
+		ID:               0xabcd,
+		Opcode:           "QUERY",
+		RecursionDesired: true,
+		Questions: []DNSQuestion{
+			{Name: "example.com.", Type: "A", Class: "IN"},
+			{Name: "www.example.com.", Type: "AAAA", Class: "IN"},
+		},
+	}, p.DNS)
+	assert.Empty(t, p.Errors)
+
+	// pointer loop
+	loop := append([]byte{}, data[:14]...)
+	loop = append(loop, 0xc0, 12, 0, 1, 0, 1)
+	p = Inspect(loop, "")
+	assert.Equal(t, TypeDNS, p.Type)
+	assert.Equal(t, []string{"dns: invalid name"}, p.Errors)
+}
+
+func TestSniffText(t *testing.T) {
+	// inline redis commands and other protocols are text
+	p := Inspect([]byte("PING\r\n"), "")
+	require.NotNil(t, p)
+	assert.Equal(t, TypeText, p.Type)
+}
+
+func TestSniffPanicSafety(t *testing.T) {
+	mysql, err := hex.DecodeString("55000001" + "8da2bf19" + "00000001" + "ff" + "0000000000000000000000000000000000000000000000" +
+		"726f6f7400" + "14" + "0102030405060708090a0b0c0d0e0f1011121314" + "7465737400" +
+		"63616368696e675f736861325f70617373776f726400")
+	require.NoError(t, err)
+
+	dns, err := hex.DecodeString("0021" + "abcd" + "0100" + "0002" + "0000" + "0000" + "0000" +
+		"076578616d706c6503636f6d00" + "0001" + "0001" + "03777777c00c" + "001c" + "0001")
+	require.NoError(t, err)
+
+	http2 := append([]byte(http2Preface), 0, 0, 12, 0x4, 0, 0, 0, 0, 0, 0, 0x2, 0, 0, 0, 0, 0, 0x4, 0, 0x40, 0, 0)
+
+	samples := map[string][]byte{
+		TypeTLS:            clientHello(t, &tls.Config{ServerName: "example.com", NextProtos: []string{"h2"}}),
+		TypeHTTP2:          http2,
+		TypeSSH:            []byte("SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.1\r\n"),
+		TypePostgreSQL:     append([]byte{0, 0, 0, 22, 0, 3, 0, 0}, "user\x00postgres\x00\x00"...),
+		TypeMySQL:          mysql,
+		TypeDNS:            dns,
+		TypeRedis:          []byte("*2\r\n$4\r\nECHO\r\n$5\r\nhello\r\n"),
+		TypeSMTP:           []byte("EHLO client.example.com\r\nMAIL FROM:<a@example.com>\r\n"),
+		"redis max length": []byte("*1\r\n$9223372036854775807\r\nabc"),
+		"redis max array":  []byte("*9223372036854775807\r\n$1\r\na\r\n"),
+	}
+
+	for name, data := range samples {
+		data := data
+
+		t.Run(name, func(t *testing.T) {
+			// truncated messages
+			for i := 0; i <= len(data); i++ {
+				assert.NotPanics(t, func() { Inspect(data[:i], "") }, "length %d", i)
+			}
+
+			// maximum and zero lengths
+			for i := range data {
+				for _, b := range []byte{0xff, 0x00} {
+					mutated := append([]byte{}, data...)
+					mutated[i] = b
+
+					assert.NotPanics(t, func() { Inspect(mutated, "") }, "byte %d: %x", i, b)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package inspect
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+)
+
+// TLS ClientHello
+type TLS struct {
+	// Version of the record layer
+	Version string `json:"version,omitempty"`
+	// ClientVersion is the legacy version of the handshake, TLS 1.3 uses the supported versions
+	ClientVersion     string   `json:"client-version,omitempty"`
+	ServerName        string   `json:"server-name,omitempty"`
+	ALPN              []string `json:"alpn,omitempty"`
+	SupportedVersions []string `json:"supported-versions,omitempty"`
+	CipherSuites      []string `json:"cipher-suites,omitempty"`
+}
+
+const (
+	recordTypeHandshake   = 0x16
+	handshakeClientHello  = 0x01
+	extServerName         = 0
+	extALPN               = 16
+	extSupportedVersions  = 43
+	serverNameTypeHost    = 0
+	recordHeaderLength    = 5
+	handshakeHeaderLength = 4
+)
+
+var errTruncated = errors.New("client hello is truncated")
+
+func isClientHello(data []byte) bool {
+	return len(data) > recordHeaderLength &&
+		data[0] == recordTypeHandshake &&
+		data[1] == 3 &&
+		data[recordHeaderLength] == handshakeClientHello
+}
+
+// parseClientHello decodes the first record, the fields are returned as far as they are present
+func parseClientHello(data []byte) (*TLS, error) {
+	hello := &TLS{
+		Version: tlsVersionName(uint16(data[1])<<8 | uint16(data[2])),
+	}
+
+	if len(data) < recordHeaderLength+handshakeHeaderLength {
+		return hello, errTruncated
+	}
+
+	record := &cursor{b: data[recordHeaderLength:]}
+	if n := int(uint16(data[3])<<8 | uint16(data[4])); n < len(record.b) {
+		record.b = record.b[:n]
+	}
+
+	record.u8() // handshake type
+
+	body := &cursor{b: record.bytes(record.u24())}
+	if record.err != nil {
+		// continue with the available bytes
+		body = &cursor{b: data[recordHeaderLength+handshakeHeaderLength:]}
+	}
+
+	hello.ClientVersion = tlsVersionName(body.u16())
+	body.bytes(32) // random
+	body.bytes(int(body.u8()))
+
+	suites := &cursor{b: body.bytes(int(body.u16()))}
+	for len(suites.b) >= 2 {
+		if id := suites.u16(); !isGrease(id) {
+			hello.CipherSuites = append(hello.CipherSuites, tls.CipherSuiteName(id))
+		}
+	}
+
+	body.bytes(int(body.u8())) // compression methods
+
+	if body.err != nil {
+		return hello, errTruncated
+	}
+
+	extensions := &cursor{b: body.bytes(int(body.u16()))}
+	for len(extensions.b) >= 4 {
+		typ := extensions.u16()
+		ext := &cursor{b: extensions.bytes(int(extensions.u16()))}
+
+		switch typ {
+		case extServerName:
+			names := &cursor{b: ext.bytes(int(ext.u16()))}
+			for len(names.b) >= 3 {
+				nameType := names.u8()
+				name := names.bytes(int(names.u16()))
+
+				if nameType == serverNameTypeHost {
+					hello.ServerName = string(name)
+				}
+			}
+		case extALPN:
+			protocols := &cursor{b: ext.bytes(int(ext.u16()))}
+			for len(protocols.b) > 0 {
+				if p := protocols.bytes(int(protocols.u8())); protocols.err == nil {
+					hello.ALPN = append(hello.ALPN, string(p))
+				}
+			}
+		case extSupportedVersions:
+			versions := &cursor{b: ext.bytes(int(ext.u8()))}
+			for len(versions.b) >= 2 {
+				if v := versions.u16(); !isGrease(v) {
+					hello.SupportedVersions = append(hello.SupportedVersions, tlsVersionName(v))
+				}
+			}
+		}
+	}
+
+	if body.err != nil || extensions.err != nil || len(extensions.b) > 0 {
+		return hello, errTruncated
+	}
+
+	return hello, nil
+}
+
+func tlsVersionName(v uint16) string {
+	switch v {
+	case 0x0300:
+		return "SSL 3.0"
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("0x%04X", v)
+	}
+}
+
+// isGrease checks for the reserved values of RFC 8701
+func isGrease(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// cursor reads big endian values, a read beyond the end sets err and returns zero values
+type cursor struct {
+	b   []byte
+	err error
+}
+
+func (c *cursor) bytes(n int) []byte {
+	if n > len(c.b) {
+		c.err = errTruncated
+		c.b = nil
+
+		return nil
+	}
+
+	v := c.b[:n]
+	c.b = c.b[n:]
+
+	return v
+}
+
+func (c *cursor) u8() uint8 {
+	if b := c.bytes(1); b != nil {
+		return b[0]
+	}
+
+	return 0
+}
+
+func (c *cursor) u16() uint16 {
+	if b := c.bytes(2); b != nil {
+		return uint16(b[0])<<8 | uint16(b[1])
+	}
+
+	return 0
+}
+
+func (c *cursor) u32() uint32 {
+	if b := c.bytes(4); b != nil {
+		return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+	}
+
+	return 0
+}
+
+func (c *cursor) u24() int {
+	if b := c.bytes(3); b != nil {
+		return int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+	}
+
+	return 0
+}
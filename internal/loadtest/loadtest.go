@@ -0,0 +1,291 @@
+package loadtest
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/marsom/serverbin/internal/tracing"
+)
+
+// max response body size which is parsed for the instance id
+const maxBodySize = 1 << 20
+
+// Config of a load test
+type Config struct {
+	// Target is a http, https, tcp, tls or udp url
+	Target      string
+	Requests    int
+	Concurrency int
+	KeepAlive   bool
+	// Cookies keeps the cookies per session to test session affinity
+	Cookies        bool
+	Timeout        time.Duration
+	InstanceHeader string
+	Insecure       bool
+	// Payload is sent by tcp, tls and udp sessions
+	Payload []byte
+	// TraceContext sends a new sampled trace context with each http request in the propagation format
+	TraceContext string
+}
+
+type sample struct {
+	session  int
+	instance string
+	latency  time.Duration
+	err      error
+}
+
+// session sends requests like a single client, i.e. with its own connections and cookies
+type session interface {
+	probe(ctx context.Context) (string, error)
+}
+
+// Run sends the requests and reports the distribution across instances
+func Run(ctx context.Context, config Config) (*Report, error) {
+	if config.Requests <= 0 {
+		return nil, errors.New("requests must be greater than 0")
+	}
+
+	if config.Concurrency <= 0 {
+		return nil, errors.New("concurrency must be greater than 0")
+	}
+
+	if config.Concurrency > config.Requests {
+		config.Concurrency = config.Requests
+	}
+
+	target, err := url.Parse(config.Target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target %q: %w", config.Target, err)
+	}
+
+	var newSession func() (session, error)
+
+	switch target.Scheme {
+	case "http", "https":
+		newSession = func() (session, error) {
+			return newHttpSession(config)
+		}
+	case "tcp", "tls", "udp":
+		if target.Host == "" {
+			return nil, fmt.Errorf("invalid target %q: host is missing", config.Target)
+		}
+
+		newSession = func() (session, error) {
+			return &streamSession{config: config, scheme: target.Scheme, address: target.Host}, nil
+		}
+	default:
+		return nil, fmt.Errorf("invalid target %q: unsupported scheme %q", config.Target, target.Scheme)
+	}
+
+	sessions := make([]session, config.Concurrency)
+	for i := range sessions {
+		if sessions[i], err = newSession(); err != nil {
+			return nil, err
+		}
+	}
+
+	jobs := make(chan struct{}, config.Requests)
+	for i := 0; i < config.Requests; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+
+	samples := make(chan sample, config.Requests)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i, s := range sessions {
+		wg.Add(1)
+
+		go func(i int, s session) {
+			defer wg.Done()
+
+			for range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+
+				begin := time.Now()
+				instance, err := s.probe(ctx)
+
+				samples <- sample{
+					session:  i,
+					instance: instance,
+					latency:  time.Since(begin),
+					err:      err,
+				}
+			}
+		}(i, s)
+	}
+
+	wg.Wait()
+	close(samples)
+
+	report := newReport(config.Target, time.Since(start), samples)
+
+	return report, ctx.Err()
+}
+
+type identity struct {
+	Server struct {
+		InstanceID string `json:"instance-id"`
+	} `json:"server"`
+}
+
+// instanceFromBody returns the instance id of a serverbin json response
+func instanceFromBody(body []byte) string {
+	var data identity
+	if err := json.Unmarshal(body, &data); err != nil {
+		return ""
+	}
+
+	return data.Server.InstanceID
+}
+
+type httpSession struct {
+	config Config
+	client *http.Client
+}
+
+func newHttpSession(config Config) (*httpSession, error) {
+	transport := &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		DisableKeepAlives: !config.KeepAlive,
+		//nolint:gosec // test servers use self-signed certificates
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: config.Insecure},
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   config.Timeout,
+	}
+
+	if config.Cookies {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		client.Jar = jar
+	}
+
+	return &httpSession{config: config, client: client}, nil
+}
+
+func (s *httpSession) probe(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.Target, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if s.config.TraceContext != "" {
+		tracing.Inject(tracing.ContextWithSpan(ctx, tracing.SpanContext{
+			TraceID: tracing.NewTraceID(),
+			SpanID:  tracing.NewSpanID(),
+			Sampled: true,
+		}), req.Header, s.config.TraceContext)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return "", err
+	}
+
+	instance := ""
+	if s.config.InstanceHeader != "" {
+		instance = resp.Header.Get(s.config.InstanceHeader)
+	}
+
+	if instance == "" {
+		instance = instanceFromBody(body)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return instance, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	return instance, nil
+}
+
+// streamSession uses a new connection for each request, the tcp server closes the connection after the response
+type streamSession struct {
+	config  Config
+	scheme  string
+	address string
+}
+
+func (s *streamSession) probe(ctx context.Context) (string, error) {
+	dialer := &net.Dialer{Timeout: s.config.Timeout}
+
+	var conn net.Conn
+	var err error
+
+	switch s.scheme {
+	case "tls":
+		tlsDialer := &tls.Dialer{
+			NetDialer: dialer,
+			//nolint:gosec // test servers use self-signed certificates
+			Config: &tls.Config{InsecureSkipVerify: s.config.Insecure},
+		}
+
+		conn, err = tlsDialer.DialContext(ctx, "tcp", s.address)
+	default:
+		conn, err = dialer.DialContext(ctx, s.scheme, s.address)
+	}
+
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if s.config.Timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(s.config.Timeout)); err != nil {
+			return "", err
+		}
+	}
+
+	payload := s.config.Payload
+	if len(payload) == 0 {
+		payload = []byte("serverbin")
+	}
+
+	if _, err := conn.Write(payload); err != nil {
+		return "", err
+	}
+
+	var body []byte
+
+	if s.scheme == "udp" {
+		buffer := make([]byte, 65507)
+
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return "", err
+		}
+
+		body = buffer[:n]
+	} else {
+		if body, err = io.ReadAll(io.LimitReader(conn, maxBodySize)); err != nil {
+			return "", err
+		}
+	}
+
+	return instanceFromBody(body), nil
+}
@@ -0,0 +1,132 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunHttp(t *testing.T) {
+	count := int64(0)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&count, 1)
+
+		if n%10 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		// session affinity by cookie
+		if c, err := r.Cookie("affinity"); err == nil {
+			w.Header().Set("X-Serverbin-Instance", c.Value)
+			return
+		}
+
+		instance := fmt.Sprintf("instance-%d", n%2)
+		http.SetCookie(w, &http.Cookie{Name: "affinity", Value: instance})
+
+		// body is used if the header is missing
+		_, _ = fmt.Fprintf(w, `{"server": {"instance-id": %q}}`, instance)
+	}))
+	defer srv.Close()
+
+	report, err := Run(context.Background(), Config{
+		Target:         srv.URL,
+		Requests:       100,
+		Concurrency:    4,
+		KeepAlive:      true,
+		Cookies:        true,
+		Timeout:        time.Second,
+		InstanceHeader: "X-Serverbin-Instance",
+	})
+	require.Nil(t, err)
+
+	assert.Equal(t, 100, report.Requests)
+	assert.Equal(t, 10, report.Errors)
+	assert.Equal(t, []Count{{Name: "status 503", Count: 10}}, report.Failures)
+	assert.Len(t, report.Instances, 2)
+	assert.Equal(t, Sessions{Total: 4, Sticky: 4}, report.Sessions)
+	assert.True(t, report.Latency.Min <= report.Latency.P50)
+	assert.True(t, report.Latency.P99 <= report.Latency.Max)
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, report.WriteText(buf))
+	assert.Contains(t, buf.String(), "instance-0")
+	assert.Contains(t, buf.String(), "status 503")
+}
+
+func TestRunTcp(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			buffer := make([]byte, 64)
+			_, _ = conn.Read(buffer)
+			_, _ = conn.Write([]byte(`{"server": {"instance-id": "tcp"}}`))
+			_ = conn.Close()
+		}
+	}()
+
+	report, err := Run(context.Background(), Config{
+		Target:      "tcp://" + l.Addr().String(),
+		Requests:    10,
+		Concurrency: 2,
+		Timeout:     time.Second,
+	})
+	require.Nil(t, err)
+
+	assert.Equal(t, 0, report.Errors)
+	assert.Equal(t, []Count{{Name: "tcp", Count: 10}}, report.Instances)
+}
+
+func TestRunInvalidTarget(t *testing.T) {
+	_, err := Run(context.Background(), Config{Target: "ftp://localhost", Requests: 1, Concurrency: 1})
+	require.NotNil(t, err)
+
+	_, err = Run(context.Background(), Config{Target: "http://localhost", Requests: 0, Concurrency: 1})
+	require.NotNil(t, err)
+}
+
+func TestPercentile(t *testing.T) {
+	var values []time.Duration
+	for i := 1; i <= 100; i++ {
+		values = append(values, time.Duration(i))
+	}
+
+	assert.Equal(t, time.Duration(1), percentile(values, 0))
+	assert.Equal(t, time.Duration(50), percentile(values, 50))
+	assert.Equal(t, time.Duration(99), percentile(values, 99))
+	assert.Equal(t, time.Duration(100), percentile(values, 100))
+	assert.Equal(t, time.Duration(1), percentile(values[:1], 99))
+}
+
+func TestReportSessions(t *testing.T) {
+	samples := make(chan sample, 5)
+	samples <- sample{session: 0, instance: "a"}
+	samples <- sample{session: 0, instance: "a"}
+	samples <- sample{session: 1, instance: "a"}
+	samples <- sample{session: 1, instance: "b"}
+	// a single response is not sticky
+	samples <- sample{session: 2, instance: "a"}
+	close(samples)
+
+	report := newReport("http://localhost", time.Second, samples)
+	assert.Equal(t, Sessions{Total: 3, Sticky: 1}, report.Sessions)
+}
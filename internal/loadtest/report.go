@@ -0,0 +1,201 @@
+package loadtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// UnknownInstance is reported if a response has no instance id
+const UnknownInstance = "unknown"
+
+// Duration is a time.Duration which is marshalled as string
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Report of a load test
+type Report struct {
+	Target    string   `json:"target"`
+	Requests  int      `json:"requests"`
+	Errors    int      `json:"errors"`
+	Duration  Duration `json:"duration"`
+	Instances []Count  `json:"instances"`
+	Latency   Latency  `json:"latency"`
+	Sessions  Sessions `json:"sessions"`
+	Failures  []Count  `json:"failures,omitempty"`
+}
+
+// Count of responses by instance or error message
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Latency percentiles of all requests
+type Latency struct {
+	Min Duration `json:"min"`
+	P50 Duration `json:"p50"`
+	P90 Duration `json:"p90"`
+	P95 Duration `json:"p95"`
+	P99 Duration `json:"p99"`
+	Max Duration `json:"max"`
+}
+
+// Sessions counts the clients which were always served by the same instance, a client with a single response is not sticky
+type Sessions struct {
+	Total  int `json:"total"`
+	Sticky int `json:"sticky"`
+}
+
+func newReport(target string, duration time.Duration, samples <-chan sample) *Report {
+	report := &Report{
+		Target:   target,
+		Duration: Duration(duration),
+	}
+
+	instances := map[string]int{}
+	failures := map[string]int{}
+	sessions := map[int]map[string]bool{}
+	responses := map[int]int{}
+
+	var latencies []time.Duration
+
+	for s := range samples {
+		report.Requests++
+		latencies = append(latencies, s.latency)
+
+		if s.err != nil {
+			report.Errors++
+			failures[s.err.Error()]++
+
+			continue
+		}
+
+		instance := s.instance
+		if instance == "" {
+			instance = UnknownInstance
+		}
+
+		instances[instance]++
+
+		if sessions[s.session] == nil {
+			sessions[s.session] = map[string]bool{}
+		}
+
+		sessions[s.session][instance] = true
+		responses[s.session]++
+	}
+
+	report.Instances = sortedCounts(instances)
+	report.Failures = sortedCounts(failures)
+	report.Latency = newLatency(latencies)
+
+	report.Sessions.Total = len(sessions)
+	for id, s := range sessions {
+		if len(s) == 1 && responses[id] > 1 {
+			report.Sessions.Sticky++
+		}
+	}
+
+	return report
+}
+
+// sortedCounts sorts by count descending and name
+func sortedCounts(counts map[string]int) []Count {
+	result := make([]Count, 0, len(counts))
+	for name, count := range counts {
+		result = append(result, Count{Name: name, Count: count})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+func newLatency(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+
+	return Latency{
+		Min: Duration(latencies[0]),
+		P50: Duration(percentile(latencies, 50)),
+		P90: Duration(percentile(latencies, 90)),
+		P95: Duration(percentile(latencies, 95)),
+		P99: Duration(percentile(latencies, 99)),
+		Max: Duration(latencies[len(latencies)-1]),
+	}
+}
+
+// percentile of sorted values with the nearest rank method
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+// WriteJSON writes the report as json
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", " ")
+
+	return encoder.Encode(r)
+}
+
+// WriteText writes the report as human readable text
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	rate := 0.0
+	if r.Duration > 0 {
+		rate = float64(r.Requests) / time.Duration(r.Duration).Seconds()
+	}
+
+	fmt.Fprintf(tw, "target:\t%s\n", r.Target)
+	fmt.Fprintf(tw, "requests:\t%d (errors: %d)\n", r.Requests, r.Errors)
+	fmt.Fprintf(tw, "duration:\t%s (%.1f requests/s)\n", r.Duration.String(), rate)
+	fmt.Fprintf(tw, "sessions:\t%d (sticky: %d)\n", r.Sessions.Total, r.Sessions.Sticky)
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "instance\trequests\tshare")
+	for _, c := range r.Instances {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f%%\n", c.Name, c.Count, 100*float64(c.Count)/float64(r.Requests))
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "min\tp50\tp90\tp95\tp99\tmax")
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Latency.Min, r.Latency.P50, r.Latency.P90, r.Latency.P95, r.Latency.P99, r.Latency.Max)
+
+	if len(r.Failures) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "error\tcount")
+		for _, c := range r.Failures {
+			fmt.Fprintf(tw, "%s\t%d\n", c.Name, c.Count)
+		}
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,259 @@
+package logging
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Access log formats
+const (
+	AccessLogNone     = "none"
+	AccessLogJSON     = "json"
+	AccessLogCommon   = "common"
+	AccessLogCombined = "combined"
+)
+
+// RequestIDHeader is used as request id if present and returned in all responses
+const RequestIDHeader = "X-Request-Id"
+
+const commonTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLog writes an entry for each http request, tcp connection or udp packet. All methods can be called on a
+// nil AccessLog.
+type AccessLog struct {
+	mu     sync.Mutex
+	out    io.Writer
+	format string
+}
+
+// AccessEntry is a http request, a tcp connection or an udp packet
+type AccessEntry struct {
+	Time          time.Time      `json:"time"`
+	Server        string         `json:"server,omitempty"`
+	RequestID     string         `json:"request-id,omitempty"`
+	ClientIP      string         `json:"client-ip,omitempty"`
+	RemoteIP      string         `json:"remote-ip,omitempty"`
+	Protocol      string         `json:"protocol,omitempty"`
+	Method        string         `json:"method,omitempty"`
+	URI           string         `json:"uri,omitempty"`
+	Status        int            `json:"status,omitempty"`
+	BytesRead     int64          `json:"bytes-read"`
+	BytesWritten  int64          `json:"bytes-written"`
+	Duration      time.Duration  `json:"-"`
+	UserAgent     string         `json:"user-agent,omitempty"`
+	Referer       string         `json:"referer,omitempty"`
+	ProxyProtocol *ProxyProtocol `json:"proxy-protocol,omitempty"`
+	Error         string         `json:"error,omitempty"`
+}
+
+// ProxyProtocol of a tcp connection
+type ProxyProtocol struct {
+	Version     string `json:"version,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+}
+
+// NewAccessLog returns nil if the format is none
+func NewAccessLog(out io.Writer, format string) (*AccessLog, error) {
+	switch format {
+	case "", AccessLogNone:
+		return nil, nil
+	case AccessLogJSON, AccessLogCommon, AccessLogCombined:
+		return &AccessLog{out: out, format: format}, nil
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", format)
+	}
+}
+
+// Log writes an entry
+func (a *AccessLog) Log(e AccessEntry) {
+	if a == nil {
+		return
+	}
+
+	var line []byte
+
+	switch a.format {
+	case AccessLogJSON:
+		b, err := json.Marshal(struct {
+			AccessEntry
+			Duration float64 `json:"duration"`
+		}{e, e.Duration.Seconds()})
+		if err != nil {
+			return
+		}
+
+		line = append(b, '\n')
+	default:
+		line = []byte(a.common(e))
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, _ = a.out.Write(line)
+}
+
+// common formats the entry in the common or combined log format
+func (a *AccessLog) common(e AccessEntry) string {
+	request := e.Protocol
+	if e.Method != "" {
+		request = e.Method + " " + e.URI + " " + e.Protocol
+	}
+
+	line := fmt.Sprintf("%s - - [%s] %s %s %s",
+		dash(e.ClientIP),
+		e.Time.Format(commonTimeFormat),
+		strconv.Quote(request),
+		dash(strconv.Itoa(e.Status)),
+		dash(strconv.FormatInt(e.BytesWritten, 10)),
+	)
+
+	if a.format == AccessLogCombined {
+		line += " " + strconv.Quote(dash(e.Referer)) + " " + strconv.Quote(dash(e.UserAgent))
+	}
+
+	return line + "\n"
+}
+
+func dash(s string) string {
+	if s == "" || s == "0" {
+		return "-"
+	}
+
+	return s
+}
+
+// NewRequestID returns a random id
+func NewRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// RequestIDHandler returns the request id in the response, a random id is generated and added to the request if
+// not present
+func RequestIDHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" {
+			id = NewRequestID()
+			r.Header.Set(RequestIDHeader, id)
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Handler logs all requests of a http server, the request id is returned without an access log too
+func (a *AccessLog) Handler(server string, clientIP func(r *http.Request) string, next http.Handler) http.Handler {
+	if a == nil {
+		return RequestIDHandler(next)
+	}
+
+	return RequestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+
+		rec := &responseRecorder{ResponseWriter: w}
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+
+		next.ServeHTTP(rec, r)
+
+		remoteIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		a.Log(AccessEntry{
+			Time:         start,
+			Server:       server,
+			RequestID:    id,
+			ClientIP:     clientIP(r),
+			RemoteIP:     remoteIP,
+			Protocol:     r.Proto,
+			Method:       r.Method,
+			URI:          r.RequestURI,
+			Status:       status,
+			BytesRead:    atomic.LoadInt64(&body.n),
+			BytesWritten: atomic.LoadInt64(&rec.n),
+			Duration:     time.Since(start),
+			UserAgent:    r.UserAgent(),
+			Referer:      r.Referer(),
+		})
+	}))
+}
+
+// responseRecorder records the status and the body size, flush and hijack are passed to the response writer
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	n      int64
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	n, err := r.ResponseWriter.Write(p)
+	atomic.AddInt64(&r.n, int64(n))
+
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijack not supported")
+	}
+
+	if r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+
+	return h.Hijack()
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+
+	return n, err
+}
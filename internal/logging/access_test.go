@@ -0,0 +1,139 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAccessLog(t *testing.T) {
+	a, err := NewAccessLog(io.Discard, AccessLogNone)
+	require.NoError(t, err)
+	assert.Nil(t, a)
+
+	// nil access log is a noop
+	a.Log(AccessEntry{})
+
+	_, err = NewAccessLog(io.Discard, "apache")
+	assert.Error(t, err)
+}
+
+func TestAccessLogCommon(t *testing.T) {
+	entry := AccessEntry{
+		Time:         time.Date(2021, 9, 23, 7, 3, 55, 0, time.UTC),
+		ClientIP:     "192.0.2.43",
+		Protocol:     "HTTP/1.1",
+		Method:       "GET",
+		URI:          "/status/200",
+		Status:       200,
+		BytesWritten: 512,
+		UserAgent:    "curl/7.79.1",
+	}
+
+	tests := []struct {
+		format string
+		entry  AccessEntry
+		want   string
+	}{
+		{
+			format: AccessLogCommon,
+			entry:  entry,
+			want:   "192.0.2.43 - - [23/Sep/2021:07:03:55 +0000] \"GET /status/200 HTTP/1.1\" 200 512\n",
+		},
+		{
+			format: AccessLogCombined,
+			entry:  entry,
+			want:   "192.0.2.43 - - [23/Sep/2021:07:03:55 +0000] \"GET /status/200 HTTP/1.1\" 200 512 \"-\" \"curl/7.79.1\"\n",
+		},
+		{
+			format: AccessLogCommon,
+			entry: AccessEntry{
+				Time:     entry.Time,
+				ClientIP: "192.0.2.43",
+				Protocol: "TCP",
+			},
+			want: "192.0.2.43 - - [23/Sep/2021:07:03:55 +0000] \"TCP\" - -\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format+" "+tt.entry.Protocol, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			a, err := NewAccessLog(out, tt.format)
+			require.NoError(t, err)
+
+			a.Log(tt.entry)
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
+
+func TestAccessLogHandler(t *testing.T) {
+	out := &bytes.Buffer{}
+	a, err := NewAccessLog(out, AccessLogJSON)
+	require.NoError(t, err)
+
+	h := a.Handler("http", func(r *http.Request) string {
+		return "192.0.2.43"
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("tea"))
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/status/418", strings.NewReader("hello"))
+	r.Header.Set(RequestIDHeader, "abc")
+	r.Header.Set("User-Agent", "test")
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, "abc", w.Header().Get(RequestIDHeader))
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "http", entry["server"])
+	assert.Equal(t, "abc", entry["request-id"])
+	assert.Equal(t, "192.0.2.43", entry["client-ip"])
+	assert.Equal(t, "192.0.2.1", entry["remote-ip"])
+	assert.Equal(t, "POST", entry["method"])
+	assert.Equal(t, "/status/418", entry["uri"])
+	assert.Equal(t, float64(418), entry["status"])
+	assert.Equal(t, float64(5), entry["bytes-read"])
+	assert.Equal(t, float64(3), entry["bytes-written"])
+	assert.Equal(t, "test", entry["user-agent"])
+	assert.Contains(t, entry, "duration")
+}
+
+func TestAccessLogHandlerRequestID(t *testing.T) {
+	a, err := NewAccessLog(io.Discard, AccessLogCommon)
+	require.NoError(t, err)
+
+	h := a.Handler("http", func(r *http.Request) string { return "" }, http.NotFoundHandler())
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Len(t, w.Header().Get(RequestIDHeader), 16)
+
+	// without access log
+	var none *AccessLog
+
+	h = none.Handler("http", func(r *http.Request) string { return "" }, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Len(t, r.Header.Get(RequestIDHeader), 16)
+	}))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Len(t, w.Header().Get(RequestIDHeader), 16)
+}
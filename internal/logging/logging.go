@@ -0,0 +1,228 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level of a log message
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(s string) (Level, error) {
+	for _, l := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// Field is a key value pair of a structured log message
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F creates a field
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger writes structured log messages as text or json lines
+type Logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	level  Level
+	format string
+	now    func() time.Time
+}
+
+// New creates a logger, messages below the level are discarded
+func New(out io.Writer, level Level, format string) *Logger {
+	return &Logger{
+		out:    out,
+		level:  level,
+		format: format,
+		now:    time.Now,
+	}
+}
+
+// Enabled returns true if messages of the level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+// Log writes a message with fields
+func (l *Logger) Log(level Level, msg string, fields ...Field) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	now := l.now().Format(timeFormat)
+
+	if l.format == FormatJSON {
+		buf.WriteString(`{"time":`)
+		writeJSON(buf, now)
+		buf.WriteString(`,"level":`)
+		writeJSON(buf, level.String())
+		buf.WriteString(`,"msg":`)
+		writeJSON(buf, msg)
+
+		for _, f := range fields {
+			buf.WriteByte(',')
+			writeJSON(buf, f.Key)
+			buf.WriteByte(':')
+			writeJSON(buf, value(f.Value))
+		}
+
+		buf.WriteString("}\n")
+	} else {
+		buf.WriteString(now)
+		buf.WriteByte(' ')
+		buf.WriteString(strings.ToUpper(level.String()))
+		buf.WriteByte(' ')
+		buf.WriteString(msg)
+
+		for _, f := range fields {
+			buf.WriteByte(' ')
+			buf.WriteString(f.Key)
+			buf.WriteByte('=')
+			buf.WriteString(quote(fmt.Sprint(value(f.Value))))
+		}
+
+		buf.WriteByte('\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, _ = l.out.Write(buf.Bytes())
+}
+
+func (l *Logger) Debug(msg string, fields ...Field) {
+	l.Log(LevelDebug, msg, fields...)
+}
+
+func (l *Logger) Info(msg string, fields ...Field) {
+	l.Log(LevelInfo, msg, fields...)
+}
+
+func (l *Logger) Warn(msg string, fields ...Field) {
+	l.Log(LevelWarn, msg, fields...)
+}
+
+func (l *Logger) Error(msg string, fields ...Field) {
+	l.Log(LevelError, msg, fields...)
+}
+
+// Writer returns a writer for the standard log package, each write is a message with the level
+func (l *Logger) Writer(level Level) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		l.Log(level, strings.TrimSuffix(string(p), "\n"))
+
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// value converts errors, durations and other stringers to strings
+func value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+
+	buf.Write(b)
+}
+
+// quote text values with spaces, quotes or equal signs
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+//nolint:gochecknoglobals // process wide logger like the standard log package
+var std = New(os.Stdout, LevelInfo, FormatText)
+
+// SetDefault replaces the process wide logger
+func SetDefault(l *Logger) {
+	std = l
+}
+
+// Default returns the process wide logger
+func Default() *Logger {
+	return std
+}
+
+func Debug(msg string, fields ...Field) {
+	std.Log(LevelDebug, msg, fields...)
+}
+
+func Info(msg string, fields ...Field) {
+	std.Log(LevelInfo, msg, fields...)
+}
+
+func Warn(msg string, fields ...Field) {
+	std.Log(LevelWarn, msg, fields...)
+}
+
+func Error(msg string, fields ...Field) {
+	std.Log(LevelError, msg, fields...)
+}
@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fixedTime() time.Time {
+	return time.Date(2021, 9, 23, 7, 3, 55, 0, time.UTC)
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("WARN")
+	require.NoError(t, err)
+	assert.Equal(t, LevelWarn, level)
+
+	_, err = ParseLevel("trace")
+	assert.Error(t, err)
+}
+
+func TestLoggerText(t *testing.T) {
+	out := &bytes.Buffer{}
+	l := New(out, LevelInfo, FormatText)
+	l.now = fixedTime
+
+	l.Debug("hidden")
+	l.Info("server started", F("server", "http"), F("address", "127.0.0.1:8080"))
+	l.Error("shutdown failed", F("error", errors.New("timeout exceeded")), F("delay", 5*time.Second))
+
+	assert.Equal(t, "2021-09-23T07:03:55.000Z INFO server started server=http address=127.0.0.1:8080\n"+
+		"2021-09-23T07:03:55.000Z ERROR shutdown failed error=\"timeout exceeded\" delay=5s\n", out.String())
+}
+
+func TestLoggerJSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	l := New(out, LevelDebug, FormatJSON)
+	l.now = fixedTime
+
+	l.Debug("server draining", F("server", "tcp"), F("active-connections", 3), F("delay", time.Second))
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, map[string]interface{}{
+		"time":               "2021-09-23T07:03:55.000Z",
+		"level":              "debug",
+		"msg":                "server draining",
+		"server":             "tcp",
+		"active-connections": float64(3),
+		"delay":              "1s",
+	}, entry)
+}
+
+func TestLoggerWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	l := New(out, LevelInfo, FormatText)
+	l.now = fixedTime
+
+	std := log.New(l.Writer(LevelWarn), "", 0)
+	std.Printf("could not write to response body: %s", "broken pipe")
+
+	assert.Equal(t, "2021-09-23T07:03:55.000Z WARN could not write to response body: broken pipe\n", out.String())
+}
@@ -0,0 +1,193 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "serverbin"
+
+// Metrics of the test traffic, all methods can be called on a nil Metrics
+type Metrics struct {
+	httpRequests        *prometheus.CounterVec
+	httpDuration        *prometheus.HistogramVec
+	httpInFlight        *prometheus.GaugeVec
+	connections         *prometheus.CounterVec
+	connectionsInFlight *prometheus.GaugeVec
+	packets             *prometheus.CounterVec
+	bytesRead           *prometheus.CounterVec
+	bytesWritten        *prometheus.CounterVec
+	proxyProtocol       *prometheus.CounterVec
+	proxyProtocolErrors *prometheus.CounterVec
+}
+
+// New creates and registers all metrics
+func New(registerer prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of http requests by context, handler, method and status code.",
+		}, []string{"context", "handler", "method", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of http requests by context, handler, method and status code.",
+			Buckets:   []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30, 60, 300},
+		}, []string{"context", "handler", "method", "code"}),
+		httpInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_in_flight",
+			Help:      "Number of http requests in progress by context and handler.",
+		}, []string{"context", "handler"}),
+		connections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "tcp",
+			Name:      "connections_total",
+			Help:      "Number of accepted tcp connections by server.",
+		}, []string{"server"}),
+		connectionsInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "tcp",
+			Name:      "connections_in_flight",
+			Help:      "Number of open tcp connections by server.",
+		}, []string{"server"}),
+		packets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "udp",
+			Name:      "packets_total",
+			Help:      "Number of received udp packets by server.",
+		}, []string{"server"}),
+		bytesRead: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "read_bytes_total",
+			Help:      "Number of bytes read by tcp and udp servers.",
+		}, []string{"server", "protocol"}),
+		bytesWritten: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "written_bytes_total",
+			Help:      "Number of bytes written by tcp and udp servers.",
+		}, []string{"server", "protocol"}),
+		proxyProtocol: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "proxy_protocol",
+			Name:      "detected_total",
+			Help:      "Number of detected proxy protocol headers by version.",
+		}, []string{"version"}),
+		proxyProtocolErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "proxy_protocol",
+			Name:      "errors_total",
+			Help:      "Number of proxy protocol parse errors by version.",
+		}, []string{"version"}),
+	}
+
+	for _, c := range []prometheus.Collector{
+		m.httpRequests,
+		m.httpDuration,
+		m.httpInFlight,
+		m.connections,
+		m.connectionsInFlight,
+		m.packets,
+		m.bytesRead,
+		m.bytesWritten,
+		m.proxyProtocol,
+		m.proxyProtocolErrors,
+	} {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// InstrumentHandler counts the requests, the latency and the requests in progress of a handler
+func (m *Metrics) InstrumentHandler(context, handler string, next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+
+	labels := prometheus.Labels{"context": context, "handler": handler}
+
+	standard := promhttp.InstrumentHandlerDuration(m.httpDuration.MustCurryWith(labels),
+		promhttp.InstrumentHandlerCounter(m.httpRequests.MustCurryWith(labels), next),
+	)
+
+	// extension methods share one label value to bound the cardinality
+	otherLabels := prometheus.Labels{"context": context, "handler": handler, "method": "other"}
+	other := promhttp.InstrumentHandlerDuration(m.httpDuration.MustCurryWith(otherLabels),
+		promhttp.InstrumentHandlerCounter(m.httpRequests.MustCurryWith(otherLabels), next),
+	)
+
+	return promhttp.InstrumentHandlerInFlight(m.httpInFlight.With(labels),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+				http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+				standard.ServeHTTP(w, r)
+			default:
+				other.ServeHTTP(w, r)
+			}
+		}),
+	)
+}
+
+// ConnectionOpened counts an accepted tcp connection, the returned function must be called on close
+func (m *Metrics) ConnectionOpened(server string) func() {
+	if m == nil {
+		return func() {}
+	}
+
+	m.connections.WithLabelValues(server).Inc()
+
+	inFlight := m.connectionsInFlight.WithLabelValues(server)
+	inFlight.Inc()
+
+	return inFlight.Dec
+}
+
+// PacketReceived counts a udp packet
+func (m *Metrics) PacketReceived(server string) {
+	if m == nil {
+		return
+	}
+
+	m.packets.WithLabelValues(server).Inc()
+}
+
+// BytesRead counts the bytes read from a client
+func (m *Metrics) BytesRead(server, protocol string, n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+
+	m.bytesRead.WithLabelValues(server, protocol).Add(float64(n))
+}
+
+// BytesWritten counts the bytes written to a client
+func (m *Metrics) BytesWritten(server, protocol string, n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+
+	m.bytesWritten.WithLabelValues(server, protocol).Add(float64(n))
+}
+
+// ProxyProtocol counts a detected proxy protocol header and its parse error
+func (m *Metrics) ProxyProtocol(version string, err error) {
+	if m == nil {
+		return
+	}
+
+	m.proxyProtocol.WithLabelValues(version).Inc()
+
+	if err != nil {
+		m.proxyProtocolErrors.WithLabelValues(version).Inc()
+	}
+}
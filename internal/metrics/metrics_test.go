@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrumentHandler(t *testing.T) {
+	m, err := New(prometheus.NewRegistry())
+	require.Nil(t, err)
+
+	handler := m.InstrumentHandler("/a", "status", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	for i := 0; i < 3; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/a/status/418", nil))
+	}
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("/a", "status", "post", "418")))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PROPFIND", "/a/status/418", nil))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("/a", "status", "other", "418")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.httpInFlight.WithLabelValues("/a", "status")))
+}
+
+func TestConnections(t *testing.T) {
+	m, err := New(prometheus.NewRegistry())
+	require.Nil(t, err)
+
+	done := m.ConnectionOpened("tcp")
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.connectionsInFlight.WithLabelValues("tcp")))
+
+	done()
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.connectionsInFlight.WithLabelValues("tcp")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.connections.WithLabelValues("tcp")))
+
+	m.BytesRead("tcp", "tcp", 10)
+	m.BytesWritten("tcp", "tcp", 20)
+	assert.Equal(t, 10.0, testutil.ToFloat64(m.bytesRead.WithLabelValues("tcp", "tcp")))
+	assert.Equal(t, 20.0, testutil.ToFloat64(m.bytesWritten.WithLabelValues("tcp", "tcp")))
+
+	m.ProxyProtocol("v1", nil)
+	m.ProxyProtocol("v2", errors.New("invalid header"))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.proxyProtocol.WithLabelValues("v1")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.proxyProtocolErrors.WithLabelValues("v1")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.proxyProtocolErrors.WithLabelValues("v2")))
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+
+	next := http.NotFoundHandler()
+	assert.NotNil(t, m.InstrumentHandler("/", "status", next))
+
+	m.ConnectionOpened("tcp")()
+	m.PacketReceived("udp")
+	m.BytesRead("tcp", "tcp", 1)
+	m.BytesWritten("tcp", "tcp", 1)
+	m.ProxyProtocol("v1", nil)
+}
+
+func TestRegisterTwice(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	_, err := New(registry)
+	require.Nil(t, err)
+
+	_, err = New(registry)
+	require.NotNil(t, err)
+}
@@ -0,0 +1,526 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Synthetic metric types
+const (
+	SyntheticGauge     = "gauge"
+	SyntheticCounter   = "counter"
+	SyntheticHistogram = "histogram"
+)
+
+// Generator types
+const (
+	GeneratorSine       = "sine"
+	GeneratorRandomWalk = "random-walk"
+	GeneratorStep       = "step"
+)
+
+//nolint:gochecknoglobals // errors and compiled patterns
+var (
+	errInvalidSynthetic  = errors.New("invalid synthetic metric")
+	errConflictSynthetic = errors.New("conflicting synthetic metric")
+	errUnknownSynthetic  = errors.New("unknown synthetic metric")
+
+	metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNamePattern  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	// names of the serverbin and go collector metrics
+	reservedPrefixes = []string{namespace + "_", "go_", "process_", "promhttp_"}
+)
+
+// Duration is a time.Duration which is unmarshalled from a string like 1m30s
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Generator computes the value of a gauge on each scrape
+type Generator struct {
+	Type string  `json:"type"`
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+	// Period of the sine wave or the duration of each step
+	Period Duration `json:"period,omitempty"`
+	// Step is the maximum change of a random walk on each scrape
+	Step float64 `json:"step,omitempty"`
+	// Values of the steps
+	Values []float64 `json:"values,omitempty"`
+}
+
+// SyntheticUpdate creates or updates a series of a synthetic metric
+type SyntheticUpdate struct {
+	Type   string            `json:"type"`
+	Help   string            `json:"help,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// Value is set on a gauge and added to a counter
+	Value *float64 `json:"value,omitempty"`
+	// Observations are added to a histogram
+	Observations []float64  `json:"observations,omitempty"`
+	Buckets      []float64  `json:"buckets,omitempty"`
+	Generator    *Generator `json:"generator,omitempty"`
+}
+
+// Synthetic are metrics with values controlled by the management api
+type Synthetic struct {
+	mu       sync.Mutex
+	metrics  map[string]*syntheticMetric
+	now      func() time.Time
+	gatherer prometheus.Gatherer
+}
+
+type syntheticMetric struct {
+	Name       string                      `json:"name"`
+	Type       string                      `json:"type"`
+	Help       string                      `json:"help,omitempty"`
+	LabelNames []string                    `json:"label-names,omitempty"`
+	Buckets    []float64                   `json:"buckets,omitempty"`
+	Series     map[string]*syntheticSeries `json:"-"`
+}
+
+type syntheticSeries struct {
+	Labels    map[string]string `json:"labels,omitempty"`
+	Value     float64           `json:"value"`
+	Count     uint64            `json:"count,omitempty"`
+	Sum       float64           `json:"sum,omitempty"`
+	Generator *Generator        `json:"generator,omitempty"`
+
+	buckets []uint64
+	started time.Time
+}
+
+// NewSynthetic creates an empty set of synthetic metrics, the names of the metrics of the gatherer can not be used
+func NewSynthetic(gatherer prometheus.Gatherer) *Synthetic {
+	return &Synthetic{
+		metrics:  map[string]*syntheticMetric{},
+		now:      time.Now,
+		gatherer: gatherer,
+	}
+}
+
+var _ prometheus.Collector = (*Synthetic)(nil)
+
+// Describe sends no descriptors, the synthetic metrics are created at runtime. The registry does not check the
+// collector, Update rejects the names of registered metrics instead.
+func (s *Synthetic) Describe(chan<- *prometheus.Desc) {
+}
+
+// Collect sends the current values of all synthetic metrics
+func (s *Synthetic) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+
+	for _, m := range s.metrics {
+		desc := prometheus.NewDesc(m.Name, m.help(), m.LabelNames, nil)
+
+		for _, series := range m.Series {
+			values := make([]string, len(m.LabelNames))
+			for i, name := range m.LabelNames {
+				values[i] = series.Labels[name]
+			}
+
+			var metric prometheus.Metric
+			var err error
+
+			switch m.Type {
+			case SyntheticGauge:
+				metric, err = prometheus.NewConstMetric(desc, prometheus.GaugeValue, series.next(now), values...)
+			case SyntheticCounter:
+				metric, err = prometheus.NewConstMetric(desc, prometheus.CounterValue, series.Value, values...)
+			case SyntheticHistogram:
+				buckets := make(map[float64]uint64, len(m.Buckets))
+				for i, upper := range m.Buckets {
+					buckets[upper] = series.buckets[i]
+				}
+
+				metric, err = prometheus.NewConstHistogram(desc, series.Count, series.Sum, buckets, values...)
+			}
+
+			if err != nil {
+				metric = prometheus.NewInvalidMetric(desc, err)
+			}
+
+			ch <- metric
+		}
+	}
+}
+
+func (m *syntheticMetric) help() string {
+	if m.Help == "" {
+		return "Synthetic " + m.Type + "."
+	}
+
+	return m.Help
+}
+
+// next returns the current value, generated values change on each call
+func (s *syntheticSeries) next(now time.Time) float64 {
+	g := s.Generator
+	if g == nil {
+		return s.Value
+	}
+
+	elapsed := now.Sub(s.started)
+
+	switch g.Type {
+	case GeneratorSine:
+		phase := 2 * math.Pi * float64(elapsed) / float64(g.Period)
+		s.Value = g.Min + (g.Max-g.Min)*(1+math.Sin(phase))/2
+	case GeneratorRandomWalk:
+		//nolint:gosec // no security context
+		s.Value = math.Max(g.Min, math.Min(g.Max, s.Value+(2*rand.Float64()-1)*g.Step))
+	case GeneratorStep:
+		s.Value = g.Values[int(elapsed/time.Duration(g.Period))%len(g.Values)]
+	}
+
+	return s.Value
+}
+
+// Update creates or updates the series with the labels of the update
+func (s *Synthetic) Update(name string, u SyntheticUpdate) error {
+	if err := u.validate(name); err != nil {
+		return err
+	}
+
+	labelNames := make([]string, 0, len(u.Labels))
+	for label := range u.Labels {
+		labelNames = append(labelNames, label)
+	}
+
+	sort.Strings(labelNames)
+
+	buckets := u.Buckets
+	if u.Type == SyntheticHistogram && len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+
+	// gathering collects the synthetic metrics too
+	s.mu.Lock()
+	_, exists := s.metrics[name]
+	synthetic := make(map[string]bool, len(s.metrics))
+	for n := range s.metrics {
+		synthetic[n] = true
+	}
+	s.mu.Unlock()
+
+	if !exists {
+		if err := s.registered(name, u.Type, synthetic); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.metrics[name]
+	if !ok {
+		m = &syntheticMetric{
+			Name:       name,
+			Type:       u.Type,
+			LabelNames: labelNames,
+			Buckets:    buckets,
+			Series:     map[string]*syntheticSeries{},
+		}
+	}
+
+	switch {
+	case m.Type != u.Type:
+		return fmt.Errorf("%w: %s is a %s", errConflictSynthetic, name, m.Type)
+	case strings.Join(m.LabelNames, ",") != strings.Join(labelNames, ","):
+		return fmt.Errorf("%w: %s has the labels [%s]", errConflictSynthetic, name, strings.Join(m.LabelNames, ", "))
+	case len(u.Buckets) > 0 && fmt.Sprint(m.Buckets) != fmt.Sprint(u.Buckets):
+		return fmt.Errorf("%w: %s has the buckets %v", errConflictSynthetic, name, m.Buckets)
+	}
+
+	if u.Help != "" {
+		m.Help = u.Help
+	}
+
+	key := seriesKey(m.LabelNames, u.Labels)
+
+	series, ok := m.Series[key]
+	if !ok {
+		series = &syntheticSeries{
+			Labels:  u.Labels,
+			buckets: make([]uint64, len(m.Buckets)),
+			started: s.now(),
+		}
+	}
+
+	switch m.Type {
+	case SyntheticGauge:
+		if u.Value != nil {
+			series.Value = *u.Value
+		}
+
+		if u.Generator != nil {
+			series.Generator = u.Generator
+			series.started = s.now()
+
+			// a random walk starts with the value
+			if u.Value == nil {
+				series.Value = u.Generator.Min
+			}
+		} else if u.Value != nil {
+			series.Generator = nil
+		}
+	case SyntheticCounter:
+		if u.Value != nil {
+			series.Value += *u.Value
+		}
+	case SyntheticHistogram:
+		for _, v := range u.Observations {
+			series.Count++
+			series.Sum += v
+
+			for i, upper := range m.Buckets {
+				if v <= upper {
+					series.buckets[i]++
+				}
+			}
+		}
+	}
+
+	m.Series[key] = series
+	s.metrics[name] = m
+
+	return nil
+}
+
+// registered returns a conflict if a metric of another collector uses one of the names of the new metric
+func (s *Synthetic) registered(name, metricType string, synthetic map[string]bool) error {
+	if s.gatherer == nil {
+		return nil
+	}
+
+	// families are returned even if some metrics are invalid
+	families, _ := s.gatherer.Gather()
+
+	for _, family := range families {
+		if synthetic[family.GetName()] {
+			continue
+		}
+
+		for _, used := range seriesNames(family.GetName(), strings.ToLower(family.GetType().String())) {
+			for _, n := range seriesNames(name, metricType) {
+				if n == used {
+					return fmt.Errorf("%w: %s is used by the %s %s", errConflictSynthetic, n, strings.ToLower(family.GetType().String()), family.GetName())
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// seriesNames returns the names of the exposed series of a metric
+func seriesNames(name, metricType string) []string {
+	switch metricType {
+	case SyntheticHistogram, "summary":
+		return []string{name, name + "_bucket", name + "_sum", name + "_count"}
+	default:
+		return []string{name}
+	}
+}
+
+// Delete removes a synthetic metric with all series
+func (s *Synthetic) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.metrics[name]; !ok {
+		return fmt.Errorf("%w: %s", errUnknownSynthetic, name)
+	}
+
+	delete(s.metrics, name)
+
+	return nil
+}
+
+func seriesKey(names []string, labels map[string]string) string {
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = labels[name]
+	}
+
+	return strings.Join(values, "\xff")
+}
+
+func (u SyntheticUpdate) validate(name string) error {
+	if !metricNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: %q is not a valid metric name", errInvalidSynthetic, name)
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return fmt.Errorf("%w: the prefix %q is reserved", errInvalidSynthetic, prefix)
+		}
+	}
+
+	for label := range u.Labels {
+		if !labelNamePattern.MatchString(label) || strings.HasPrefix(label, "__") {
+			return fmt.Errorf("%w: %q is not a valid label name", errInvalidSynthetic, label)
+		}
+	}
+
+	switch u.Type {
+	case SyntheticGauge:
+	case SyntheticCounter:
+		if u.Value != nil && *u.Value < 0 {
+			return fmt.Errorf("%w: a counter can not be decreased", errInvalidSynthetic)
+		}
+	case SyntheticHistogram:
+		for i := 1; i < len(u.Buckets); i++ {
+			if u.Buckets[i] <= u.Buckets[i-1] {
+				return fmt.Errorf("%w: buckets must be in increasing order", errInvalidSynthetic)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: type must be one of %s, %s, %s", errInvalidSynthetic, SyntheticGauge, SyntheticCounter, SyntheticHistogram)
+	}
+
+	if u.Type != SyntheticHistogram && (len(u.Observations) > 0 || len(u.Buckets) > 0) {
+		return fmt.Errorf("%w: observations and buckets are only supported by histograms", errInvalidSynthetic)
+	}
+
+	if u.Type != SyntheticGauge && u.Generator != nil {
+		return fmt.Errorf("%w: generators are only supported by gauges", errInvalidSynthetic)
+	}
+
+	if g := u.Generator; g != nil {
+		switch g.Type {
+		case GeneratorSine:
+			if g.Period <= 0 {
+				return fmt.Errorf("%w: a sine generator requires a period", errInvalidSynthetic)
+			}
+		case GeneratorRandomWalk:
+			if g.Step <= 0 {
+				return fmt.Errorf("%w: a random walk generator requires a step", errInvalidSynthetic)
+			}
+		case GeneratorStep:
+			if g.Period <= 0 || len(g.Values) == 0 {
+				return fmt.Errorf("%w: a step generator requires a period and values", errInvalidSynthetic)
+			}
+		default:
+			return fmt.Errorf("%w: generator type must be one of %s, %s, %s", errInvalidSynthetic, GeneratorSine, GeneratorRandomWalk, GeneratorStep)
+		}
+
+		if g.Min > g.Max {
+			return fmt.Errorf("%w: generator min is greater than max", errInvalidSynthetic)
+		}
+	}
+
+	return nil
+}
+
+// Handler is the management api of the synthetic metrics, PUT and DELETE {prefix}{name} and GET {prefix}
+func (s *Synthetic) Handler(prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, prefix)
+
+		switch {
+		case r.Method == http.MethodGet && name == "":
+			s.list(w)
+		case r.Method == http.MethodPut && name != "":
+			var u SyntheticUpdate
+
+			decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+			decoder.DisallowUnknownFields()
+
+			if err := decoder.Decode(&u); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			writeSyntheticError(w, s.Update(name, u))
+		case r.Method == http.MethodDelete && name != "":
+			writeSyntheticError(w, s.Delete(name))
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (s *Synthetic) list(w http.ResponseWriter) {
+	type item struct {
+		*syntheticMetric
+		Series []*syntheticSeries `json:"series"`
+	}
+
+	s.mu.Lock()
+
+	items := make([]item, 0, len(s.metrics))
+	for _, m := range s.metrics {
+		i := item{syntheticMetric: m}
+		for _, series := range m.Series {
+			i.Series = append(i.Series, series)
+		}
+
+		items = append(items, i)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name < items[j].Name
+	})
+
+	body, err := json.MarshalIndent(items, "", " ")
+
+	s.mu.Unlock()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(append(body, '\n'))
+}
+
+func writeSyntheticError(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, errInvalidSynthetic):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errConflictSynthetic):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errUnknownSynthetic):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func put(t *testing.T, handler http.Handler, name, body string) int {
+	r := httptest.NewRequest(http.MethodPut, "/-/synthetic-metrics/"+name, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	return w.Code
+}
+
+func TestSyntheticHandler(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	s := NewSynthetic(registry)
+	require.Nil(t, registry.Register(s))
+	require.Nil(t, registry.Register(prometheus.NewGauge(prometheus.GaugeOpts{Name: "app_up", Help: "Up."})))
+	require.Nil(t, registry.Register(prometheus.NewGauge(prometheus.GaugeOpts{Name: "app_requests_count", Help: "Requests."})))
+	require.Nil(t, registry.Register(prometheus.NewSummary(prometheus.SummaryOpts{Name: "app_seconds", Help: "Seconds."})))
+
+	handler := s.Handler("/-/synthetic-metrics/")
+
+	assert.Equal(t, http.StatusNoContent, put(t, handler, "queue_size", `{"type": "gauge", "help": "Queue size.", "labels": {"queue": "a"}, "value": 3}`))
+	assert.Equal(t, http.StatusNoContent, put(t, handler, "queue_size", `{"type": "gauge", "labels": {"queue": "b"}, "value": 5}`))
+	assert.Equal(t, http.StatusNoContent, put(t, handler, "jobs_total", `{"type": "counter", "value": 2}`))
+	assert.Equal(t, http.StatusNoContent, put(t, handler, "jobs_total", `{"type": "counter", "value": 3}`))
+	assert.Equal(t, http.StatusNoContent, put(t, handler, "job_seconds", `{"type": "histogram", "buckets": [1, 10], "observations": [0.5, 5, 50]}`))
+
+	expected := `
+# HELP job_seconds Synthetic histogram.
+# TYPE job_seconds histogram
+job_seconds_bucket{le="1"} 1
+job_seconds_bucket{le="10"} 2
+job_seconds_bucket{le="+Inf"} 3
+job_seconds_sum 55.5
+job_seconds_count 3
+# HELP jobs_total Synthetic counter.
+# TYPE jobs_total counter
+jobs_total 5
+# HELP queue_size Queue size.
+# TYPE queue_size gauge
+queue_size{queue="a"} 3
+queue_size{queue="b"} 5
+`
+	require.Nil(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "job_seconds", "jobs_total", "queue_size"))
+
+	// conflicts
+	assert.Equal(t, http.StatusConflict, put(t, handler, "queue_size", `{"type": "counter", "labels": {"queue": "a"}}`))
+	assert.Equal(t, http.StatusConflict, put(t, handler, "queue_size", `{"type": "gauge", "labels": {"name": "a"}}`))
+	assert.Equal(t, http.StatusConflict, put(t, handler, "job_seconds", `{"type": "histogram", "buckets": [1, 5]}`))
+
+	// registered metrics
+	assert.Equal(t, http.StatusConflict, put(t, handler, "app_up", `{"type": "gauge", "value": 1}`))
+	assert.Equal(t, http.StatusConflict, put(t, handler, "app_seconds_count", `{"type": "counter", "value": 1}`))
+	assert.Equal(t, http.StatusConflict, put(t, handler, "app_requests", `{"type": "histogram", "buckets": [1]}`))
+
+	// invalid
+	assert.Equal(t, http.StatusBadRequest, put(t, handler, "jobs_total", `{"type": "counter", "value": -1}`))
+	assert.Equal(t, http.StatusBadRequest, put(t, handler, "serverbin_http_requests_total", `{"type": "counter"}`))
+	assert.Equal(t, http.StatusBadRequest, put(t, handler, "go_goroutines", `{"type": "gauge"}`))
+	assert.Equal(t, http.StatusBadRequest, put(t, handler, "invalid-name", `{"type": "gauge"}`))
+	assert.Equal(t, http.StatusBadRequest, put(t, handler, "summary", `{"type": "summary"}`))
+	assert.Equal(t, http.StatusBadRequest, put(t, handler, "jobs_total", `{"type": "counter", "generator": {"type": "sine", "period": "1m"}}`))
+	assert.Equal(t, http.StatusBadRequest, put(t, handler, "queue_size", `{"type": "gauge", "unknown": 1}`))
+
+	// list and delete
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/-/synthetic-metrics/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name": "queue_size"`)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/-/synthetic-metrics/queue_size", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/-/synthetic-metrics/queue_size", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSyntheticGenerators(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s := NewSynthetic(nil)
+	s.now = func() time.Time {
+		return now
+	}
+
+	value := func(name string) float64 {
+		for _, series := range s.metrics[name].Series {
+			return series.next(now)
+		}
+
+		return 0
+	}
+
+	require.Nil(t, s.Update("sine", SyntheticUpdate{Type: SyntheticGauge, Generator: &Generator{
+		Type: GeneratorSine, Min: 0, Max: 10, Period: Duration(time.Minute),
+	}}))
+	require.Nil(t, s.Update("step", SyntheticUpdate{Type: SyntheticGauge, Generator: &Generator{
+		Type: GeneratorStep, Period: Duration(time.Minute), Values: []float64{1, 2, 3},
+	}}))
+	require.Nil(t, s.Update("walk", SyntheticUpdate{Type: SyntheticGauge, Generator: &Generator{
+		Type: GeneratorRandomWalk, Min: 0, Max: 1, Step: 5,
+	}}))
+
+	assert.InDelta(t, 5.0, value("sine"), 0.001)
+	assert.Equal(t, 1.0, value("step"))
+
+	now = now.Add(15 * time.Second)
+	assert.InDelta(t, 10.0, value("sine"), 0.001)
+
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, 3.0, value("step"))
+
+	for i := 0; i < 10; i++ {
+		v := value("walk")
+		assert.True(t, v >= 0 && v <= 1)
+	}
+}
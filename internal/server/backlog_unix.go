@@ -0,0 +1,34 @@
+//go:build !windows
+// +build !windows
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// listenBacklog calls listen again on the socket which updates the backlog, the os may cap the value, i.e. with
+// net.core.somaxconn on linux
+func listenBacklog(l net.Listener, backlog int) error {
+	sc, ok := l.(syscall.Conn)
+	if !ok {
+		return fmt.Errorf("%T does not support a listen backlog", l)
+	}
+
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var listenErr error
+
+	if err := raw.Control(func(fd uintptr) {
+		listenErr = syscall.Listen(int(fd), backlog)
+	}); err != nil {
+		return err
+	}
+
+	return listenErr
+}
@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package server
+
+import (
+	"errors"
+	"net"
+)
+
+// listenBacklog is not supported on windows, a listening socket can not be changed
+func listenBacklog(_ net.Listener, _ int) error {
+	return errors.New("listen backlog is not supported on windows")
+}
@@ -1,61 +1,212 @@
 package server
 
 import (
+	"bufio"
 	"context"
-	"log"
+	"crypto/tls"
+	"fmt"
+	"math/rand"
+	"net"
 	"net/http"
+	"os"
+	"sync/atomic"
 	"time"
+
+	"github.com/marsom/serverbin/internal/core"
+	"github.com/marsom/serverbin/internal/logging"
+)
+
+// Connection close modes
+const (
+	ConnectionCloseNever  = "never"
+	ConnectionCloseAlways = "always"
+	ConnectionCloseRandom = "random"
 )
 
+// HttpConnection configures timeouts and the keep-alive behaviour of the client connections
+type HttpConnection struct {
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	DisableKeepAlives bool
+	// Close adds a "Connection: close" header to the responses, never (default), always or random
+	Close string
+	// CloseProbability is the probability of the random close mode
+	CloseProbability float64
+	// MaxRequests closes the connection after the given number of requests, 0 is unlimited
+	MaxRequests int64
+}
+
 type HttpServer struct {
 	Name                    string
 	Address                 string
-	ShutdownDelay           time.Duration
+	SocketMode              os.FileMode
 	GracefulShutdownTimeout time.Duration
-	ReadinessOn             func()
-	ReadinessOff            func()
-	Handler                 *http.ServeMux
+	Handler                 http.Handler
+	TLSConfig               *tls.Config
+	Connection              HttpConnection
+	Limits                  Limits
+
+	listener net.Listener
+	srv      *http.Server
+	errc     chan error
+	active   int64
 }
 
-func (s *HttpServer) ListenAndServe(ctx context.Context) error {
-	srv := &http.Server{
-		Addr:    s.Address,
-		Handler: s.Handler,
+var _ Service = (*HttpServer)(nil)
+
+func (s *HttpServer) Start() error {
+	switch s.Connection.Close {
+	case "", ConnectionCloseNever, ConnectionCloseAlways, ConnectionCloseRandom:
+	default:
+		return fmt.Errorf("%s server: unknown connection close mode %q", s.Name, s.Connection.Close)
+	}
+
+	l, err := Listen(s.Address, s.SocketMode)
+	if err != nil {
+		return fmt.Errorf("%s server listen failed: %w", s.Name, err)
+	}
+
+	limited, err := limit(l, s.Limits, s.reject)
+	if err != nil {
+		_ = l.Close()
+
+		return fmt.Errorf("%s server: %w", s.Name, err)
+	}
+
+	l = limited
+
+	s.listener = l
+	s.errc = make(chan error, 1)
+	s.srv = &http.Server{
+		Handler:           s.handler(),
+		TLSConfig:         s.TLSConfig,
+		ReadTimeout:       s.Connection.ReadTimeout,
+		ReadHeaderTimeout: s.Connection.ReadHeaderTimeout,
+		WriteTimeout:      s.Connection.WriteTimeout,
+		IdleTimeout:       s.Connection.IdleTimeout,
+		MaxHeaderBytes:    s.Connection.MaxHeaderBytes,
+		ConnState:         s.connState,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return core.WithConn(ctx, unwrapConn(c))
+		},
 	}
 
+	s.srv.SetKeepAlivesEnabled(!s.Connection.DisableKeepAlives)
+
 	go func() {
-		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-			log.Fatalf("%s server listen failed: %s\n", s.Name, err)
+		var err error
+		if s.TLSConfig != nil {
+			err = s.srv.ServeTLS(l, "", "")
+		} else {
+			err = s.srv.Serve(l)
+		}
+
+		if err != http.ErrServerClosed {
+			s.errc <- fmt.Errorf("%s server failed: %w", s.Name, err)
 		}
 	}()
 
-	// let ListenAndServe fail before we print we are ready
-	// not the best way to to this, but it should work in most cases
-	time.Sleep(5 * time.Millisecond)
+	logging.Info("server started", logging.F("server", s.Name), logging.F("address", s.Address))
+
+	return nil
+}
+
+func (s *HttpServer) Done() <-chan error {
+	return s.errc
+}
+
+func (s *HttpServer) Shutdown(ctx context.Context) error {
+	// without a timeout active connections are closed immediately
+	ctx, cancel := context.WithTimeout(ctx, s.GracefulShutdownTimeout)
+	defer cancel()
+
+	done := make(chan struct{})
 
-	log.Printf("%s server started on %s", s.Name, s.Address)
-	if s.ReadinessOn != nil {
-		s.ReadinessOn()
+	var err error
+	go func() {
+		err = s.srv.Shutdown(ctx)
+		close(done)
+	}()
+
+	if drainErr := waitDrained(ctx, s.Name, done, s.ActiveConnections); drainErr != nil {
+		<-done
+		err = drainErr
 	}
 
-	// block
-	<-ctx.Done()
+	if err != nil {
+		active := s.ActiveConnections()
+		_ = s.srv.Close()
 
-	log.Printf("%s server shutdown initalized (delay=%s)", s.Name, s.ShutdownDelay)
-	if s.ReadinessOff != nil {
-		s.ReadinessOff()
+		return fmt.Errorf("%s server shutdown failed (timeout=%s, active connections=%d): %w", s.Name, s.GracefulShutdownTimeout, active, err)
 	}
 
-	time.Sleep(s.ShutdownDelay)
+	logging.Info("server stopped", logging.F("server", s.Name))
 
-	ctxShutDown, cancel := context.WithTimeout(context.Background(), s.GracefulShutdownTimeout)
-	defer cancel()
+	return nil
+}
 
-	if err := srv.Shutdown(ctxShutDown); err != nil {
-		log.Fatalf("%s server shutdown failed (timeout=%s): %s", s.Name, s.GracefulShutdownTimeout, err)
+// Addr returns the address of the started server
+func (s *HttpServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// ActiveConnections returns the number of open connections
+func (s *HttpServer) ActiveConnections() int64 {
+	return atomic.LoadInt64(&s.active)
+}
+
+func (s *HttpServer) connState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		atomic.AddInt64(&s.active, 1)
+	case http.StateHijacked, http.StateClosed:
+		atomic.AddInt64(&s.active, -1)
 	}
+}
 
-	log.Printf("%s server stopped", s.Name)
+// handler counts the requests of a connection and closes the connection if requested
+func (s *HttpServer) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, ok := core.ConnectionFromContext(r.Context()); ok {
+			if s.Connection.close(conn.NextRequest()) {
+				w.Header().Set("Connection", "close")
+			}
+		}
 
-	return nil
+		s.Handler.ServeHTTP(w, r)
+	})
+}
+
+func (c HttpConnection) close(requests int64) bool {
+	if c.MaxRequests > 0 && requests >= c.MaxRequests {
+		return true
+	}
+
+	switch c.Close {
+	case ConnectionCloseAlways:
+		return true
+	case ConnectionCloseRandom:
+		//nolint:gosec // no security context
+		return rand.Float64() < c.CloseProbability
+	default:
+		return false
+	}
+}
+
+// reject responds with 503 to a connection which exceeds the max connections
+func (s *HttpServer) reject(conn net.Conn) {
+	if s.TLSConfig != nil {
+		conn = tls.Server(conn, s.TLSConfig)
+	}
+
+	if _, err := http.ReadRequest(bufio.NewReader(conn)); err != nil {
+		return
+	}
+
+	body := overloadBody()
+
+	_, _ = fmt.Fprintf(conn, "HTTP/1.1 503 Service Unavailable\r\nContent-Type: application/json\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", len(body), body)
 }
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/marsom/serverbin/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startHttpServer(t *testing.T, connection HttpConnection) string {
+	srv := &HttpServer{
+		Name:       "http",
+		Address:    "127.0.0.1:0",
+		Connection: connection,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	}
+	require.Nil(t, srv.Start())
+
+	t.Cleanup(func() {
+		_ = srv.Shutdown(context.Background())
+	})
+
+	return "http://" + srv.Addr().String()
+}
+
+func TestHttpServerMaxRequests(t *testing.T) {
+	url := startHttpServer(t, HttpConnection{MaxRequests: 2})
+
+	client := &http.Client{Transport: &http.Transport{}}
+
+	for _, expected := range []bool{false, true, false, true} {
+		resp, err := client.Get(url)
+		require.Nil(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, expected, resp.Close)
+	}
+}
+
+func TestHttpServerConnectionClose(t *testing.T) {
+	url := startHttpServer(t, HttpConnection{Close: ConnectionCloseAlways})
+
+	resp, err := http.Get(url)
+	require.Nil(t, err)
+	resp.Body.Close()
+
+	assert.True(t, resp.Close)
+
+	url = startHttpServer(t, HttpConnection{Close: ConnectionCloseRandom, CloseProbability: 0})
+
+	resp, err = http.Get(url)
+	require.Nil(t, err)
+	resp.Body.Close()
+
+	assert.False(t, resp.Close)
+}
+
+func TestHttpServerUnknownCloseMode(t *testing.T) {
+	srv := &HttpServer{Name: "http", Address: "127.0.0.1:0", Connection: HttpConnection{Close: "sometimes"}}
+	require.NotNil(t, srv.Start())
+}
+
+func TestHttpServerTLSPeerCredentials(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are only supported on linux")
+	}
+
+	config, err := TLSConfig("", "")
+	require.Nil(t, err)
+
+	path := filepath.Join(t.TempDir(), "https.sock")
+
+	srv := &HttpServer{
+		Name:      "https",
+		Address:   "unix:" + path,
+		TLSConfig: config,
+		Limits:    Limits{MaxConnections: 1},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, _ := core.ConnFromContext(r.Context())
+
+			cred, err := core.GetPeerCredentials(conn)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			_, _ = fmt.Fprint(w, cred.Pid)
+		}),
+	}
+	require.Nil(t, srv.Start())
+
+	t.Cleanup(func() {
+		_ = srv.Shutdown(context.Background())
+	})
+
+	client := &http.Client{Transport: &http.Transport{
+		//nolint:gosec // self signed test certificate
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+
+	resp, err := client.Get("https://localhost/")
+	require.Nil(t, err)
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), string(body))
+}
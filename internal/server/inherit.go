@@ -0,0 +1,369 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/marsom/serverbin/internal/logging"
+)
+
+// Inherited listeners are passed by systemd socket activation or by a parent process on a restart.
+// https://www.freedesktop.org/software/systemd/man/sd_listen_fds.html
+const (
+	listenFdsStart = 3
+
+	envListenPid     = "LISTEN_PID"
+	envListenFds     = "LISTEN_FDS"
+	envListenFdNames = "LISTEN_FDNAMES"
+
+	systemdPrefix = "systemd:"
+	fdPrefix      = "fd:"
+
+	// udpPrefix separates the udp sockets from the tcp listeners with the same address
+	udpPrefix = "udp:"
+)
+
+//nolint:gochecknoglobals // file descriptors are process wide
+var listeners = &listenerRegistry{}
+
+type listenerRegistry struct {
+	once             sync.Once
+	mu               sync.Mutex
+	inherited        map[string]net.Listener
+	active           map[string]net.Listener
+	inheritedPackets map[string]net.PacketConn
+	activePackets    map[string]net.PacketConn
+}
+
+// load takes the inherited listeners from the environment
+func (r *listenerRegistry) load() {
+	r.inherited = make(map[string]net.Listener)
+	r.active = make(map[string]net.Listener)
+	r.inheritedPackets = make(map[string]net.PacketConn)
+	r.activePackets = make(map[string]net.PacketConn)
+
+	defer func() {
+		// do not pass the listeners to child processes
+		_ = os.Unsetenv(envListenPid)
+		_ = os.Unsetenv(envListenFds)
+		_ = os.Unsetenv(envListenFdNames)
+	}()
+
+	if pid := os.Getenv(envListenPid); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+
+	n, err := strconv.Atoi(os.Getenv(envListenFds))
+	if err != nil || n <= 0 {
+		return
+	}
+
+	names := strings.Split(os.Getenv(envListenFdNames), ":")
+
+	for i := 0; i < n; i++ {
+		fd := listenFdsStart + i
+
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(fd), name)
+
+		l, err := net.FileListener(f)
+		if err != nil {
+			// udp sockets
+			conn, packetErr := net.FilePacketConn(f)
+			_ = f.Close()
+
+			if packetErr != nil {
+				logging.Warn("inherited file descriptor is not a listener", logging.F("fd", fd), logging.F("name", name), logging.F("error", err))
+				continue
+			}
+
+			logging.Info("inherited packet socket", logging.F("name", name), logging.F("fd", fd))
+
+			r.inheritedPackets[fdPrefix+strconv.Itoa(fd)] = conn
+			if _, ok := r.inheritedPackets[name]; !ok {
+				r.inheritedPackets[name] = conn
+			}
+
+			continue
+		}
+
+		_ = f.Close()
+
+		logging.Info("inherited listener", logging.F("name", name), logging.F("fd", fd))
+
+		r.inherited[fdPrefix+strconv.Itoa(fd)] = l
+		if _, ok := r.inherited[name]; !ok {
+			r.inherited[name] = l
+		}
+	}
+}
+
+// inheritedKey returns the key of an inherited socket, prefix separates the sockets of a parent process
+func inheritedKey(address, prefix string) string {
+	switch {
+	case strings.HasPrefix(address, systemdPrefix):
+		return strings.TrimPrefix(address, systemdPrefix)
+	case strings.HasPrefix(address, fdPrefix):
+		return address
+	default:
+		// sockets of a parent process are named by the escaped address
+		return url.QueryEscape(prefix + address)
+	}
+}
+
+// inheritedFd opens a file descriptor which was not passed via LISTEN_FDS, i.e. by another process manager
+func inheritedFd(address string) (*os.File, error) {
+	fd, err := strconv.Atoi(strings.TrimPrefix(address, fdPrefix))
+	if err != nil || fd < listenFdsStart {
+		return nil, fmt.Errorf("invalid file descriptor %q", address)
+	}
+
+	return os.NewFile(uintptr(fd), address), nil
+}
+
+// take returns an inherited listener, the listener can only be taken once
+func (r *listenerRegistry) take(address string) (net.Listener, bool, error) {
+	r.once.Do(r.load)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := inheritedKey(address, "")
+
+	l, ok := r.inherited[key]
+	if ok {
+		for k, v := range r.inherited {
+			if v == l {
+				delete(r.inherited, k)
+			}
+		}
+
+		return l, true, nil
+	}
+
+	switch {
+	case strings.HasPrefix(address, systemdPrefix):
+		return nil, false, fmt.Errorf("no inherited listener with name %q", key)
+	case strings.HasPrefix(address, fdPrefix):
+		f, err := inheritedFd(address)
+		if err != nil {
+			return nil, false, err
+		}
+
+		defer f.Close()
+
+		l, err := net.FileListener(f)
+		if err != nil {
+			return nil, false, fmt.Errorf("file descriptor %s is not a listener: %w", address, err)
+		}
+
+		return l, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// takePacket returns an inherited udp socket, the socket can only be taken once
+func (r *listenerRegistry) takePacket(address string) (net.PacketConn, bool, error) {
+	r.once.Do(r.load)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := inheritedKey(address, udpPrefix)
+
+	conn, ok := r.inheritedPackets[key]
+	if ok {
+		for k, v := range r.inheritedPackets {
+			if v == conn {
+				delete(r.inheritedPackets, k)
+			}
+		}
+
+		return conn, true, nil
+	}
+
+	switch {
+	case strings.HasPrefix(address, systemdPrefix):
+		return nil, false, fmt.Errorf("no inherited packet socket with name %q", key)
+	case strings.HasPrefix(address, fdPrefix):
+		f, err := inheritedFd(address)
+		if err != nil {
+			return nil, false, err
+		}
+
+		defer f.Close()
+
+		conn, err := net.FilePacketConn(f)
+		if err != nil {
+			return nil, false, fmt.Errorf("file descriptor %s is not a packet socket: %w", address, err)
+		}
+
+		return conn, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// track keeps the listener until it is closed, all tracked listeners are passed to a restarted process
+func (r *listenerRegistry) track(address string, l net.Listener) net.Listener {
+	r.once.Do(r.load)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.active[address] = l
+
+	return &trackedListener{
+		Listener: l,
+		close: func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			if r.active[address] == l {
+				delete(r.active, address)
+			}
+		},
+	}
+}
+
+// trackPacket keeps the udp socket until it is closed, all tracked sockets are passed to a restarted process
+func (r *listenerRegistry) trackPacket(address string, conn net.PacketConn) net.PacketConn {
+	r.once.Do(r.load)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.activePackets[udpPrefix+address] = conn
+
+	return &trackedPacketConn{
+		PacketConn: conn,
+		close: func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			if r.activePackets[udpPrefix+address] == conn {
+				delete(r.activePackets, udpPrefix+address)
+			}
+		},
+	}
+}
+
+type trackedPacketConn struct {
+	net.PacketConn
+	close func()
+}
+
+func (c *trackedPacketConn) Close() error {
+	c.close()
+
+	return c.PacketConn.Close()
+}
+
+type trackedListener struct {
+	net.Listener
+	close func()
+}
+
+func (l *trackedListener) Close() error {
+	l.close()
+
+	return l.Listener.Close()
+}
+
+type filer interface {
+	File() (*os.File, error)
+}
+
+// Reexec starts the running binary with the same arguments, all active listeners and udp sockets are passed to
+// the new process. The caller is responsible to stop the current process.
+func Reexec() (*os.Process, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	listeners.once.Do(listeners.load)
+
+	listeners.mu.Lock()
+	defer listeners.mu.Unlock()
+
+	sockets := make(map[string]interface{}, len(listeners.active)+len(listeners.activePackets))
+	for address, l := range listeners.active {
+		sockets[address] = l
+	}
+
+	for address, conn := range listeners.activePackets {
+		sockets[address] = conn
+	}
+
+	addresses := make([]string, 0, len(sockets))
+	for address := range sockets {
+		addresses = append(addresses, address)
+	}
+
+	sort.Strings(addresses)
+
+	var files []*os.File
+	var names []string
+
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+
+	for _, address := range addresses {
+		l := sockets[address]
+
+		fl, ok := l.(filer)
+		if !ok {
+			return nil, fmt.Errorf("listener %s can not be passed to a child process", address)
+		}
+
+		f, err := fl.File()
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %w", address, err)
+		}
+
+		// the socket file is used by the new process
+		if ul, ok := l.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+
+		files = append(files, f)
+		names = append(names, url.QueryEscape(address))
+	}
+
+	if len(files) == 0 {
+		return nil, errors.New("no active listeners")
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(),
+		envListenFds+"="+strconv.Itoa(len(files)),
+		envListenFdNames+"="+strings.Join(names, ":"),
+	)
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return cmd.Process, nil
+}
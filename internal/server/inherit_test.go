@@ -0,0 +1,90 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenFd(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+
+	f, err := l.(*net.TCPListener).File()
+	require.Nil(t, err)
+
+	inherited, err := Listen(fmt.Sprintf("fd:%d", f.Fd()), 0)
+	require.Nil(t, err)
+	defer inherited.Close()
+
+	assert.Equal(t, l.Addr().String(), inherited.Addr().String())
+
+	_, err = Listen("fd:1000", 0)
+	assert.NotNil(t, err)
+
+	_, err = Listen("systemd:unknown", 0)
+	assert.NotNil(t, err)
+}
+
+func TestTrackedListener(t *testing.T) {
+	l, err := Listen("127.0.0.1:0", 0)
+	require.Nil(t, err)
+
+	listeners.mu.Lock()
+	_, ok := listeners.active["127.0.0.1:0"]
+	listeners.mu.Unlock()
+	assert.True(t, ok)
+
+	require.Nil(t, l.Close())
+
+	listeners.mu.Lock()
+	_, ok = listeners.active["127.0.0.1:0"]
+	listeners.mu.Unlock()
+	assert.False(t, ok)
+}
+
+func TestListenPacketFd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer conn.Close()
+
+	f, err := conn.(*net.UDPConn).File()
+	require.Nil(t, err)
+
+	inherited, err := ListenPacket(fmt.Sprintf("fd:%d", f.Fd()))
+	require.Nil(t, err)
+	defer inherited.Close()
+
+	assert.Equal(t, conn.LocalAddr().String(), inherited.LocalAddr().String())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+
+	lf, err := l.(*net.TCPListener).File()
+	require.Nil(t, err)
+
+	_, err = ListenPacket(fmt.Sprintf("fd:%d", lf.Fd()))
+	assert.NotNil(t, err)
+}
+
+func TestTrackedPacketConn(t *testing.T) {
+	conn, err := ListenPacket("127.0.0.1:0")
+	require.Nil(t, err)
+
+	listeners.mu.Lock()
+	_, ok := listeners.activePackets["udp:127.0.0.1:0"]
+	listeners.mu.Unlock()
+	assert.True(t, ok)
+
+	require.Nil(t, conn.Close())
+
+	listeners.mu.Lock()
+	_, ok = listeners.activePackets["udp:127.0.0.1:0"]
+	listeners.mu.Unlock()
+	assert.False(t, ok)
+}
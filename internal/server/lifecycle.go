@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/marsom/serverbin/internal/logging"
+)
+
+// Service is a server managed by a Lifecycle
+type Service interface {
+	// Start binds the listener synchronously and serves in the background
+	Start() error
+	// Done receives an error if serving failed
+	Done() <-chan error
+	// Shutdown stops accepting new connections and waits until all active connections are finished
+	Shutdown(ctx context.Context) error
+}
+
+// Lifecycle starts services in the given order and stops them in the reverse order
+type Lifecycle struct {
+	// ShutdownDelay lets a load balancer remove traffic from this backend before the services are stopped
+	ShutdownDelay time.Duration
+	ReadinessOn   func()
+	ReadinessOff  func()
+}
+
+// Run starts all services and blocks until the context is done or a service failed. The readiness is switched
+// on if all services are started and switched off before the services are stopped.
+func (l *Lifecycle) Run(ctx context.Context, services ...Service) error {
+	started := make([]Service, 0, len(services))
+
+	for _, s := range services {
+		if err := s.Start(); err != nil {
+			_ = l.shutdown(started)
+
+			return err
+		}
+
+		started = append(started, s)
+	}
+
+	if l.ReadinessOn != nil {
+		l.ReadinessOn()
+	}
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	failed := make(chan error, len(started))
+	for _, s := range started {
+		go func(s Service) {
+			select {
+			case err := <-s.Done():
+				failed <- err
+			case <-stopped:
+			}
+		}(s)
+	}
+
+	var err error
+
+	// block
+	select {
+	case <-ctx.Done():
+		logging.Info("shutdown initialized", logging.F("delay", l.ShutdownDelay))
+	case err = <-failed:
+		logging.Error("shutdown initialized", logging.F("error", err))
+	}
+
+	if l.ReadinessOff != nil {
+		l.ReadinessOff()
+	}
+
+	if err == nil {
+		time.Sleep(l.ShutdownDelay)
+	}
+
+	if shutdownErr := l.shutdown(started); err == nil {
+		err = shutdownErr
+	}
+
+	return err
+}
+
+func (l *Lifecycle) shutdown(services []Service) error {
+	var err error
+
+	for i := len(services) - 1; i >= 0; i-- {
+		if shutdownErr := services[i].Shutdown(context.Background()); shutdownErr != nil {
+			logging.Error("shutdown failed", logging.F("error", shutdownErr))
+
+			if err == nil {
+				err = shutdownErr
+			}
+		}
+	}
+
+	return err
+}
+
+// waitDrained waits until done is closed and reports the active connections every second
+func waitDrained(ctx context.Context, name string, done <-chan struct{}, active func() int64) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			// a server without active connections only has to stop its serve loop, even if there is no time left
+			if active() == 0 {
+				<-done
+				return nil
+			}
+
+			return ctx.Err()
+		case <-ticker.C:
+			logging.Info("server draining", logging.F("server", name), logging.F("active-connections", active()))
+		}
+	}
+}
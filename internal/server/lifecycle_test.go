@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testService struct {
+	name   string
+	events *[]string
+	start  error
+	errc   chan error
+}
+
+func (s *testService) Start() error {
+	*s.events = append(*s.events, "start "+s.name)
+
+	return s.start
+}
+
+func (s *testService) Done() <-chan error {
+	return s.errc
+}
+
+func (s *testService) Shutdown(ctx context.Context) error {
+	*s.events = append(*s.events, "stop "+s.name)
+
+	return nil
+}
+
+func TestLifecycleOrder(t *testing.T) {
+	var events []string
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	lifecycle := Lifecycle{
+		ReadinessOn: func() {
+			events = append(events, "ready")
+			cancel()
+		},
+		ReadinessOff: func() {
+			events = append(events, "not ready")
+		},
+	}
+
+	err := lifecycle.Run(ctx,
+		&testService{name: "management", events: &events},
+		&testService{name: "http", events: &events},
+	)
+	require.Nil(t, err)
+
+	assert.Equal(t, []string{
+		"start management",
+		"start http",
+		"ready",
+		"not ready",
+		"stop http",
+		"stop management",
+	}, events)
+}
+
+func TestLifecycleStartFailed(t *testing.T) {
+	var events []string
+
+	lifecycle := Lifecycle{
+		ReadinessOn: func() {
+			events = append(events, "ready")
+		},
+	}
+
+	err := lifecycle.Run(context.Background(),
+		&testService{name: "management", events: &events},
+		&testService{name: "http", events: &events, start: errors.New("address in use")},
+	)
+	require.EqualError(t, err, "address in use")
+
+	assert.Equal(t, []string{
+		"start management",
+		"start http",
+		"stop management",
+	}, events)
+}
+
+func TestLifecycleServiceFailed(t *testing.T) {
+	var events []string
+
+	errc := make(chan error, 1)
+	errc <- errors.New("failed")
+
+	lifecycle := Lifecycle{
+		ShutdownDelay: time.Hour,
+	}
+
+	err := lifecycle.Run(context.Background(),
+		&testService{name: "management", events: &events},
+		&testService{name: "http", events: &events, errc: errc},
+	)
+	require.EqualError(t, err, "failed")
+
+	assert.Equal(t, []string{
+		"start management",
+		"start http",
+		"stop http",
+		"stop management",
+	}, events)
+}
+
+func TestHttpServerListenFailed(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+
+	srv := &HttpServer{Name: "http", Address: l.Addr().String(), Handler: http.NewServeMux()}
+	require.NotNil(t, srv.Start())
+}
+
+func TestHttpServerShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+
+	srv := &HttpServer{
+		Name:                    "http",
+		Address:                 "127.0.0.1:0",
+		GracefulShutdownTimeout: 10 * time.Millisecond,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-r.Context().Done()
+		}),
+	}
+	require.Nil(t, srv.Start())
+
+	go func() {
+		_, _ = http.Get("http://" + srv.Addr().String())
+	}()
+
+	<-started
+
+	err := srv.Shutdown(context.Background())
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "active connections=1")
+}
+
+func TestTcpServerShutdownWithoutTimeout(t *testing.T) {
+	srv := &TcpServer{
+		Name:    "tcp",
+		Address: "127.0.0.1:0",
+		RequestHandler: func(conn net.Conn) {
+			defer conn.Close()
+
+			_, _ = conn.Read(make([]byte, 1))
+		},
+	}
+	require.Nil(t, srv.Start())
+
+	conn, err := net.Dial("tcp", srv.listener.Addr().String())
+	require.Nil(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("x"))
+	require.Nil(t, err)
+
+	require.Eventually(t, func() bool { return srv.ActiveConnections() == 0 }, time.Second, time.Millisecond)
+
+	// no active connections
+	require.Nil(t, srv.Shutdown(context.Background()))
+
+	srv = &TcpServer{
+		Name:    "tcp",
+		Address: "127.0.0.1:0",
+		RequestHandler: func(conn net.Conn) {
+			_, _ = conn.Read(make([]byte, 1))
+		},
+	}
+	require.Nil(t, srv.Start())
+
+	conn, err = net.Dial("tcp", srv.listener.Addr().String())
+	require.Nil(t, err)
+	defer conn.Close()
+
+	require.Eventually(t, func() bool { return srv.ActiveConnections() == 1 }, time.Second, time.Millisecond)
+
+	// the active connection is closed immediately
+	err = srv.Shutdown(context.Background())
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "active connections=1")
+}
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/marsom/serverbin/internal/inspect"
+)
+
+// Overload modes if the max connections are reached
+const (
+	// OverloadStop stops accepting, new connections wait in the listen backlog
+	OverloadStop = "stop"
+	// OverloadQueue accepts the connections of the queue size, they wait for a free slot before they are served
+	OverloadQueue = "queue"
+	// OverloadReset accepts and closes the connections with a RST
+	OverloadReset = "reset"
+	// OverloadReject accepts the connections, responds with an error and closes them
+	OverloadReject = "reject"
+)
+
+// Limits of the client connections
+type Limits struct {
+	// MaxConnections is the number of concurrently served connections, 0 is unlimited
+	MaxConnections int
+	// Overload mode if the max connections are reached: stop (default), queue, reset or reject
+	Overload string
+	// QueueSize is the number of accepted connections waiting for a free slot in the queue mode
+	QueueSize int
+	// AcceptRate is the number of accepted connections per second, 0 is unlimited
+	AcceptRate float64
+	// Backlog of the listen socket, 0 uses the default of the os
+	Backlog int
+}
+
+func (l Limits) validate() error {
+	switch l.Overload {
+	case "", OverloadStop, OverloadQueue, OverloadReset, OverloadReject:
+	default:
+		return fmt.Errorf("unknown overload mode %q", l.Overload)
+	}
+
+	if l.MaxConnections < 0 || l.QueueSize < 0 || l.AcceptRate < 0 || l.Backlog < 0 {
+		return errors.New("connection limits must not be negative")
+	}
+
+	return nil
+}
+
+// limit the connections of the listener, reject is called for the overload connections of the reject mode
+func limit(l net.Listener, limits Limits, reject func(conn net.Conn)) (net.Listener, error) {
+	if err := limits.validate(); err != nil {
+		return nil, err
+	}
+
+	if limits.Backlog > 0 {
+		if err := listenBacklog(rawListener(l), limits.Backlog); err != nil {
+			return nil, fmt.Errorf("could not set listen backlog: %w", err)
+		}
+	}
+
+	if limits.MaxConnections == 0 && limits.AcceptRate == 0 {
+		return l, nil
+	}
+
+	ll := &limitListener{
+		Listener: l,
+		limits:   limits,
+		reject:   reject,
+		done:     make(chan struct{}),
+	}
+
+	if limits.MaxConnections > 0 {
+		queue := 0
+		if limits.Overload == OverloadQueue {
+			queue = limits.QueueSize
+		}
+
+		ll.admitted = make(chan struct{}, limits.MaxConnections+queue)
+		ll.slots = make(chan struct{}, limits.MaxConnections)
+	}
+
+	return ll, nil
+}
+
+// rawListener returns the listener of a tracked listener
+func rawListener(l net.Listener) net.Listener {
+	if t, ok := l.(*trackedListener); ok {
+		return t.Listener
+	}
+
+	return l
+}
+
+type limitListener struct {
+	net.Listener
+	limits Limits
+	reject func(conn net.Conn)
+
+	// admitted are the accepted connections including the queued ones, slots the served connections
+	admitted chan struct{}
+	slots    chan struct{}
+	next     time.Time
+	done     chan struct{}
+	once     sync.Once
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		if err := l.pace(); err != nil {
+			return nil, err
+		}
+
+		if l.admitted == nil {
+			return l.Listener.Accept()
+		}
+
+		blocking := l.limits.Overload != OverloadReset && l.limits.Overload != OverloadReject
+
+		if blocking {
+			select {
+			case l.admitted <- struct{}{}:
+			case <-l.done:
+				return nil, net.ErrClosed
+			}
+		}
+
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if blocking {
+				<-l.admitted
+			}
+
+			return nil, err
+		}
+
+		if !blocking {
+			select {
+			case l.admitted <- struct{}{}:
+			default:
+				go l.overload(conn)
+
+				continue
+			}
+		}
+
+		return &limitConn{Conn: conn, l: l, closed: make(chan struct{})}, nil
+	}
+}
+
+func (l *limitListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+
+	return l.Listener.Close()
+}
+
+// pace waits for the next accept of the accept rate
+func (l *limitListener) pace() error {
+	if l.limits.AcceptRate <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+
+	if wait := l.next.Sub(now); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-l.done:
+			return net.ErrClosed
+		}
+	}
+
+	l.next = l.next.Add(time.Duration(float64(time.Second) / l.limits.AcceptRate))
+
+	return nil
+}
+
+// overload closes a connection which exceeds the max connections
+func (l *limitListener) overload(conn net.Conn) {
+	if l.limits.Overload == OverloadReject && l.reject != nil {
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		l.reject(conn)
+	}
+
+	if c, ok := conn.(interface{ SetLinger(sec int) error }); ok && l.limits.Overload == OverloadReset {
+		_ = c.SetLinger(0)
+	}
+
+	_ = conn.Close()
+}
+
+// overloadBody is the json error of a rejected connection
+func overloadBody() []byte {
+	body, _ := json.Marshal(struct {
+		Schema string   `json:"schema"`
+		Errors []string `json:"errors"`
+	}{
+		Schema: inspect.Schema,
+		Errors: []string{"too many connections"},
+	})
+
+	return body
+}
+
+// limitConn holds a slot from the first read or write until it is closed
+type limitConn struct {
+	net.Conn
+	l        *limitListener
+	acquire  sync.Once
+	release  sync.Once
+	closed   chan struct{}
+	acquired bool
+}
+
+// wait for a free slot, queued connections wait until a served connection is closed
+func (c *limitConn) wait() error {
+	c.acquire.Do(func() {
+		select {
+		case c.l.slots <- struct{}{}:
+			c.acquired = true
+		case <-c.closed:
+		}
+	})
+
+	if !c.acquired {
+		return net.ErrClosed
+	}
+
+	return nil
+}
+
+func (c *limitConn) Read(b []byte) (int, error) {
+	if err := c.wait(); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Read(b)
+}
+
+func (c *limitConn) Write(b []byte) (int, error) {
+	if err := c.wait(); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Write(b)
+}
+
+func (c *limitConn) Close() error {
+	c.release.Do(func() {
+		close(c.closed)
+
+		// wait for a pending acquire
+		c.acquire.Do(func() {})
+
+		if c.acquired {
+			<-c.l.slots
+		}
+
+		<-c.l.admitted
+	})
+
+	return c.Conn.Close()
+}
+
+// NetConn returns the socket, i.e. for the peer credentials of a tls connection
+func (c *limitConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// unwrapConn returns the connection of a limited connection
+func unwrapConn(conn net.Conn) net.Conn {
+	if c, ok := conn.(*limitConn); ok {
+		return c.Conn
+	}
+
+	return conn
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startLimitedTcpServer responds with ok after the release of a connection
+func startLimitedTcpServer(t *testing.T, limits Limits, release chan struct{}) string {
+	srv := &TcpServer{
+		Name:    "tcp",
+		Address: "127.0.0.1:0",
+		Limits:  limits,
+		RequestHandler: func(conn net.Conn) {
+			defer conn.Close()
+
+			_, _ = conn.Read(make([]byte, 1))
+			<-release
+			_, _ = conn.Write([]byte("ok"))
+		},
+	}
+	require.Nil(t, srv.Start())
+
+	t.Cleanup(func() {
+		_ = srv.Shutdown(context.Background())
+	})
+
+	return srv.listener.Addr().String()
+}
+
+func dial(t *testing.T, address string) net.Conn {
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = conn.Write([]byte("x"))
+	require.NoError(t, err)
+
+	return conn
+}
+
+func TestLimitReject(t *testing.T) {
+	release := make(chan struct{})
+	address := startLimitedTcpServer(t, Limits{MaxConnections: 1, Overload: OverloadReject}, release)
+
+	first := dial(t, address)
+
+	data, err := io.ReadAll(dial(t, address))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"schema":"serverbin/v1","errors":["too many connections"]}`, string(data))
+
+	close(release)
+
+	data, err = io.ReadAll(first)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(data))
+}
+
+func TestLimitReset(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	address := startLimitedTcpServer(t, Limits{MaxConnections: 1, Overload: OverloadReset}, release)
+
+	dial(t, address)
+
+	_, err := io.ReadAll(dial(t, address))
+	assert.True(t, errors.Is(err, syscall.ECONNRESET), "connection reset expected: %v", err)
+}
+
+func TestLimitQueue(t *testing.T) {
+	release := make(chan struct{})
+	address := startLimitedTcpServer(t, Limits{MaxConnections: 1, Overload: OverloadQueue, QueueSize: 1}, release)
+
+	first := dial(t, address)
+	second := dial(t, address)
+
+	// the second connection waits for the first one
+	_ = second.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err := second.Read(make([]byte, 1))
+
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr) && netErr.Timeout(), "timeout expected: %v", err)
+
+	close(release)
+
+	data, err := io.ReadAll(first)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(data))
+
+	_ = second.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	data, err = io.ReadAll(second)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(data))
+}
+
+func TestLimitAcceptRate(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+
+	address := startLimitedTcpServer(t, Limits{AcceptRate: 20}, release)
+
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		data, err := io.ReadAll(dial(t, address))
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", string(data))
+	}
+
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(100*time.Millisecond))
+}
+
+func TestLimitHttpReject(t *testing.T) {
+	release := make(chan struct{})
+
+	srv := &HttpServer{
+		Name:    "http",
+		Address: "127.0.0.1:0",
+		Limits:  Limits{MaxConnections: 1, Overload: OverloadReject, Backlog: 16},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	}
+	require.Nil(t, srv.Start())
+
+	t.Cleanup(func() {
+		_ = srv.Shutdown(context.Background())
+	})
+
+	url := "http://" + srv.Addr().String()
+
+	done := make(chan int)
+
+	go func() {
+		resp, err := (&http.Client{Transport: &http.Transport{}}).Get(url)
+		if err != nil {
+			done <- 0
+			return
+		}
+
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+
+	// wait until the first request is served
+	require.Eventually(t, func() bool { return srv.ActiveConnections() == 1 }, time.Second, 10*time.Millisecond)
+
+	resp, err := (&http.Client{Transport: &http.Transport{}}).Get(url)
+	require.NoError(t, err)
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.JSONEq(t, `{"schema":"serverbin/v1","errors":["too many connections"]}`, string(body))
+
+	close(release)
+	assert.Equal(t, http.StatusNoContent, <-done)
+}
+
+func TestLimitValidate(t *testing.T) {
+	assert.EqualError(t, Limits{Overload: "drop"}.validate(), `unknown overload mode "drop"`)
+	assert.EqualError(t, Limits{MaxConnections: -1}.validate(), "connection limits must not be negative")
+	assert.NoError(t, Limits{}.validate())
+}
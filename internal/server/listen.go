@@ -0,0 +1,126 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const unixPrefix = "unix:"
+
+// ParseAddress returns the network and address of a listen address, unix:/path/to.sock and unix:@name are unix
+// domain sockets, everything else is tcp
+func ParseAddress(address string) (network, addr string) {
+	if strings.HasPrefix(address, unixPrefix) {
+		return "unix", strings.TrimPrefix(address, unixPrefix)
+	}
+
+	return "tcp", address
+}
+
+// IsUnixAddress checks if the address is a unix domain socket
+func IsUnixAddress(address string) bool {
+	network, _ := ParseAddress(address)
+
+	return network == "unix"
+}
+
+// Listen creates a tcp or unix domain socket listener. A stale socket file is removed before listening and
+// the socket file permissions are set if mode is not 0. Inherited listeners are used if available, systemd:name
+// and fd:3 select an inherited listener explicitly.
+func Listen(address string, mode os.FileMode) (net.Listener, error) {
+	l, ok, err := listeners.take(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		l, err = listen(address, mode)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return listeners.track(address, l), nil
+}
+
+// ListenPacket creates a udp socket, inherited sockets are used if available like with Listen
+func ListenPacket(address string) (net.PacketConn, error) {
+	conn, ok, err := listeners.takePacket(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		conn, err = net.ListenPacket("udp", address)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return listeners.trackPacket(address, conn), nil
+}
+
+func listen(address string, mode os.FileMode) (net.Listener, error) {
+	network, addr := ParseAddress(address)
+
+	if network != "unix" {
+		return net.Listen(network, addr)
+	}
+
+	if addr == "" {
+		return nil, errors.New("unix socket path is empty")
+	}
+
+	// abstract namespace sockets have no file
+	abstract := strings.HasPrefix(addr, "@")
+
+	if !abstract {
+		if err := removeStaleSocket(addr); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !abstract && mode != 0 {
+		if err := os.Chmod(addr, mode); err != nil {
+			_ = l.Close()
+
+			return nil, fmt.Errorf("could not change socket permissions: %w", err)
+		}
+	}
+
+	return l, nil
+}
+
+// removeStaleSocket removes a socket file if no one is listening on it
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, 100*time.Millisecond)
+	if err == nil {
+		_ = conn.Close()
+
+		return fmt.Errorf("%s is already in use", path)
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAddress(t *testing.T) {
+	network, addr := ParseAddress(":8080")
+	assert.Equal(t, "tcp", network)
+	assert.Equal(t, ":8080", addr)
+
+	network, addr = ParseAddress("unix:/tmp/serverbin.sock")
+	assert.Equal(t, "unix", network)
+	assert.Equal(t, "/tmp/serverbin.sock", addr)
+
+	network, addr = ParseAddress("unix:@serverbin")
+	assert.Equal(t, "unix", network)
+	assert.Equal(t, "@serverbin", addr)
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "serverbin.sock")
+
+	l, err := Listen("unix:"+path, 0600)
+	require.Nil(t, err)
+
+	info, err := os.Stat(path)
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// socket is in use
+	_, err = Listen("unix:"+path, 0600)
+	require.NotNil(t, err)
+
+	require.Nil(t, l.Close())
+
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestListenUnixStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "serverbin.sock")
+
+	l, err := net.Listen("unix", path)
+	require.Nil(t, err)
+
+	// keep the socket file
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.Nil(t, l.Close())
+
+	l, err = Listen("unix:"+path, 0)
+	require.Nil(t, err)
+	require.Nil(t, l.Close())
+}
@@ -2,79 +2,117 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
-	"log"
+	"io"
 	"net"
+	"os"
+	"runtime/debug"
 	"sync"
 	"time"
+
+	"github.com/marsom/serverbin/internal/logging"
 )
 
 type TcpServer struct {
 	Name                    string
 	Address                 string
-	ShutdownDelay           time.Duration
+	SocketMode              os.FileMode
 	GracefulShutdownTimeout time.Duration
-	ReadinessOn             func()
-	ReadinessOff            func()
 	RequestHandler          func(conn net.Conn)
+	TLSConfig               *tls.Config
+	Limits                  Limits
+
+	listener net.Listener
+	quit     chan interface{}
+	errc     chan error
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
 }
 
-func (s *TcpServer) ListenAndServe(ctx context.Context) error {
-	tcpServer := &tcpServer{
-		quit:           make(chan interface{}),
-		requestHandler: s.RequestHandler,
-	}
+var _ Service = (*TcpServer)(nil)
 
-	l, err := net.Listen("tcp", s.Address)
+func (s *TcpServer) Start() error {
+	l, err := Listen(s.Address, s.SocketMode)
 	if err != nil {
-		return err
+		return fmt.Errorf("%s server listen failed: %w", s.Name, err)
 	}
-	tcpServer.listener = l
-	tcpServer.wg.Add(1)
-	go tcpServer.serve()
 
-	log.Printf("%s server started on %s", s.Name, s.Address)
-	if s.ReadinessOn != nil {
-		s.ReadinessOn()
+	limited, err := limit(l, s.Limits, s.reject)
+	if err != nil {
+		_ = l.Close()
+
+		return fmt.Errorf("%s server: %w", s.Name, err)
 	}
 
-	// block
-	<-ctx.Done()
+	l = limited
 
-	log.Printf("%s server shutdown initalized (delay=%s)", s.Name, s.ShutdownDelay)
-	if s.ReadinessOff != nil {
-		s.ReadinessOff()
+	if s.TLSConfig != nil {
+		l = tls.NewListener(l, s.TLSConfig)
 	}
 
-	time.Sleep(s.ShutdownDelay)
+	s.listener = l
+	s.quit = make(chan interface{})
+	s.errc = make(chan error, 1)
+	s.conns = make(map[net.Conn]struct{})
 
-	// exit loop in tcpServer.serve()
-	close(tcpServer.quit)
-	err = tcpServer.listener.Close()
-	if err != nil {
+	s.wg.Add(1)
+	go s.serve()
+
+	logging.Info("server started", logging.F("server", s.Name), logging.F("address", s.Address))
+
+	return nil
+}
+
+func (s *TcpServer) Done() <-chan error {
+	return s.errc
+}
+
+func (s *TcpServer) Shutdown(ctx context.Context) error {
+	// without a timeout active connections are closed immediately
+	ctx, cancel := context.WithTimeout(ctx, s.GracefulShutdownTimeout)
+	defer cancel()
+
+	// exit loop in serve()
+	close(s.quit)
+	if err := s.listener.Close(); err != nil {
 		return fmt.Errorf("%s server stop failed: %w", s.Name, err)
 	}
 
-	time.AfterFunc(s.GracefulShutdownTimeout, func() {
-		log.Fatalf("%s server shutdown failed (timeout=%s)", s.Name, s.GracefulShutdownTimeout)
-	})
+	done := make(chan struct{})
+	go func() {
+		// wait for active connection to finish
+		s.wg.Wait()
+		close(done)
+	}()
+
+	if err := waitDrained(ctx, s.Name, done, s.ActiveConnections); err != nil {
+		active := s.ActiveConnections()
+
+		s.mu.Lock()
+		for conn := range s.conns {
+			_ = conn.Close()
+		}
+		s.mu.Unlock()
 
-	// wait for active connection to finish
-	tcpServer.wg.Wait()
+		return fmt.Errorf("%s server shutdown failed (timeout=%s, active connections=%d): %w", s.Name, s.GracefulShutdownTimeout, active, err)
+	}
 
-	log.Printf("%s server stopped", s.Name)
+	logging.Info("server stopped", logging.F("server", s.Name))
 
 	return nil
 }
 
-type tcpServer struct {
-	listener       net.Listener
-	quit           chan interface{}
-	wg             sync.WaitGroup
-	requestHandler func(conn net.Conn)
+// ActiveConnections returns the number of open connections
+func (s *TcpServer) ActiveConnections() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return int64(len(s.conns))
 }
 
-func (s *tcpServer) serve() {
+func (s *TcpServer) serve() {
 	defer s.wg.Done()
 
 	for {
@@ -84,14 +122,75 @@ func (s *tcpServer) serve() {
 			case <-s.quit:
 				return
 			default:
-				log.Println("accept error (default)", err)
 			}
-		} else {
-			s.wg.Add(1)
-			go func() {
-				s.requestHandler(conn)
-				s.wg.Done()
+
+			//nolint:staticcheck // Temporary is the only way to detect e.g. too many open files
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				logging.Warn("server accept failed", logging.F("server", s.Name), logging.F("error", err))
+				time.Sleep(10 * time.Millisecond)
+
+				continue
+			}
+
+			s.errc <- fmt.Errorf("%s server failed: %w", s.Name, err)
+
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
 			}()
+
+			defer recoverHandler(s.Name, conn)
+
+			// the request handler needs the socket of a plain connection
+			if c, ok := conn.(*limitConn); ok {
+				defer c.Close()
+
+				if err := c.wait(); err == nil {
+					s.RequestHandler(c.Conn)
+				}
+			} else {
+				s.RequestHandler(conn)
+			}
+		}()
+	}
+}
+
+// recoverHandler logs the panic of a connection or packet handler and closes the connection, the server continues
+func recoverHandler(name string, closer io.Closer) {
+	if v := recover(); v != nil {
+		logging.Error("handler panicked", logging.F("server", name), logging.F("panic", fmt.Sprint(v)), logging.F("stack", string(debug.Stack())))
+
+		if closer != nil {
+			_ = closer.Close()
 		}
 	}
 }
+
+// reject responds with an error to a connection which exceeds the max connections
+func (s *TcpServer) reject(conn net.Conn) {
+	if s.TLSConfig != nil {
+		conn = tls.Server(conn, s.TLSConfig)
+	}
+
+	if _, err := conn.Write(append(overloadBody(), '\n')); err != nil {
+		return
+	}
+
+	// a close with unread data resets the connection, wait for the client to close
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = c.CloseWrite()
+		_, _ = io.Copy(io.Discard, conn)
+	}
+}
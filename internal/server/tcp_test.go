@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTcpServerRecover(t *testing.T) {
+	srv := &TcpServer{
+		Name:    "tcp",
+		Address: "127.0.0.1:0",
+		RequestHandler: func(conn net.Conn) {
+			buffer := make([]byte, 1)
+			_, _ = conn.Read(buffer)
+
+			if buffer[0] == 'p' {
+				panic("parser failed")
+			}
+
+			_, _ = conn.Write([]byte("ok"))
+			_ = conn.Close()
+		},
+	}
+	require.Nil(t, srv.Start())
+
+	defer func() {
+		_ = srv.Shutdown(context.Background())
+	}()
+
+	for _, data := range []string{"p", "x"} {
+		conn, err := net.Dial("tcp", srv.listener.Addr().String())
+		require.Nil(t, err)
+
+		_, err = conn.Write([]byte(data))
+		require.Nil(t, err)
+
+		// the connection of the panicked handler is closed
+		response, err := io.ReadAll(conn)
+		require.Nil(t, err)
+
+		if data == "x" {
+			assert.Equal(t, "ok", string(response))
+		} else {
+			assert.Empty(t, response)
+		}
+
+		_ = conn.Close()
+	}
+}
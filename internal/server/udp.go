@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/marsom/serverbin/internal/logging"
+)
+
+type UdpServer struct {
+	Name                    string
+	Address                 string
+	MaxPacketSize           int
+	GracefulShutdownTimeout time.Duration
+	PacketHandler           func(conn net.PacketConn, addr net.Addr, data []byte)
+
+	conn   net.PacketConn
+	quit   chan interface{}
+	errc   chan error
+	wg     sync.WaitGroup
+	active int64
+}
+
+var _ Service = (*UdpServer)(nil)
+
+func (s *UdpServer) Start() error {
+	conn, err := ListenPacket(s.Address)
+	if err != nil {
+		return fmt.Errorf("%s server listen failed: %w", s.Name, err)
+	}
+
+	s.conn = conn
+	s.quit = make(chan interface{})
+	s.errc = make(chan error, 1)
+
+	if s.MaxPacketSize <= 0 {
+		// maximum udp payload size
+		s.MaxPacketSize = 65507
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	logging.Info("server started", logging.F("server", s.Name), logging.F("address", s.Address))
+
+	return nil
+}
+
+func (s *UdpServer) Done() <-chan error {
+	return s.errc
+}
+
+func (s *UdpServer) Shutdown(ctx context.Context) error {
+	// without a timeout active connections are closed immediately
+	ctx, cancel := context.WithTimeout(ctx, s.GracefulShutdownTimeout)
+	defer cancel()
+
+	// exit loop in serve()
+	close(s.quit)
+	if err := s.conn.Close(); err != nil {
+		return fmt.Errorf("%s server stop failed: %w", s.Name, err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		// wait for active packet handlers to finish
+		s.wg.Wait()
+		close(done)
+	}()
+
+	if err := waitDrained(ctx, s.Name, done, s.ActivePackets); err != nil {
+		return fmt.Errorf("%s server shutdown failed (timeout=%s, active packets=%d): %w", s.Name, s.GracefulShutdownTimeout, s.ActivePackets(), err)
+	}
+
+	logging.Info("server stopped", logging.F("server", s.Name))
+
+	return nil
+}
+
+// ActivePackets returns the number of packets in progress
+func (s *UdpServer) ActivePackets() int64 {
+	return atomic.LoadInt64(&s.active)
+}
+
+func (s *UdpServer) serve() {
+	defer s.wg.Done()
+
+	for {
+		buffer := make([]byte, s.MaxPacketSize)
+
+		n, addr, err := s.conn.ReadFrom(buffer)
+		if err != nil {
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
+
+			//nolint:staticcheck // Temporary is the only way to detect transient errors
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				logging.Warn("server read failed", logging.F("server", s.Name), logging.F("error", err))
+
+				continue
+			}
+
+			s.errc <- fmt.Errorf("%s server failed: %w", s.Name, err)
+
+			return
+		}
+
+		atomic.AddInt64(&s.active, 1)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer atomic.AddInt64(&s.active, -1)
+			defer recoverHandler(s.Name, nil)
+
+			s.PacketHandler(s.conn, addr, buffer[:n])
+		}()
+	}
+}
@@ -34,8 +34,6 @@ func rootHandler(next http.Handler) http.Handler {
 		}
 
 		// serve swagger ui
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-
 		next.ServeHTTP(w, r)
 	})
 }
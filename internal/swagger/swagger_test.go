@@ -35,6 +35,10 @@ func TestDefinitionHandler(t *testing.T) {
 			},
 			Slow:     nil,
 			Redirect: nil,
+			Proxy: &httphandler.Proxy{
+				AllowedHosts: []string{"localhost", "*.svc.cluster.local"},
+				MaxHops:      5,
+			},
 		},
 		Paths:             []string{"/"},
 		BaseUrl:           baseUrl,
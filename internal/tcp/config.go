@@ -1,12 +1,24 @@
 package tcp
 
-import "net"
+import (
+	"net"
+
+	"github.com/marsom/serverbin/internal/core"
+	"github.com/marsom/serverbin/internal/logging"
+	"github.com/marsom/serverbin/internal/metrics"
+)
 
 type Server struct {
+	Name             string
 	MaxBufferSize    int64
 	TrustedAddresses []*net.IPNet
+	Identity         *core.Identity
+	Metrics          *metrics.Metrics
+	AccessLog        *logging.AccessLog
+	Read             Read
 }
 
 type Config struct {
 	Server Server
+	Fault  *Fault
 }
@@ -0,0 +1,192 @@
+package tcp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fault actions of a tcp connection
+const (
+	// FaultNone responds normally
+	FaultNone = "none"
+	// FaultReset closes the connection with a RST (SO_LINGER 0) instead of a response
+	FaultReset = "reset"
+	// FaultClose closes the connection without a response
+	FaultClose = "close"
+	// FaultHalfClose closes the write side without a response and waits for the client to close
+	FaultHalfClose = "half-close"
+	// FaultNoRead accepts the connection but never reads and holds it for the read timeout
+	FaultNoRead = "no-read"
+)
+
+// FaultPrefix starts the in-band fault command line of a connection, i.e. "SERVERBIN action=reset delay=1s\n"
+const FaultPrefix = "SERVERBIN "
+
+var errNoReadTimeout = errors.New("no-read requires a read timeout")
+
+// Fault injects errors into tcp connections
+type Fault struct {
+	Action string
+	// Delay before the response or the action
+	Delay time.Duration
+	// Rate writes the response slowly with the number of bytes per second, 0 writes at once
+	Rate int
+	// DropRate is the fraction of connections which are closed right after accept
+	DropRate float64
+	// InBand enables the fault command of the connection prefix
+	InBand bool
+	// MaxDelay of an in-band command, 0 allows no in-band delay
+	MaxDelay time.Duration
+}
+
+// drop the connection by chance
+func (f *Fault) drop() bool {
+	//nolint:gosec // no security context
+	return f != nil && f.DropRate > 0 && rand.Float64() < f.DropRate
+}
+
+// action of the connection, the in-band fault takes precedence
+func (f *Fault) action() string {
+	if f == nil || f.Action == "" {
+		return FaultNone
+	}
+
+	return f.Action
+}
+
+// command parses and removes the in-band fault command line of the payload
+func (f *Fault) command(data []byte) (*Fault, []byte, error) {
+	if f == nil || !f.InBand || !bytes.HasPrefix(data, []byte(FaultPrefix)) {
+		return nil, data, nil
+	}
+
+	line, rest := data, []byte{}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		line, rest = data[:i], data[i+1:]
+	}
+
+	fault := &Fault{Action: FaultNone}
+
+	for _, field := range strings.Fields(strings.TrimPrefix(string(line), FaultPrefix)) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, rest, fmt.Errorf("fault: %q is not a key=value pair", field)
+		}
+
+		switch key, value := kv[0], kv[1]; key {
+		case "action":
+			switch value {
+			case FaultNone, FaultReset, FaultClose, FaultHalfClose, FaultNoRead:
+				fault.Action = value
+			default:
+				return nil, rest, fmt.Errorf("fault: action %q must be one of none, reset, close, half-close, no-read", value)
+			}
+		case "delay":
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return nil, rest, fmt.Errorf("fault: delay %q is invalid", value)
+			}
+
+			if d > f.MaxDelay {
+				return nil, rest, fmt.Errorf("fault: delay must not be greater than %s", f.MaxDelay)
+			}
+
+			fault.Delay = d
+		case "rate":
+			rate, err := strconv.Atoi(value)
+			if err != nil || rate < 0 {
+				return nil, rest, fmt.Errorf("fault: rate %q is invalid", value)
+			}
+
+			fault.Rate = rate
+		default:
+			return nil, rest, fmt.Errorf("fault: unknown key %q", key)
+		}
+	}
+
+	return fault, rest, nil
+}
+
+// hold the connection without reading until the timeout expires
+func hold(timeout time.Duration) error {
+	if timeout <= 0 {
+		return errNoReadTimeout
+	}
+
+	time.Sleep(timeout)
+
+	return nil
+}
+
+// reset closes the connection with a RST, connections without SO_LINGER like tls are closed normally
+func reset(conn net.Conn) error {
+	if c, ok := conn.(interface{ SetLinger(sec int) error }); ok {
+		if err := c.SetLinger(0); err != nil {
+			return err
+		}
+	}
+
+	return conn.Close()
+}
+
+// halfClose closes the write side of the connection and discards the data until the client closes the connection
+func halfClose(conn net.Conn, timeout time.Duration) error {
+	c, ok := conn.(interface{ CloseWrite() error })
+	if !ok {
+		return conn.Close()
+	}
+
+	if err := c.CloseWrite(); err != nil {
+		return err
+	}
+
+	if timeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	}
+
+	_, err := io.Copy(io.Discard, conn)
+
+	return err
+}
+
+// slowWrite writes the data in chunks of a tenth of the rate, the write timeout applies to the whole data
+func slowWrite(conn net.Conn, data []byte, rate int, timeout time.Duration) (int, error) {
+	if timeout > 0 {
+		_ = conn.SetWriteDeadline(time.Now().Add(timeout))
+	}
+
+	chunk := rate / 10
+	if chunk < 1 {
+		chunk = 1
+	}
+
+	interval := time.Duration(chunk) * time.Second / time.Duration(rate)
+	written := 0
+
+	for written < len(data) {
+		end := written + chunk
+		if end > len(data) {
+			end = len(data)
+		}
+
+		n, err := conn.Write(data[written:end])
+		written += n
+
+		if err != nil {
+			return written, err
+		}
+
+		if written < len(data) {
+			time.Sleep(interval)
+		}
+	}
+
+	return written, nil
+}
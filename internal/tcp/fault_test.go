@@ -0,0 +1,186 @@
+package tcp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultCommand(t *testing.T) {
+	fault := &Fault{InBand: true, MaxDelay: time.Minute}
+
+	tests := []struct {
+		name  string
+		data  string
+		fault *Fault
+		rest  string
+		err   string
+	}{
+		{
+			name: "no command",
+			data: "hello",
+			rest: "hello",
+		},
+		{
+			name:  "command",
+			data:  "SERVERBIN action=reset delay=1s rate=10\r\nhello",
+			fault: &Fault{Action: FaultReset, Delay: time.Second, Rate: 10},
+			rest:  "hello",
+		},
+		{
+			name:  "command without payload",
+			data:  "SERVERBIN rate=5",
+			fault: &Fault{Action: FaultNone, Rate: 5},
+			rest:  "",
+		},
+		{
+			name: "invalid action",
+			data: "SERVERBIN action=explode\nhello",
+			rest: "hello",
+			err:  `fault: action "explode" must be one of none, reset, close, half-close, no-read`,
+		},
+		{
+			name: "max delay",
+			data: "SERVERBIN delay=1h\n",
+			rest: "",
+			err:  "fault: delay must not be greater than 1m0s",
+		},
+		{
+			name: "unknown key",
+			data: "SERVERBIN foo=bar\n",
+			rest: "",
+			err:  `fault: unknown key "foo"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, rest, err := fault.command([]byte(tt.data))
+			assert.Equal(t, tt.fault, f)
+			assert.Equal(t, tt.rest, string(rest))
+
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+
+	f, rest, err := (&Fault{}).command([]byte("SERVERBIN action=reset\n"))
+	assert.Nil(t, f)
+	assert.Equal(t, "SERVERBIN action=reset\n", string(rest))
+	assert.NoError(t, err)
+
+	// a max delay of 0 allows no in-band delay
+	f, _, err = (&Fault{InBand: true}).command([]byte("SERVERBIN action=close delay=0s\n"))
+	assert.Equal(t, &Fault{Action: FaultClose}, f)
+	assert.NoError(t, err)
+
+	_, _, err = (&Fault{InBand: true}).command([]byte("SERVERBIN delay=1ms\n"))
+	assert.EqualError(t, err, "fault: delay must not be greater than 0s")
+}
+
+// serve the connections of a loopback listener with the request handler
+func serve(t *testing.T, config Config) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = l.Close() })
+
+	handler := NewRequestHandler(config)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go handler(conn)
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// roundTrip sends the payload and reads the response until the connection is closed
+func roundTrip(t *testing.T, address string, payload string) ([]byte, error) {
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = conn.Write([]byte(payload))
+	require.NoError(t, err)
+
+	return io.ReadAll(conn)
+}
+
+func TestFaultActions(t *testing.T) {
+	config := Config{
+		Server: Server{Name: "tcp", MaxBufferSize: 1024, Read: Read{Strategy: ReadSingle, Timeout: time.Second}},
+		Fault:  &Fault{InBand: true, MaxDelay: time.Minute},
+	}
+
+	address := serve(t, config)
+
+	data, err := roundTrip(t, address, "hello")
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"text": "hello"`)
+
+	data, err = roundTrip(t, address, "SERVERBIN action=close\nhello")
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+
+	data, err = roundTrip(t, address, "SERVERBIN action=half-close\nhello")
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+
+	_, err = roundTrip(t, address, "SERVERBIN action=reset\nhello")
+	assert.True(t, errors.Is(err, syscall.ECONNRESET), "connection reset expected: %v", err)
+
+	start := time.Now()
+	data, err = roundTrip(t, address, "SERVERBIN delay=100ms rate=2000\nhello")
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"text": "hello"`)
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(100*time.Millisecond+time.Duration(len(data)-200)*time.Second/2000))
+}
+
+func TestFaultDrop(t *testing.T) {
+	address := serve(t, Config{
+		Server: Server{Name: "tcp", MaxBufferSize: 1024, Read: Read{Strategy: ReadSingle, Timeout: time.Second}},
+		Fault:  &Fault{DropRate: 1},
+	})
+
+	data, _ := roundTrip(t, address, "hello")
+	assert.Empty(t, data)
+}
+
+func TestSlowWriteTimeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go func() {
+		_, _ = io.Copy(io.Discard, client)
+	}()
+
+	// 100 bytes at 10 bytes per second take 10s, the write timeout ends the whole write
+	start := time.Now()
+	n, err := slowWrite(server, make([]byte, 100), 10, 200*time.Millisecond)
+
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr))
+	assert.True(t, netErr.Timeout())
+	assert.Less(t, n, 100)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+}
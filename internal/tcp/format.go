@@ -5,6 +5,9 @@ import (
 	"log"
 	"net"
 	"strings"
+	"time"
+
+	"github.com/marsom/serverbin/internal/logging"
 )
 
 func NewRequestHandler(config Config) func(conn net.Conn) {
@@ -17,18 +20,146 @@ func NewRequestHandler(config Config) func(conn net.Conn) {
 			}
 		}(conn)
 
-		if resp := newResponse(config, conn); resp != nil {
-			jsonWriter := json.NewEncoder(conn)
-			jsonWriter.SetIndent("", " ")
+		defer config.Server.Metrics.ConnectionOpened(config.Server.Name)()
+
+		start := time.Now()
+
+		// faults before the payload is read
+		switch {
+		case config.Fault.drop():
+			config.Server.AccessLog.Log(faultEntry(config.Server.Name, conn, start, "fault: drop"))
+			return
+		case config.Fault.action() == FaultNoRead:
+			msg := "fault: " + FaultNoRead
+			if err := hold(config.Server.Read.Timeout); err != nil {
+				msg = err.Error()
+			}
+
+			config.Server.AccessLog.Log(faultEntry(config.Server.Name, conn, start, msg))
+
+			return
+		}
+
+		resp, read := newResponse(config, conn, start)
+
+		fault := config.Fault
+		if resp.fault != nil {
+			fault = resp.fault
+		}
+
+		entry := resp.accessEntry(config.Server.Name, "TCP", start)
+		entry.BytesRead = int64(read)
+
+		defer func() {
+			entry.Duration = time.Since(start)
+			config.Server.AccessLog.Log(entry)
+		}()
+
+		if fault != nil && fault.Delay > 0 {
+			time.Sleep(fault.Delay)
+		}
+
+		if action := fault.action(); action != FaultNone {
+			var err error
+
+			switch action {
+			case FaultNoRead:
+				err = hold(config.Server.Read.Timeout)
+			case FaultReset:
+				err = reset(conn)
+			case FaultHalfClose:
+				err = halfClose(conn, config.Server.Read.Timeout)
+			}
+
+			if entry.Error == "" {
+				entry.Error = "fault: " + action
+			}
 
-			err := jsonWriter.Encode(resp)
 			if err != nil {
-				log.Printf("could not write to resonse body: %s", err)
+				entry.Error = err.Error()
+			}
+
+			return
+		}
+
+		body, err := json.MarshalIndent(resp, "", " ")
+		if err != nil {
+			log.Printf("could not marshal response: %s", err)
+			return
+		}
+
+		var n int
+
+		if fault != nil && fault.Rate > 0 {
+			n, err = slowWrite(conn, append(body, '\n'), fault.Rate, config.Server.Read.WriteTimeout)
+		} else {
+			if config.Server.Read.WriteTimeout > 0 {
+				_ = conn.SetWriteDeadline(time.Now().Add(config.Server.Read.WriteTimeout))
 			}
 
+			n, err = conn.Write(append(body, '\n'))
+		}
+
+		config.Server.Metrics.BytesWritten(config.Server.Name, "tcp", n)
+
+		if err != nil {
+			log.Printf("could not write to response body: %s", err)
+		}
+
+		entry.BytesWritten = int64(n)
+	}
+}
+
+// faultEntry of a connection which was not read
+func faultEntry(server string, conn net.Conn, start time.Time, msg string) logging.AccessEntry {
+	e := logging.AccessEntry{
+		Time:      start,
+		Server:    server,
+		RequestID: logging.NewRequestID(),
+		Protocol:  "TCP",
+		Duration:  time.Since(start),
+		Error:     msg,
+	}
+
+	if remoteAddr, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		e.RemoteIP = remoteAddr
+		e.ClientIP = remoteAddr
+	}
+
+	return e
+}
+
+func NewPacketHandler(config Config) func(conn net.PacketConn, addr net.Addr, data []byte) {
+	return func(conn net.PacketConn, addr net.Addr, data []byte) {
+		start := time.Now()
+
+		config.Server.Metrics.PacketReceived(config.Server.Name)
+		config.Server.Metrics.BytesRead(config.Server.Name, "udp", len(data))
+
+		truncated := len(data) > int(config.Server.MaxBufferSize)
+		if truncated {
+			data = data[:config.Server.MaxBufferSize]
+		}
+
+		resp := newDataResponse(config, addr, data, truncated)
+
+		body, err := json.MarshalIndent(resp, "", " ")
+		if err != nil {
+			log.Printf("could not marshal response: %s", err)
 			return
 		}
 
-		log.Printf("resp was nil")
+		n, err := conn.WriteTo(append(body, '\n'), addr)
+		config.Server.Metrics.BytesWritten(config.Server.Name, "udp", n)
+
+		if err != nil {
+			log.Printf("could not write udp response: %s", err)
+		}
+
+		entry := resp.accessEntry(config.Server.Name, "UDP", start)
+		entry.BytesRead = int64(len(data))
+		entry.BytesWritten = int64(n)
+		entry.Duration = time.Since(start)
+		config.Server.AccessLog.Log(entry)
 	}
 }
@@ -0,0 +1,195 @@
+package tcp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// Read strategies of a tcp connection
+const (
+	// ReadSingle reads once
+	ReadSingle = "single"
+	// ReadIdle reads until the connection is idle for the idle timeout
+	ReadIdle = "idle"
+	// ReadDelimiter reads until the delimiter is received
+	ReadDelimiter = "delimiter"
+	// ReadLength reads a frame with a big endian length prefix
+	ReadLength = "length"
+	// ReadHalfClose reads until the client closes the write side of the connection
+	ReadHalfClose = "half-close"
+)
+
+// proxyHeaderMaxLength is the maximal size of a PROXY v1 header
+const proxyHeaderMaxLength = 107
+
+var (
+	errReadTimeout = errors.New("read timeout")
+	errIdleTimeout = errors.New("idle timeout")
+)
+
+// Read configures how the payload of a connection is read
+type Read struct {
+	Strategy string
+	// Timeout to read the payload
+	Timeout time.Duration
+	// WriteTimeout to write the response, a slow write included
+	WriteTimeout time.Duration
+	// IdleTimeout between two reads, not used by the single read strategy
+	IdleTimeout time.Duration
+	Delimiter   []byte
+	// LengthBytes is the size of the length prefix: 1, 2 or 4 bytes
+	LengthBytes int
+}
+
+// payload reads at most max bytes, truncated is true if the client sent more. A PROXY header is kept and the length
+// prefix is removed.
+func (r Read) payload(conn net.Conn, max int, start time.Time) (data []byte, truncated bool, err error) {
+	data, truncated, err = r.read(conn, max, start)
+
+	return r.frame(data), truncated, err
+}
+
+func (r Read) read(conn net.Conn, max int, start time.Time) (data []byte, truncated bool, err error) {
+	buffer := make([]byte, max+1)
+	n := 0
+
+	for {
+		idle := r.setReadDeadline(conn, start, n > 0)
+
+		m, err := conn.Read(buffer[n:])
+		n += m
+
+		if n > max {
+			return buffer[:max], true, nil
+		}
+
+		if end, ok := r.complete(buffer[:n], m); ok {
+			return buffer[:end], false, nil
+		}
+
+		if err == nil {
+			continue
+		}
+
+		var netErr net.Error
+
+		switch {
+		case err == io.EOF:
+			return buffer[:n], false, nil
+		case errors.As(err, &netErr) && netErr.Timeout() && idle:
+			// the idle timeout is the regular end of the idle strategy
+			if r.Strategy == ReadIdle {
+				return buffer[:n], false, nil
+			}
+
+			return buffer[:n], false, errIdleTimeout
+		case errors.As(err, &netErr) && netErr.Timeout():
+			return buffer[:n], false, errReadTimeout
+		default:
+			return buffer[:n], false, err
+		}
+	}
+}
+
+// setReadDeadline sets the earlier of the connection and the idle deadline, idle is true for the idle deadline. The
+// idle timeout starts with the first received byte.
+func (r Read) setReadDeadline(conn net.Conn, start time.Time, received bool) bool {
+	var deadline time.Time
+
+	if r.Timeout > 0 {
+		deadline = start.Add(r.Timeout)
+	}
+
+	idle := false
+
+	if r.IdleTimeout > 0 && received && !r.single() {
+		if d := time.Now().Add(r.IdleTimeout); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+			idle = true
+		}
+	}
+
+	_ = conn.SetReadDeadline(deadline)
+
+	return idle
+}
+
+// complete returns the end of the payload if the strategy received all data, m is the size of the last read. The
+// delimiter and length strategies start after a PROXY header.
+func (r Read) complete(data []byte, m int) (int, bool) {
+	if r.single() {
+		return len(data), m > 0
+	}
+
+	header, ok := proxyHeader(data)
+	if !ok {
+		return 0, false
+	}
+
+	body := data[header:]
+
+	switch r.Strategy {
+	case ReadDelimiter:
+		if i := bytes.Index(body, r.Delimiter); i >= 0 && len(r.Delimiter) > 0 {
+			return header + i + len(r.Delimiter), true
+		}
+	case ReadLength:
+		if len(body) < r.LengthBytes {
+			return 0, false
+		}
+
+		if end := r.LengthBytes + r.length(body); len(body) >= end {
+			return header + end, true
+		}
+	}
+
+	return 0, false
+}
+
+// frame removes the length prefix of the length strategy
+func (r Read) frame(data []byte) []byte {
+	header, _ := proxyHeader(data)
+	if r.Strategy != ReadLength || len(data)-header < r.LengthBytes {
+		return data
+	}
+
+	return append(data[:header:header], data[header+r.LengthBytes:]...)
+}
+
+// length of the big endian length prefix
+func (r Read) length(data []byte) int {
+	length := 0
+	for _, b := range data[:r.LengthBytes] {
+		length = length<<8 | int(b)
+	}
+
+	return length
+}
+
+// proxyHeader returns the size of a PROXY v1 header at the start of the data, false if the header is incomplete
+func proxyHeader(data []byte) (int, bool) {
+	signature := []byte("PROXY ")
+
+	if len(data) < len(signature) {
+		return 0, !bytes.HasPrefix(signature, data)
+	}
+
+	if !bytes.HasPrefix(data, signature) {
+		return 0, true
+	}
+
+	// the header has at most 107 bytes
+	if i := bytes.IndexByte(data, '\n'); i >= 0 && i < proxyHeaderMaxLength {
+		return i + 1, true
+	}
+
+	return 0, len(data) >= proxyHeaderMaxLength
+}
+
+// single is the default strategy
+func (r Read) single() bool {
+	return r.Strategy == ReadSingle || r.Strategy == ""
+}
@@ -0,0 +1,135 @@
+package tcp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// send writes the chunks with a pause and closes the connection if close is set
+func send(conn net.Conn, pause time.Duration, close bool, chunks ...string) {
+	go func() {
+		for _, chunk := range chunks {
+			time.Sleep(pause)
+
+			_, _ = conn.Write([]byte(chunk))
+		}
+
+		if close {
+			_ = conn.Close()
+		}
+	}()
+}
+
+func TestReadPayload(t *testing.T) {
+	tests := []struct {
+		name      string
+		read      Read
+		max       int
+		chunks    []string
+		close     bool
+		data      string
+		truncated bool
+		err       error
+	}{
+		{
+			name:   "single",
+			read:   Read{Strategy: ReadSingle},
+			max:    16,
+			chunks: []string{"hello", "world"},
+			data:   "hello",
+		},
+		{
+			name:      "single truncated",
+			read:      Read{Strategy: ReadSingle},
+			max:       4,
+			chunks:    []string{"hello"},
+			data:      "hell",
+			truncated: true,
+		},
+		{
+			name:   "idle",
+			read:   Read{Strategy: ReadIdle, IdleTimeout: 100 * time.Millisecond},
+			max:    16,
+			chunks: []string{"hel", "lo"},
+			data:   "hello",
+		},
+		{
+			name:   "delimiter",
+			read:   Read{Strategy: ReadDelimiter, IdleTimeout: time.Second, Delimiter: []byte("\r\n")},
+			max:    16,
+			chunks: []string{"a\r", "\nb\r\n"},
+			data:   "a\r\n",
+		},
+		{
+			name:   "delimiter idle timeout",
+			read:   Read{Strategy: ReadDelimiter, IdleTimeout: 50 * time.Millisecond, Delimiter: []byte("\n")},
+			max:    16,
+			chunks: []string{"abc"},
+			data:   "abc",
+			err:    errIdleTimeout,
+		},
+		{
+			name:   "length",
+			read:   Read{Strategy: ReadLength, IdleTimeout: time.Second, LengthBytes: 2},
+			max:    16,
+			chunks: []string{"\x00", "\x03ab", "cdef"},
+			data:   "abc",
+		},
+		{
+			name:   "delimiter after proxy header",
+			read:   Read{Strategy: ReadDelimiter, IdleTimeout: time.Second, Delimiter: []byte("\n")},
+			max:    64,
+			chunks: []string{"PROXY TCP4 1.2.3.4 5.6.7.8 1 2\r", "\nab", "c\nd"},
+			data:   "PROXY TCP4 1.2.3.4 5.6.7.8 1 2\r\nabc\n",
+		},
+		{
+			name:   "length after proxy header",
+			read:   Read{Strategy: ReadLength, IdleTimeout: time.Second, LengthBytes: 1},
+			max:    64,
+			chunks: []string{"PROXY UNKNOWN\r\n\x03", "abcd"},
+			data:   "PROXY UNKNOWN\r\nabc",
+		},
+		{
+			name:      "length truncated",
+			read:      Read{Strategy: ReadLength, IdleTimeout: time.Second, LengthBytes: 1},
+			max:       4,
+			chunks:    []string{"\x05abcde"},
+			data:      "abc",
+			truncated: true,
+		},
+		{
+			name:   "half-close",
+			read:   Read{Strategy: ReadHalfClose, IdleTimeout: time.Second},
+			max:    16,
+			chunks: []string{"a", "b", "c"},
+			close:  true,
+			data:   "abc",
+		},
+		{
+			name:   "read timeout",
+			read:   Read{Strategy: ReadHalfClose, Timeout: 50 * time.Millisecond},
+			max:    16,
+			chunks: []string{},
+			data:   "",
+			err:    errReadTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			send(client, 10*time.Millisecond, tt.close, tt.chunks...)
+
+			data, truncated, err := tt.read.payload(server, tt.max, time.Now())
+			assert.Equal(t, tt.data, string(data))
+			assert.Equal(t, tt.truncated, truncated)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+}
@@ -1,84 +1,74 @@
 package tcp
 
 import (
-	"bufio"
 	"bytes"
-	"encoding/base64"
-	"encoding/json"
 	"io"
 	"net"
-	"net/http"
+	"time"
 
+	"github.com/marsom/serverbin/internal/core"
+	"github.com/marsom/serverbin/internal/inspect"
+	"github.com/marsom/serverbin/internal/logging"
 	"github.com/marsom/serverbin/internal/proxyprotocol"
 )
 
-type origin struct {
-	ClientIP      string         `json:"client-ip,omitempty"`
-	RemoteIP      string         `json:"remote-ip,omitempty"`
-	ProxyProtocol *proxyProtocol `json:"proxy-protocol,omitempty"`
-}
-
-type httpPayload struct {
-	Method string      `json:"method,omitempty"`
-	URL    string      `json:"url,omitempty"`
-	Header http.Header `json:"headers,omitempty"`
-}
-
-type payload struct {
-	Base64 string       `json:"base64,omitempty"`
-	Json   interface{}  `json:"json,omitempty"`
-	Http   *httpPayload `json:"http,omitempty"`
-}
-
 type response struct {
-	Errors  []string `json:"errors,omitempty"`
-	Payload *payload `json:"payload,omitempty"`
-	Origin  origin   `json:"origin,omitempty"`
-}
-
-type proxyProtocol struct {
-	Version     string `json:"version,omitempty"`
-	Protocol    string `json:"protocol,omitempty"`
-	Source      string `json:"source,omitempty"`
-	Destination string `json:"destination,omitempty"`
+	Schema    string           `json:"schema"`
+	RequestID string           `json:"request-id"`
+	Errors    []string         `json:"errors,omitempty"`
+	Payload   *inspect.Payload `json:"payload,omitempty"`
+	Origin    inspect.Origin   `json:"origin,omitempty"`
+	Server    *core.Identity   `json:"server,omitempty"`
+
+	// fault of the in-band command
+	fault *Fault
 }
 
-func newProxyProtocol(protocol proxyprotocol.ProxyProtocol) *proxyProtocol {
-	src := ""
-	dst := ""
-
-	if v := protocol.Source(); v != nil {
-		src = v.String()
+// accessEntry of a connection or packet
+func (r *response) accessEntry(server string, protocol string, start time.Time) logging.AccessEntry {
+	e := logging.AccessEntry{
+		Time:      start,
+		Server:    server,
+		RequestID: r.RequestID,
+		ClientIP:  r.Origin.ClientIP,
+		RemoteIP:  r.Origin.RemoteIP,
+		Protocol:  protocol,
 	}
 
-	if v := protocol.Destination(); v != nil {
-		dst = v.String()
+	if p := r.Origin.ProxyProtocol; p != nil {
+		e.ProxyProtocol = &logging.ProxyProtocol{
+			Version:     p.Version,
+			Source:      p.Source,
+			Destination: p.Destination,
+		}
 	}
 
-	return &proxyProtocol{
-		Version:     protocol.Version(),
-		Protocol:    protocol.Protocol(),
-		Source:      src,
-		Destination: dst,
+	if len(r.Errors) > 0 {
+		e.Error = r.Errors[0]
 	}
+
+	return e
 }
 
-func newOrigin(config Server, conn net.Conn, r proxyprotocol.Reader) origin {
-	data := origin{}
+func newOrigin(config Server, remote net.Addr, r proxyprotocol.Reader) inspect.Origin {
+	data := inspect.Origin{}
 
-	if remoteAddr, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil && remoteAddr != "" {
+	if remoteAddr, _, err := net.SplitHostPort(remote.String()); err == nil && remoteAddr != "" {
 		data.RemoteIP = remoteAddr
 		data.ClientIP = remoteAddr
 	}
 
 	if protocol, ok := r.ProxyProtocol(); ok {
-		data.ProxyProtocol = newProxyProtocol(protocol)
+		data.ProxyProtocol = inspect.NewProxyProtocol(protocol)
 
 		// update client ip if we trust the remote ip
-		if remoteIP := net.ParseIP(data.RemoteIP); remoteIP != nil {
+		if remoteIP := net.ParseIP(data.RemoteIP); remoteIP != nil && protocol.Source() != nil {
 			for _, network := range config.TrustedAddresses {
 				if network.Contains(remoteIP) {
-					data.ClientIP = data.RemoteIP
+					if sourceIP, _, err := net.SplitHostPort(protocol.Source().String()); err == nil {
+						data.ClientIP = sourceIP
+					}
+
 					break
 				}
 			}
@@ -88,67 +78,56 @@ func newOrigin(config Server, conn net.Conn, r proxyprotocol.Reader) origin {
 	return data
 }
 
-func newPayload(data []byte) *payload {
-	if len(data) > 0 {
-		p := &payload{
-			Base64: base64.StdEncoding.EncodeToString(data),
-		}
-
-		var jsonData interface{}
-
-		if err := json.Unmarshal(data, &jsonData); err == nil {
-			p.Json = jsonData
-		}
-
-		// HTTP/1.x
-		if r, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data))); err == nil {
+func newResponse(config Config, conn net.Conn, start time.Time, errs ...error) (*response, int) {
+	data, truncated, err := config.Server.Read.payload(conn, int(config.Server.MaxBufferSize), start)
+	config.Server.Metrics.BytesRead(config.Server.Name, "tcp", len(data))
 
-			p.Http = &httpPayload{
-				Method: r.Method,
-				Header: r.Header,
-			}
+	if err != nil {
+		errs = append([]error{err}, errs...)
+	}
 
-			if r.URL != nil {
-				p.Http.URL = r.URL.String()
-			}
-		}
+	resp := newDataResponse(config, conn.RemoteAddr(), data, truncated, errs...)
 
-		return p
+	// unix domain sockets
+	if cred, err := core.GetPeerCredentials(conn); err == nil {
+		resp.Origin.PeerCredentials = cred
 	}
 
-	return nil
+	return resp, len(data)
 }
 
-func newResponse(config Config, conn net.Conn, errs ...error) *response {
-	resp := response{}
+func newDataResponse(config Config, remote net.Addr, data []byte, truncated bool, errs ...error) *response {
+	resp := response{
+		Schema:    inspect.Schema,
+		RequestID: logging.NewRequestID(),
+		Errors:    inspect.Errors(errs...),
+		Server:    config.Server.Identity,
+	}
 
-	// Read the incoming connection into the buffer.
-	buffer := make([]byte, config.Server.MaxBufferSize)
+	r := proxyprotocol.NewReader(bytes.NewReader(data), true, false)
 
-	n, err := conn.Read(buffer)
-	if err != nil && err != io.EOF {
+	body, err := io.ReadAll(r)
+	if err != nil {
 		resp.Errors = append(resp.Errors, err.Error())
 	}
 
-	// errors
-	if len(errs) > 0 {
-		for _, err := range errs {
-			if err != nil {
-				resp.Errors = append(resp.Errors, err.Error())
-			}
-		}
+	if protocol, ok := r.ProxyProtocol(); ok {
+		config.Server.Metrics.ProxyProtocol(protocol.Version(), r.Error())
 	}
 
-	r := proxyprotocol.NewReader(bytes.NewReader(buffer[:n]), true, false)
-
-	body, err := io.ReadAll(r)
+	fault, body, err := config.Fault.command(body)
 	if err != nil {
 		resp.Errors = append(resp.Errors, err.Error())
 	}
 
+	resp.fault = fault
+
 	// payload
-	resp.Payload = newPayload(body)
-	resp.Origin = newOrigin(config.Server, conn, r)
+	resp.Payload = inspect.Inspect(body, "")
+	if resp.Payload != nil {
+		resp.Payload.Truncated = truncated
+	}
+	resp.Origin = newOrigin(config.Server, remote, r)
 
 	return &resp
 }
@@ -0,0 +1,492 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Trace context headers
+const (
+	TraceparentHeader   = "Traceparent"
+	TracestateHeader    = "Tracestate"
+	TraceresponseHeader = "Traceresponse"
+	B3Header            = "B3"
+	B3TraceIDHeader     = "X-B3-Traceid"
+	B3SpanIDHeader      = "X-B3-Spanid"
+	B3ParentSpanID      = "X-B3-Parentspanid"
+	B3SampledHeader     = "X-B3-Sampled"
+	B3FlagsHeader       = "X-B3-Flags"
+)
+
+// Propagation formats
+const (
+	PropagationW3C     = "w3c"
+	PropagationB3      = "b3"
+	PropagationB3Multi = "b3-multi"
+)
+
+// maxTracestateMembers is the maximal number of list members of the tracestate header
+const maxTracestateMembers = 32
+
+// TraceID of a trace
+type TraceID [16]byte
+
+// SpanID of a span
+type SpanID [8]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// NewTraceID returns a random trace id
+func NewTraceID() TraceID {
+	var id TraceID
+	_, _ = rand.Read(id[:])
+
+	return id
+}
+
+// NewSpanID returns a random span id
+func NewSpanID() SpanID {
+	var id SpanID
+	_, _ = rand.Read(id[:])
+
+	return id
+}
+
+// SpanContext identifies a span across process boundaries
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string
+}
+
+// IsValid returns true if the trace id and the span id are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent returns the w3c traceparent header value
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpan returns a context with the span context, it is propagated by Inject
+func ContextWithSpan(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanFromContext returns the span context of a context
+func SpanFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+
+	return sc, ok && sc.IsValid()
+}
+
+// Inject writes the headers of the span context in the context to h
+func Inject(ctx context.Context, h http.Header, propagation string) {
+	sc, ok := SpanFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	sampled := "0"
+	if sc.Sampled {
+		sampled = "1"
+	}
+
+	switch propagation {
+	case PropagationB3:
+		h.Set(B3Header, sc.TraceID.String()+"-"+sc.SpanID.String()+"-"+sampled)
+	case PropagationB3Multi:
+		h.Set(B3TraceIDHeader, sc.TraceID.String())
+		h.Set(B3SpanIDHeader, sc.SpanID.String())
+		h.Set(B3SampledHeader, sampled)
+	default:
+		h.Set(TraceparentHeader, sc.Traceparent())
+
+		if sc.TraceState != "" {
+			h.Set(TracestateHeader, sc.TraceState)
+		}
+	}
+}
+
+// Trace is the parsed trace context of a request
+type Trace struct {
+	W3C  *W3C  `json:"w3c,omitempty"`
+	B3   *B3   `json:"b3,omitempty"`
+	Span *Span `json:"span,omitempty"`
+}
+
+// W3C trace context
+type W3C struct {
+	Traceparent string   `json:"traceparent"`
+	Version     string   `json:"version,omitempty"`
+	TraceID     string   `json:"trace-id,omitempty"`
+	ParentID    string   `json:"parent-id,omitempty"`
+	Flags       string   `json:"flags,omitempty"`
+	Sampled     bool     `json:"sampled"`
+	Tracestate  []string `json:"tracestate,omitempty"`
+	Valid       bool     `json:"valid"`
+	Errors      []string `json:"errors,omitempty"`
+
+	spanContext SpanContext
+}
+
+// B3 trace context of the single b3 header or the multiple X-B3-* headers
+type B3 struct {
+	Format       string   `json:"format"`
+	TraceID      string   `json:"trace-id,omitempty"`
+	SpanID       string   `json:"span-id,omitempty"`
+	ParentSpanID string   `json:"parent-span-id,omitempty"`
+	Sampled      *bool    `json:"sampled,omitempty"`
+	Debug        bool     `json:"debug,omitempty"`
+	Valid        bool     `json:"valid"`
+	Errors       []string `json:"errors,omitempty"`
+
+	spanContext SpanContext
+}
+
+// Span created by serverbin for the request
+type Span struct {
+	TraceID  string `json:"trace-id"`
+	SpanID   string `json:"span-id"`
+	ParentID string `json:"parent-id,omitempty"`
+	Sampled  bool   `json:"sampled"`
+}
+
+// Parse parses the w3c and b3 headers, returns nil if there are none
+func Parse(h http.Header) *Trace {
+	t := &Trace{}
+
+	if v := h.Values(TraceparentHeader); len(v) > 0 {
+		t.W3C = parseW3C(v, h.Values(TracestateHeader))
+	}
+
+	if v := h.Get(B3Header); v != "" {
+		t.B3 = parseB3Single(v)
+	} else if h.Get(B3TraceIDHeader) != "" || h.Get(B3SampledHeader) != "" || h.Get(B3FlagsHeader) != "" {
+		t.B3 = parseB3Multi(h)
+	}
+
+	if t.W3C == nil && t.B3 == nil {
+		return nil
+	}
+
+	return t
+}
+
+// FromRequest parses the trace headers and adds the span created for the request
+func FromRequest(r *http.Request) *Trace {
+	t := Parse(r.Header)
+
+	if sc, ok := SpanFromContext(r.Context()); ok {
+		if t == nil {
+			t = &Trace{}
+		}
+
+		t.Span = &Span{
+			TraceID: sc.TraceID.String(),
+			SpanID:  sc.SpanID.String(),
+			Sampled: sc.Sampled,
+		}
+
+		if parent, ok := t.Parent(); ok && parent.TraceID == sc.TraceID {
+			t.Span.ParentID = parent.SpanID.String()
+		}
+	}
+
+	return t
+}
+
+// Parent returns the valid span context of the caller, w3c has precedence over b3
+func (t *Trace) Parent() (SpanContext, bool) {
+	if t == nil {
+		return SpanContext{}, false
+	}
+
+	if t.W3C != nil && t.W3C.Valid {
+		return t.W3C.spanContext, true
+	}
+
+	if t.B3 != nil && t.B3.Valid && t.B3.spanContext.IsValid() {
+		return t.B3.spanContext, true
+	}
+
+	return SpanContext{}, false
+}
+
+func parseW3C(traceparent []string, tracestate []string) *W3C {
+	w := &W3C{
+		Traceparent: strings.Join(traceparent, ","),
+	}
+
+	if len(traceparent) > 1 {
+		w.Errors = append(w.Errors, "multiple traceparent headers")
+	}
+
+	parts := strings.Split(strings.TrimSpace(traceparent[0]), "-")
+	if len(parts) < 4 {
+		w.Errors = append(w.Errors, "traceparent must have 4 fields")
+		return w
+	}
+
+	w.Version, w.TraceID, w.ParentID, w.Flags = parts[0], parts[1], parts[2], parts[3]
+
+	switch {
+	case !isHex(w.Version, 2):
+		w.Errors = append(w.Errors, "version must be 2 lowercase hex characters")
+	case w.Version == "ff":
+		w.Errors = append(w.Errors, "version ff is invalid")
+	case w.Version == "00" && len(parts) != 4:
+		w.Errors = append(w.Errors, "traceparent of version 00 must have 4 fields")
+	}
+
+	traceID, err := parseTraceID(w.TraceID)
+	if err != nil {
+		w.Errors = append(w.Errors, "trace-id "+err.Error())
+	}
+
+	parentID, err := parseSpanID(w.ParentID)
+	if err != nil {
+		w.Errors = append(w.Errors, "parent-id "+err.Error())
+	}
+
+	if !isHex(w.Flags, 2) {
+		w.Errors = append(w.Errors, "flags must be 2 lowercase hex characters")
+	} else {
+		b, _ := hex.DecodeString(w.Flags)
+		w.Sampled = b[0]&1 == 1
+	}
+
+	members, errs := parseTracestate(tracestate)
+	w.Tracestate = members
+	w.Errors = append(w.Errors, errs...)
+
+	w.Valid = len(w.Errors) == 0
+	w.spanContext = SpanContext{
+		TraceID:    traceID,
+		SpanID:     parentID,
+		Sampled:    w.Sampled,
+		TraceState: strings.Join(members, ","),
+	}
+
+	return w
+}
+
+func parseTracestate(values []string) ([]string, []string) {
+	var members []string
+
+	var errs []string
+
+	for _, value := range values {
+		for _, member := range strings.Split(value, ",") {
+			member = strings.TrimSpace(member)
+			if member == "" {
+				continue
+			}
+
+			if i := strings.Index(member, "="); i <= 0 || i == len(member)-1 {
+				errs = append(errs, fmt.Sprintf("tracestate member %q must be key=value", member))
+				continue
+			}
+
+			members = append(members, member)
+		}
+	}
+
+	if len(members) > maxTracestateMembers {
+		errs = append(errs, fmt.Sprintf("tracestate has more than %d members", maxTracestateMembers))
+	}
+
+	return members, errs
+}
+
+// parseB3Single parses b3: {trace-id}-{span-id}-{sampled}-{parent-span-id} or b3: {sampled}
+func parseB3Single(value string) *B3 {
+	b := &B3{Format: "single"}
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+
+	if len(parts) == 1 {
+		b.setSampled(parts[0])
+		b.Valid = len(b.Errors) == 0
+
+		return b
+	}
+
+	b.TraceID, b.SpanID = parts[0], parts[1]
+
+	if len(parts) > 2 {
+		b.setSampled(parts[2])
+	}
+
+	if len(parts) > 3 {
+		b.ParentSpanID = parts[3]
+	}
+
+	if len(parts) > 4 {
+		b.Errors = append(b.Errors, "b3 must have at most 4 fields")
+	}
+
+	b.validate()
+
+	return b
+}
+
+func parseB3Multi(h http.Header) *B3 {
+	b := &B3{
+		Format:       "multi",
+		TraceID:      h.Get(B3TraceIDHeader),
+		SpanID:       h.Get(B3SpanIDHeader),
+		ParentSpanID: h.Get(B3ParentSpanID),
+	}
+
+	if v := h.Get(B3SampledHeader); v != "" {
+		b.setSampled(v)
+	}
+
+	if v := h.Get(B3FlagsHeader); v != "" {
+		if v == "1" {
+			b.setSampled("d")
+		} else {
+			b.Errors = append(b.Errors, fmt.Sprintf("invalid flags %q", v))
+		}
+	}
+
+	if b.TraceID == "" && b.SpanID == "" {
+		b.Valid = len(b.Errors) == 0
+		return b
+	}
+
+	b.validate()
+
+	return b
+}
+
+func (b *B3) setSampled(v string) {
+	sampled := false
+
+	switch v {
+	case "1", "true":
+		sampled = true
+	case "d":
+		sampled = true
+		b.Debug = true
+	case "0", "false":
+	default:
+		b.Errors = append(b.Errors, fmt.Sprintf("invalid sampling state %q", v))
+		return
+	}
+
+	b.Sampled = &sampled
+}
+
+func (b *B3) validate() {
+	var traceID TraceID
+
+	// 64 bit trace ids are left padded
+	if len(b.TraceID) == 16 {
+		id, err := parseSpanID(b.TraceID)
+		if err != nil {
+			b.Errors = append(b.Errors, "trace-id "+err.Error())
+		}
+
+		copy(traceID[8:], id[:])
+	} else {
+		id, err := parseTraceID(b.TraceID)
+		if err != nil {
+			b.Errors = append(b.Errors, "trace-id "+err.Error())
+		}
+
+		traceID = id
+	}
+
+	spanID, err := parseSpanID(b.SpanID)
+	if err != nil {
+		b.Errors = append(b.Errors, "span-id "+err.Error())
+	}
+
+	if b.ParentSpanID != "" {
+		if _, err := parseSpanID(b.ParentSpanID); err != nil {
+			b.Errors = append(b.Errors, "parent-span-id "+err.Error())
+		}
+	}
+
+	b.Valid = len(b.Errors) == 0
+	b.spanContext = SpanContext{
+		TraceID: traceID,
+		SpanID:  spanID,
+		Sampled: b.Sampled != nil && *b.Sampled,
+	}
+}
+
+func parseTraceID(s string) (TraceID, error) {
+	var id TraceID
+
+	if !isHex(s, 32) {
+		return id, fmt.Errorf("must be 32 lowercase hex characters")
+	}
+
+	_, _ = hex.Decode(id[:], []byte(s))
+
+	if !id.IsValid() {
+		return id, fmt.Errorf("must not be all zeros")
+	}
+
+	return id, nil
+}
+
+func parseSpanID(s string) (SpanID, error) {
+	var id SpanID
+
+	if !isHex(s, 16) {
+		return id, fmt.Errorf("must be 16 lowercase hex characters")
+	}
+
+	_, _ = hex.Decode(id[:], []byte(s))
+
+	if !id.IsValid() {
+		return id, fmt.Errorf("must not be all zeros")
+	}
+
+	return id, nil
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,214 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func header(kv ...string) http.Header {
+	h := http.Header{}
+	for i := 0; i < len(kv); i += 2 {
+		h.Add(kv[i], kv[i+1])
+	}
+
+	return h
+}
+
+func TestParseNone(t *testing.T) {
+	assert.Nil(t, Parse(http.Header{}))
+
+	_, ok := Parse(http.Header{}).Parent()
+	assert.False(t, ok)
+}
+
+func TestParseW3C(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  http.Header
+		valid   bool
+		sampled bool
+		errors  []string
+	}{
+		{
+			name:    "sampled",
+			header:  header("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "tracestate", "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7"),
+			valid:   true,
+			sampled: true,
+		},
+		{
+			name:   "not sampled",
+			header: header("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"),
+			valid:  true,
+		},
+		{
+			name:   "future version",
+			header: header("traceparent", "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"),
+			valid:  true,
+		},
+		{
+			name:   "zero trace id",
+			header: header("traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"),
+			errors: []string{"trace-id must not be all zeros"},
+		},
+		{
+			name:   "uppercase",
+			header: header("traceparent", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"),
+			errors: []string{"trace-id must be 32 lowercase hex characters"},
+		},
+		{
+			name:   "version ff",
+			header: header("traceparent", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"),
+			errors: []string{"version ff is invalid"},
+		},
+		{
+			name:   "missing fields",
+			header: header("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736"),
+			errors: []string{"traceparent must have 4 fields"},
+		},
+		{
+			name:   "invalid tracestate",
+			header: header("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "tracestate", "congo"),
+			errors: []string{"tracestate member \"congo\" must be key=value"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trace := Parse(tt.header)
+			require.NotNil(t, trace)
+			require.NotNil(t, trace.W3C)
+
+			assert.Equal(t, tt.valid, trace.W3C.Valid)
+			assert.Equal(t, tt.errors, trace.W3C.Errors)
+
+			sc, ok := trace.Parent()
+			assert.Equal(t, tt.valid, ok)
+
+			if ok {
+				assert.Equal(t, tt.sampled, sc.Sampled)
+				assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+				assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+			}
+		})
+	}
+}
+
+func TestParseB3(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  http.Header
+		format  string
+		valid   bool
+		traceID string
+		sampled *bool
+		debug   bool
+	}{
+		{
+			name:    "single",
+			header:  header("b3", "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90"),
+			format:  "single",
+			valid:   true,
+			traceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			sampled: boolPtr(true),
+		},
+		{
+			name:    "single 64 bit trace id",
+			header:  header("b3", "64fe8b2a57d3eff7-e457b5a2e4d86bd1-d"),
+			format:  "single",
+			valid:   true,
+			traceID: "000000000000000064fe8b2a57d3eff7",
+			sampled: boolPtr(true),
+			debug:   true,
+		},
+		{
+			name:    "single sampling only",
+			header:  header("b3", "0"),
+			format:  "single",
+			valid:   true,
+			sampled: boolPtr(false),
+		},
+		{
+			name:    "multi",
+			header:  header("X-B3-TraceId", "80f198ee56343ba864fe8b2a57d3eff7", "X-B3-SpanId", "e457b5a2e4d86bd1", "X-B3-Sampled", "1"),
+			format:  "multi",
+			valid:   true,
+			traceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			sampled: boolPtr(true),
+		},
+		{
+			name:   "multi missing span id",
+			header: header("X-B3-TraceId", "80f198ee56343ba864fe8b2a57d3eff7"),
+			format: "multi",
+		},
+		{
+			name:   "single invalid sampling state",
+			header: header("b3", "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-x"),
+			format: "single",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trace := Parse(tt.header)
+			require.NotNil(t, trace)
+			require.NotNil(t, trace.B3)
+
+			assert.Equal(t, tt.format, trace.B3.Format)
+			assert.Equal(t, tt.valid, trace.B3.Valid, trace.B3.Errors)
+			assert.Equal(t, tt.sampled, trace.B3.Sampled)
+			assert.Equal(t, tt.debug, trace.B3.Debug)
+
+			if sc, ok := trace.Parent(); ok {
+				assert.Equal(t, tt.traceID, sc.TraceID.String())
+			} else {
+				assert.Empty(t, tt.traceID)
+			}
+		})
+	}
+}
+
+func TestParseW3CPrecedence(t *testing.T) {
+	trace := Parse(header(
+		"traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"b3", "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1",
+	))
+
+	sc, ok := trace.Parent()
+	require.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+}
+
+func TestInject(t *testing.T) {
+	sc, ok := Parse(header("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "tracestate", "rojo=1")).Parent()
+	require.True(t, ok)
+
+	ctx := ContextWithSpan(context.Background(), sc)
+
+	h := http.Header{}
+	Inject(ctx, h, PropagationW3C)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", h.Get(TraceparentHeader))
+	assert.Equal(t, "rojo=1", h.Get(TracestateHeader))
+
+	h = http.Header{}
+	Inject(ctx, h, PropagationB3)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1", h.Get(B3Header))
+
+	h = http.Header{}
+	Inject(ctx, h, PropagationB3Multi)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", h.Get(B3TraceIDHeader))
+	assert.Equal(t, "00f067aa0ba902b7", h.Get(B3SpanIDHeader))
+	assert.Equal(t, "1", h.Get(B3SampledHeader))
+
+	// without span context
+	h = http.Header{}
+	Inject(context.Background(), h, PropagationW3C)
+	assert.Empty(t, h)
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
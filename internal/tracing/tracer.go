@@ -0,0 +1,505 @@
+package tracing
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/marsom/serverbin/internal/logging"
+)
+
+// Span kinds of otlp
+const (
+	kindServer = 2
+	kindClient = 3
+)
+
+// statusError is the otlp status code of failed spans
+const statusError = 2
+
+// Config of a tracer
+type Config struct {
+	// Endpoint is the otlp/http traces endpoint, i.e. http://localhost:4318/v1/traces. Spans are not exported if empty.
+	Endpoint string
+	// Headers are sent with each export request, i.e. for authentication
+	Headers        map[string]string
+	ServiceName    string
+	ServiceVersion string
+	InstanceID     string
+	// SampleRatio of requests without a sampled parent
+	SampleRatio float64
+	// Propagation format of outgoing requests
+	Propagation   string
+	BatchSize     int
+	BatchInterval time.Duration
+	QueueSize     int
+	Timeout       time.Duration
+}
+
+// Tracer creates a span per request and exports the sampled spans. All methods can be called on a nil Tracer.
+type Tracer struct {
+	config Config
+	client *http.Client
+	queue  chan *span
+	stop   chan struct{}
+	done   chan struct{}
+	errc   chan error
+	once   sync.Once
+
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+type span struct {
+	sc         SpanContext
+	parent     SpanID
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	status     int
+}
+
+// New creates a tracer
+func New(config Config) *Tracer {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 512
+	}
+
+	if config.BatchInterval <= 0 {
+		config.BatchInterval = 5 * time.Second
+	}
+
+	if config.QueueSize <= 0 {
+		config.QueueSize = 2048
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	return &Tracer{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		queue:  make(chan *span, config.QueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		errc:   make(chan error),
+		random: rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec // sampling is not security relevant
+	}
+}
+
+// Start starts the exporter
+func (t *Tracer) Start() error {
+	if t == nil || t.config.Endpoint == "" {
+		return nil
+	}
+
+	go t.export()
+
+	return nil
+}
+
+// Done never reports an error, failed exports are logged
+func (t *Tracer) Done() <-chan error {
+	if t == nil {
+		return nil
+	}
+
+	return t.errc
+}
+
+// Shutdown exports the queued spans
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil || t.config.Endpoint == "" {
+		return nil
+	}
+
+	t.once.Do(func() {
+		close(t.stop)
+	})
+
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("tracing exporter shutdown failed: %w", ctx.Err())
+	}
+}
+
+// Propagation format of outgoing requests
+func (t *Tracer) Propagation() string {
+	if t == nil {
+		return PropagationW3C
+	}
+
+	return t.config.Propagation
+}
+
+// start creates a span, the parent is continued if valid
+func (t *Tracer) start(parent SpanContext, hasParent bool, name string, kind int) *span {
+	s := &span{
+		sc: SpanContext{
+			TraceID: NewTraceID(),
+			SpanID:  NewSpanID(),
+		},
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: map[string]interface{}{},
+	}
+
+	if hasParent {
+		s.sc.TraceID = parent.TraceID
+		s.sc.Sampled = parent.Sampled
+		s.sc.TraceState = parent.TraceState
+		s.parent = parent.SpanID
+	} else {
+		t.mu.Lock()
+		s.sc.Sampled = t.random.Float64() < t.config.SampleRatio
+		t.mu.Unlock()
+	}
+
+	return s
+}
+
+// finish queues sampled spans for the export, spans are dropped if the queue is full
+func (t *Tracer) finish(s *span) {
+	s.end = time.Now()
+
+	if !s.sc.Sampled || t.config.Endpoint == "" {
+		return
+	}
+
+	select {
+	case t.queue <- s:
+	default:
+	}
+}
+
+// Handler creates a server span for each request and adds the span to the request context
+func (t *Tracer) Handler(server string, next http.Handler) http.Handler {
+	if t == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent, ok := Parse(r.Header).Parent()
+
+		s := t.start(parent, ok, "HTTP "+r.Method, kindServer)
+		s.attributes["http.method"] = r.Method
+		s.attributes["http.target"] = r.RequestURI
+		s.attributes["http.flavor"] = r.Proto
+		s.attributes["http.user_agent"] = r.UserAgent()
+		s.attributes["serverbin.server"] = server
+
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			s.attributes["net.peer.ip"] = host
+		}
+
+		w.Header().Set(TraceresponseHeader, s.sc.Traceparent())
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ContextWithSpan(r.Context(), s.sc)))
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		s.attributes["http.status_code"] = status
+		if status >= http.StatusInternalServerError {
+			s.status = statusError
+		}
+
+		t.finish(s)
+	})
+}
+
+// Transport creates a client span for each request and propagates it
+func (t *Tracer) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		r = r.Clone(r.Context())
+
+		if t == nil {
+			Inject(r.Context(), r.Header, PropagationW3C)
+			return base.RoundTrip(r)
+		}
+
+		parent, ok := SpanFromContext(r.Context())
+
+		s := t.start(parent, ok, "HTTP "+r.Method, kindClient)
+		s.attributes["http.method"] = r.Method
+		s.attributes["http.url"] = r.URL.String()
+
+		Inject(ContextWithSpan(r.Context(), s.sc), r.Header, t.config.Propagation)
+
+		resp, err := base.RoundTrip(r)
+		if err != nil {
+			s.status = statusError
+		} else {
+			s.attributes["http.status_code"] = resp.StatusCode
+		}
+
+		t.finish(s)
+
+		return resp, err
+	})
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// export sends batches of spans until the tracer is stopped
+func (t *Tracer) export() {
+	ticker := time.NewTicker(t.config.BatchInterval)
+	defer ticker.Stop()
+
+	batch := make([]*span, 0, t.config.BatchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := t.send(batch); err != nil {
+			logging.Warn("tracing export failed", logging.F("spans", len(batch)), logging.F("error", err))
+		}
+
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= t.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.stop:
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+				default:
+					flush()
+					close(t.done)
+
+					return
+				}
+			}
+		}
+	}
+}
+
+// send exports spans with otlp/http json encoding
+func (t *Tracer) send(spans []*span) error {
+	body, err := json.Marshal(t.request(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	for k, v := range t.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	TraceState        string          `json:"traceState,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code int `json:"code"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+func attribute(key string, value interface{}) otlpAttribute {
+	switch v := value.(type) {
+	case int:
+		s := strconv.Itoa(v)
+		return otlpAttribute{Key: key, Value: otlpValue{IntValue: &s}}
+	case string:
+		return otlpAttribute{Key: key, Value: otlpValue{StringValue: &v}}
+	default:
+		s := fmt.Sprint(v)
+		return otlpAttribute{Key: key, Value: otlpValue{StringValue: &s}}
+	}
+}
+
+func (t *Tracer) request(spans []*span) otlpRequest {
+	resource := []otlpAttribute{
+		attribute("service.name", t.config.ServiceName),
+	}
+
+	if t.config.ServiceVersion != "" {
+		resource = append(resource, attribute("service.version", t.config.ServiceVersion))
+	}
+
+	if t.config.InstanceID != "" {
+		resource = append(resource, attribute("service.instance.id", t.config.InstanceID))
+	}
+
+	otlpSpans := make([]otlpSpan, len(spans))
+
+	for i, s := range spans {
+		o := otlpSpan{
+			TraceID:           s.sc.TraceID.String(),
+			SpanID:            s.sc.SpanID.String(),
+			TraceState:        s.sc.TraceState,
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: s.status},
+		}
+
+		if s.parent.IsValid() {
+			o.ParentSpanID = s.parent.String()
+		}
+
+		for _, k := range sortedKeys(s.attributes) {
+			o.Attributes = append(o.Attributes, attribute(k, s.attributes[k]))
+		}
+
+		otlpSpans[i] = o
+	}
+
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: resource},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "serverbin", Version: t.config.ServiceVersion},
+				Spans: otlpSpans,
+			}},
+		}},
+	}
+}
+
+// statusRecorder records the status, flush and hijack are passed to the response writer
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijack not supported")
+	}
+
+	return h.Hijack()
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,149 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collector is a stand-in of an otlp/http collector
+type collector struct {
+	mu       sync.Mutex
+	requests []otlpRequest
+	headers  []http.Header
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req otlpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests = append(c.requests, req)
+	c.headers = append(c.headers, r.Header)
+}
+
+func (c *collector) spans() []otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var spans []otlpSpan
+
+	for _, req := range c.requests {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}
+
+	return spans
+}
+
+func TestTracerHandler(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	tracer := New(Config{
+		Endpoint:    srv.URL + "/v1/traces",
+		Headers:     map[string]string{"Authorization": "Bearer test"},
+		ServiceName: "serverbin",
+		SampleRatio: 1,
+	})
+	require.NoError(t, tracer.Start())
+
+	var trace *Trace
+
+	h := tracer.Handler("http", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace = FromRequest(r)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/status/500", nil)
+	r.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	require.NotNil(t, trace)
+	require.NotNil(t, trace.Span)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", trace.Span.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", trace.Span.ParentID)
+	assert.True(t, trace.Span.Sampled)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+trace.Span.SpanID+"-01", w.Header().Get(TraceresponseHeader))
+
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	spans := c.spans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].TraceID)
+	assert.Equal(t, trace.Span.SpanID, spans[0].SpanID)
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].ParentSpanID)
+	assert.Equal(t, kindServer, spans[0].Kind)
+	assert.Equal(t, statusError, spans[0].Status.Code)
+	assert.Contains(t, spans[0].Attributes, attribute("http.status_code", 500))
+	assert.Equal(t, "Bearer test", c.headers[0].Get("Authorization"))
+}
+
+func TestTracerNotSampled(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	tracer := New(Config{Endpoint: srv.URL, SampleRatio: 0})
+	require.NoError(t, tracer.Start())
+
+	h := tracer.Handler("http", http.NotFoundHandler())
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	require.NoError(t, tracer.Shutdown(context.Background()))
+	assert.Empty(t, c.spans())
+}
+
+func TestTracerTransport(t *testing.T) {
+	var received http.Header
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+	}))
+	defer upstream.Close()
+
+	tracer := New(Config{SampleRatio: 1, Propagation: PropagationB3})
+
+	sc := SpanContext{TraceID: NewTraceID(), SpanID: NewSpanID(), Sampled: true}
+	req, err := http.NewRequestWithContext(ContextWithSpan(context.Background(), sc), http.MethodGet, upstream.URL, nil)
+	require.NoError(t, err)
+
+	resp, err := (&http.Client{Transport: tracer.Transport(nil)}).Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	trace := Parse(received)
+	require.NotNil(t, trace)
+	require.NotNil(t, trace.B3)
+	assert.True(t, trace.B3.Valid)
+	assert.Equal(t, sc.TraceID.String(), trace.B3.TraceID)
+	assert.NotEqual(t, sc.SpanID.String(), trace.B3.SpanID)
+}
+
+func TestTracerNil(t *testing.T) {
+	var tracer *Tracer
+
+	w := httptest.NewRecorder()
+	tracer.Handler("http", http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get(TraceresponseHeader))
+
+	assert.NoError(t, tracer.Start())
+	assert.NoError(t, tracer.Shutdown(context.Background()))
+}